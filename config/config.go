@@ -1,11 +1,72 @@
 package config
 
+import "time"
+
 type AppConfig struct {
-	Pause            bool   `env:"PAUSE" envDefault:"false"`
-	PhoneNumber      string `env:"PHONE_NUMBER,required"`
-	BotToken         string `env:"BOT_TOKEN,required"`
-	MetaApiAccountID string `env:"META_API_ACCOUNT_ID,required"`
-	MetaApiToken     string `env:"META_API_TOKEN,required"`
-	OpenAiToken      string `env:"OPENAI_TOKEN,required"`
-	MetaApiEndpoint  string `env:"META_API_ENDPOINT,required"`
+	Pause       bool   `env:"PAUSE" envDefault:"false"`
+	PhoneNumber string `env:"PHONE_NUMBER,required"`
+	BotToken    string `env:"BOT_TOKEN,required"`
+	// metaapi or paper. the MetaApi account is required by the metaapi broker and by the metaapi price feed
+	Broker           string `env:"BROKER" envDefault:"metaapi"`
+	MetaApiAccountID string `env:"META_API_ACCOUNT_ID"`
+	MetaApiToken     string `env:"META_API_TOKEN"`
+	OpenAiToken      string `env:"OPENAI_TOKEN"`
+	MetaApiEndpoint  string `env:"META_API_ENDPOINT"`
+	// paper trading : starting balance, price feed (metaapi or random) and symbols with their starting price
+	PaperBalance   float64 `env:"PAPER_BALANCE" envDefault:"10000"`
+	PaperPriceFeed string  `env:"PAPER_PRICE_FEED" envDefault:"random"`
+	PaperSymbols   string  `env:"PAPER_SYMBOLS" envDefault:"XAUUSD:2650,EURUSD:1.08,GBPUSD:1.27,USDJPY:150,US30:42000,NAS100:20000,BTCUSD:62000"`
+	// trading signals stream consumer
+	SignalConsumerName  string `env:"SIGNAL_CONSUMER_NAME" envDefault:"tgbot"`
+	SignalMaxDeliveries int64  `env:"SIGNAL_MAX_DELIVERIES" envDefault:"3"`
+	SignalWorkers       int    `env:"SIGNAL_WORKERS" envDefault:"4"`
+	// below this confidence the rule based parser falls back to OpenAi
+	RuleParserMinConfidence float64 `env:"RULE_PARSER_MIN_CONFIDENCE" envDefault:"0.8"`
+	// OpenAi compatible server (llama.cpp, vLLM, Ollama...), empty for OpenAi. a temperature of 0 uses the server default.
+	// signals and updates are asked with a json schema, models without structured outputs fall back to plain json
+	LLMBaseURL           string        `env:"LLM_BASE_URL"`
+	LLMSignalModel       string        `env:"LLM_SIGNAL_MODEL" envDefault:"gpt-4o-mini"`
+	LLMSignalTemperature float32       `env:"LLM_SIGNAL_TEMPERATURE" envDefault:"0.2"`
+	LLMSignalTimeout     time.Duration `env:"LLM_SIGNAL_TIMEOUT" envDefault:"30s"`
+	LLMUpdateModel       string        `env:"LLM_UPDATE_MODEL" envDefault:"gpt-4o-mini"`
+	LLMUpdateTemperature float32       `env:"LLM_UPDATE_TEMPERATURE" envDefault:"0.2"`
+	LLMUpdateTimeout     time.Duration `env:"LLM_UPDATE_TIMEOUT" envDefault:"30s"`
+	LLMTrendModel        string        `env:"LLM_TREND_MODEL" envDefault:"gpt-4-turbo-2024-04-09"`
+	LLMTrendTemperature  float32       `env:"LLM_TREND_TEMPERATURE" envDefault:"0"`
+	LLMTrendTimeout      time.Duration `env:"LLM_TREND_TIMEOUT" envDefault:"60s"`
+	// limit and stop orders not filled after this delay are cancelled by the broker
+	PendingOrderExpiration time.Duration `env:"PENDING_ORDER_EXPIRATION" envDefault:"24h"`
+	// entry zone ladder : number of limit orders per leg and delay before the unfilled ones are cancelled
+	LadderSteps        int           `env:"LADDER_STEPS" envDefault:"3"`
+	LadderOrderTimeout time.Duration `env:"LADDER_ORDER_TIMEOUT" envDefault:"2h"`
+	// trade execution : attempts, exponential backoff between them and deadline of the whole call
+	TradeMaxAttempts    int           `env:"TRADE_MAX_ATTEMPTS" envDefault:"3"`
+	TradeRetryDelay     time.Duration `env:"TRADE_RETRY_DELAY" envDefault:"200ms"`
+	TradeRetryMaxDelay  time.Duration `env:"TRADE_RETRY_MAX_DELAY" envDefault:"5s"`
+	TradeExecuteTimeout time.Duration `env:"TRADE_EXECUTE_TIMEOUT" envDefault:"30s"`
+	// MetaApi websocket synchronization of positions, orders, deals and prices. empty url uses META_API_ENDPOINT.
+	// with the stream the REST polling only reconciles the state
+	Streaming               bool          `env:"STREAMING" envDefault:"true"`
+	MetaApiStreamURL        string        `env:"META_API_STREAM_URL"`
+	StreamReconcileInterval time.Duration `env:"STREAM_RECONCILE_INTERVAL" envDefault:"1m"`
+	// trailing stops : sent to the broker when it supports them, moved by the bot otherwise. the ATR mode trails at
+	// the ATR of the timeframe times the multiplier. empty market data url uses META_API_ENDPOINT
+	BrokerTrailingStop        bool    `env:"BROKER_TRAILING_STOP" envDefault:"true"`
+	TrailingATRTimeframe      string  `env:"TRAILING_ATR_TIMEFRAME" envDefault:"15m"`
+	TrailingATRPeriod         int     `env:"TRAILING_ATR_PERIOD" envDefault:"14"`
+	TrailingATRMultiplier     float64 `env:"TRAILING_ATR_MULTIPLIER" envDefault:"2"`
+	MetaApiMarketDataEndpoint string  `env:"META_API_MARKET_DATA_ENDPOINT"`
+	// json list of the accounts the signals fan out to, each with its broker and risk. empty trades the account above
+	AccountsFile string `env:"ACCOUNTS_FILE"`
+	// trading hours : json file of sessions per symbol ("*" for the others), the broker trade sessions otherwise. the
+	// hours are in the time zone of the broker. signals are kept until their market opens within the queue delay
+	MarketHoursFile      string        `env:"MARKET_HOURS_FILE"`
+	BrokerTimeZone       string        `env:"BROKER_TIMEZONE" envDefault:"UTC"`
+	SessionQueueMaxDelay time.Duration `env:"SESSION_QUEUE_MAX_DELAY" envDefault:"72h"`
+	// economic news : csv or ics file of the events. entries are blocked from before to after an event of the currencies
+	// of the symbol with at least the minimum impact (LOW, MEDIUM or HIGH)
+	NewsCalendarFile   string        `env:"NEWS_CALENDAR_FILE"`
+	NewsBlackoutBefore time.Duration `env:"NEWS_BLACKOUT_BEFORE" envDefault:"15m"`
+	NewsBlackoutAfter  time.Duration `env:"NEWS_BLACKOUT_AFTER" envDefault:"15m"`
+	NewsMinImpact      string        `env:"NEWS_MIN_IMPACT" envDefault:"HIGH"`
 }
@@ -14,6 +14,7 @@ require (
 	github.com/sashabaranov/go-openai v1.31.0
 	go.uber.org/zap v1.27.0
 	golang.org/x/term v0.25.0
+	nhooyr.io/websocket v1.8.17
 )
 
 require (
@@ -34,6 +35,5 @@ require (
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	nhooyr.io/websocket v1.8.17 // indirect
 	rsc.io/qr v0.2.0 // indirect
 )
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"os"
 	"tdlib/app"
+	"tdlib/tgbot"
 )
 
 func main() {
+	// offline evaluation of the signal parsers, no telegram or metaapi needed
+	if len(os.Args) > 1 && os.Args[1] == "parse-eval" {
+		os.Exit(tgbot.RunParseEval(os.Args[2:], os.Stdout))
+	}
 	App := app.NewApp()
 	App.Run()
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"sort"
 	"strconv"
+	"strings"
 	"tdlib/custom_request"
 	"time"
 )
@@ -15,6 +16,8 @@ var ctx = context.Background()
 
 type RedisClient struct {
 	Rdb *redis.Client
+	// prefix of the keys of one trading account (trades, positions, balance), empty for the bot account
+	Namespace string
 }
 
 func NewRedisClient() *RedisClient {
@@ -26,6 +29,20 @@ func NewRedisClient() *RedisClient {
 		}),
 	}
 }
+
+// client of a trading account, on the same redis
+func (rdClient *RedisClient) WithNamespace(namespace string) *RedisClient {
+	return &RedisClient{Rdb: rdClient.Rdb, Namespace: namespace}
+}
+
+// key of the account
+func (rdClient *RedisClient) key(name string) string {
+	if rdClient.Namespace == "" {
+		return name
+	}
+	return rdClient.Namespace + ":" + name
+}
+
 func (rdClient *RedisClient) sendLPush(key string, value string) {
 	if rdClient.Rdb.Ping(ctx).Err() != nil {
 		panic(rdClient.Rdb.Ping(ctx).Err())
@@ -89,6 +106,9 @@ func (rdClient *RedisClient) RemoveChannel(channelId int64) {
 	rdClient.Rdb.SRem(context.Background(), "channels", channelId)
 	chanIdString := strconv.FormatInt(channelId, 10)
 	rdClient.Rdb.HDel(context.Background(), "channel_scores", chanIdString)
+	for _, topicId := range rdClient.GetChannelTopics(channelId) {
+		rdClient.RemoveChannelTopic(channelId, topicId)
+	}
 }
 
 // get all channels
@@ -120,6 +140,36 @@ func (rdClient *RedisClient) IsChannelExist(channelId int64) bool {
 	return false
 }
 
+// whitelist a forum topic of a channel. once a channel has topics, only messages of those topics are handled
+func (rdClient *RedisClient) AddChannelTopic(channelId int64, topicId int) {
+	rdClient.Rdb.SAdd(context.Background(), "channel_topics", fmt.Sprintf("%d:%d", channelId, topicId))
+}
+
+func (rdClient *RedisClient) RemoveChannelTopic(channelId int64, topicId int) {
+	rdClient.Rdb.SRem(context.Background(), "channel_topics", fmt.Sprintf("%d:%d", channelId, topicId))
+}
+
+// whitelisted topics of a channel
+func (rdClient *RedisClient) GetChannelTopics(channelId int64) []int {
+	topics := rdClient.Rdb.SMembers(context.Background(), "channel_topics")
+	if topics.Err() != nil {
+		return nil
+	}
+	prefix := strconv.FormatInt(channelId, 10) + ":"
+	var result []int
+	for _, topic := range topics.Val() {
+		if strings.HasPrefix(topic, prefix) {
+			topicId, _ := strconv.Atoi(strings.TrimPrefix(topic, prefix))
+			result = append(result, topicId)
+		}
+	}
+	return result
+}
+
+func (rdClient *RedisClient) IsChannelTopicExist(channelId int64, topicId int) bool {
+	return rdClient.Rdb.SIsMember(context.Background(), "channel_topics", fmt.Sprintf("%d:%d", channelId, topicId)).Val()
+}
+
 // trading default volume
 func (rdClient *RedisClient) SetDefaultTradingVolume(volume float64) {
 	rdClient.Rdb.Set(context.Background(), "trading_volume", volume, 0)
@@ -157,7 +207,7 @@ func (rdClient *RedisClient) GetTradingVolume(channelId int) float64 {
 
 // stock trade request link to the id of the telegram message
 func (rdClient *RedisClient) SetTradeRequest(messageId int64, tradeRequestByte []byte) {
-	rdClient.Rdb.HSet(context.Background(), "trade_request", strconv.FormatInt(messageId, 10), tradeRequestByte)
+	rdClient.Rdb.HSet(context.Background(), rdClient.key("trade_request"), strconv.FormatInt(messageId, 10), tradeRequestByte)
 }
 
 // get trade request by message id
@@ -167,7 +217,7 @@ func (rdClient *RedisClient) GetTradeRequest(messageId int64) []byte {
 	if tradeMessageId == 0 {
 		tradeMessageId = messageId
 	}
-	tradeRequest := rdClient.Rdb.HGet(context.Background(), "trade_request", strconv.FormatInt(tradeMessageId, 10))
+	tradeRequest := rdClient.Rdb.HGet(context.Background(), rdClient.key("trade_request"), strconv.FormatInt(tradeMessageId, 10))
 	if tradeRequest.Err() != nil {
 		return nil
 	}
@@ -263,17 +313,17 @@ func (rdClient *RedisClient) GetChatId() int64 {
 // store a list of trade request key
 // add trade key
 func (rdClient *RedisClient) AddTradeKey(tradeKey string) {
-	rdClient.Rdb.SAdd(context.Background(), "trade_keys", tradeKey)
+	rdClient.Rdb.SAdd(context.Background(), rdClient.key("trade_keys"), tradeKey)
 }
 
 // remove trade key
 func (rdClient *RedisClient) RemoveTradeKey(tradeKey string) {
-	rdClient.Rdb.SRem(context.Background(), "trade_keys", tradeKey)
+	rdClient.Rdb.SRem(context.Background(), rdClient.key("trade_keys"), tradeKey)
 }
 
 // get all trade keys
 func (rdClient *RedisClient) GetTradeKeys() []string {
-	tradeKeys := rdClient.Rdb.SMembers(context.Background(), "trade_keys")
+	tradeKeys := rdClient.Rdb.SMembers(context.Background(), rdClient.key("trade_keys"))
 	if tradeKeys.Err() != nil {
 		return nil
 	}
@@ -282,12 +332,12 @@ func (rdClient *RedisClient) GetTradeKeys() []string {
 
 // link trade key to the id of the telegram message
 func (rdClient *RedisClient) SetTradeKeyMessageId(tradeKey string, messageId int64) {
-	rdClient.Rdb.HSet(context.Background(), "trade_key_message_id", tradeKey, strconv.FormatInt(messageId, 10))
+	rdClient.Rdb.HSet(context.Background(), rdClient.key("trade_key_message_id"), tradeKey, strconv.FormatInt(messageId, 10))
 }
 
 // get message id by trade key
 func (rdClient *RedisClient) GetTradeKeyMessageId(tradeKey string) int64 {
-	messageId := rdClient.Rdb.HGet(context.Background(), "trade_key_message_id", tradeKey)
+	messageId := rdClient.Rdb.HGet(context.Background(), rdClient.key("trade_key_message_id"), tradeKey)
 	if messageId.Err() != nil {
 		return 0
 	}
@@ -297,7 +347,7 @@ func (rdClient *RedisClient) GetTradeKeyMessageId(tradeKey string) int64 {
 
 // get trade key by message id
 func (rdClient *RedisClient) GetTradeKeyByMessageId(messageId int64) string {
-	tradeKey := rdClient.Rdb.HGet(context.Background(), "trade_key_message_id", strconv.FormatInt(messageId, 10))
+	tradeKey := rdClient.Rdb.HGet(context.Background(), rdClient.key("trade_key_message_id"), strconv.FormatInt(messageId, 10))
 	if tradeKey.Err() != nil {
 		return ""
 	}
@@ -306,7 +356,7 @@ func (rdClient *RedisClient) GetTradeKeyByMessageId(messageId int64) string {
 
 // is trade key
 func (rdClient *RedisClient) IsTradeKeyExist(tradeKey string) bool {
-	tradeKeys := rdClient.Rdb.SMembers(context.Background(), "trade_keys")
+	tradeKeys := rdClient.Rdb.SMembers(context.Background(), rdClient.key("trade_keys"))
 	if tradeKeys.Err() != nil {
 		return false
 	}
@@ -321,12 +371,12 @@ func (rdClient *RedisClient) IsTradeKeyExist(tradeKey string) bool {
 // position message
 // set message id
 func (rdClient *RedisClient) SetPositionMessageId(positionId string, messageId int64) {
-	rdClient.Rdb.HSet(context.Background(), "position_id", positionId, strconv.FormatInt(messageId, 10))
+	rdClient.Rdb.HSet(context.Background(), rdClient.key("position_id"), positionId, strconv.FormatInt(messageId, 10))
 }
 
 // get message id
 func (rdClient *RedisClient) GetPositionMessageId(positionId string) int64 {
-	messageId := rdClient.Rdb.HGet(context.Background(), "position_id", positionId)
+	messageId := rdClient.Rdb.HGet(context.Background(), rdClient.key("position_id"), positionId)
 	if messageId.Err() != nil {
 		return 0
 	}
@@ -356,12 +406,12 @@ func (r *RedisClient) GetRiskPercentage() float64 {
 // we can have the same trade in multiple messages. We need to store the first message id of the trade and then store the following message ids on the same trade
 // we dont have trade id so we use the first message id as key
 func (rdClient *RedisClient) SetFirstTradeMessageId(firstMessageId int64, messageId int64) {
-	rdClient.Rdb.HSet(context.Background(), "trade_message_id", strconv.FormatInt(messageId, 10), strconv.FormatInt(firstMessageId, 10))
+	rdClient.Rdb.HSet(context.Background(), rdClient.key("trade_message_id"), strconv.FormatInt(messageId, 10), strconv.FormatInt(firstMessageId, 10))
 }
 
 // given a message : if it is the first message of a trade, return the message id of the first message else if it is a follow up message return the first message id
 func (rdClient *RedisClient) GetTradeFirstMessageId(messageId int64) int64 {
-	firstMessageId := rdClient.Rdb.HGet(context.Background(), "trade_message_id", strconv.FormatInt(messageId, 10))
+	firstMessageId := rdClient.Rdb.HGet(context.Background(), rdClient.key("trade_message_id"), strconv.FormatInt(messageId, 10))
 	if firstMessageId.Err() != nil {
 		return 0
 	}
@@ -371,7 +421,7 @@ func (rdClient *RedisClient) GetTradeFirstMessageId(messageId int64) int64 {
 
 // is message id a first message of a trade
 func (rdClient *RedisClient) IsTradeMessageIdExist(messageId int64) bool {
-	tradeKeys := rdClient.Rdb.HKeys(context.Background(), "trade_message_id")
+	tradeKeys := rdClient.Rdb.HKeys(context.Background(), rdClient.key("trade_message_id"))
 	if tradeKeys.Err() != nil {
 		return false
 	}
@@ -385,7 +435,7 @@ func (rdClient *RedisClient) IsTradeMessageIdExist(messageId int64) bool {
 
 // is message id a follow up message of a trade
 func (rdClient *RedisClient) IsTradeMessageIdFollowUpExist(messageId int64) bool {
-	tradeKeys := rdClient.Rdb.HVals(context.Background(), "trade_message_id")
+	tradeKeys := rdClient.Rdb.HVals(context.Background(), rdClient.key("trade_message_id"))
 	if tradeKeys.Err() != nil {
 		return false
 	}
@@ -510,13 +560,13 @@ func (rdClient *RedisClient) SetAccountBalance(balance float64) {
 	// save balance and day YYYY-MM-DD
 	today := time.Now().Format("2006-01-02")
 	// save date and balance
-	rdClient.Rdb.HSet(ctx, "account_balance", today, balance)
+	rdClient.Rdb.HSet(ctx, rdClient.key("account_balance"), today, balance)
 }
 
 func (rdClient *RedisClient) GetAccountBalance() float64 {
 	// get balance of the day
 	today := time.Now().Format("2006-01-02")
-	balance := rdClient.Rdb.HGet(ctx, "account_balance", today)
+	balance := rdClient.Rdb.HGet(ctx, rdClient.key("account_balance"), today)
 	if balance.Err() != nil {
 		return 0.0
 	}
@@ -615,11 +665,11 @@ func (rdClient *RedisClient) SetSimilarTradeMaxHour(max int) {
 }
 
 func (rdClient *RedisClient) SaveSecuredPosition(id string) {
-	rdClient.Rdb.HSet(ctx, "secured_positions", id, "1")
+	rdClient.Rdb.HSet(ctx, rdClient.key("secured_positions"), id, "1")
 }
 
 func (rdClient *RedisClient) IsSecuredPosition(id string) bool {
-	secured := rdClient.Rdb.HGet(ctx, "secured_positions", id)
+	secured := rdClient.Rdb.HGet(ctx, rdClient.key("secured_positions"), id)
 	if secured.Err() != nil {
 		return false
 	}
@@ -716,7 +766,7 @@ func (rdClient *RedisClient) GetAllChannelScoresKV() ([]KV, error) {
 
 func (rdClient *RedisClient) AddLoosingPosition(id string) error {
 	// Define the Redis key for storing losing positions
-	losingPositionsKey := "losing_positions"
+	losingPositionsKey := rdClient.key("losing_positions")
 
 	// Add the position ID to a Redis list or set
 	err := rdClient.Rdb.SAdd(ctx, losingPositionsKey, id).Err()
@@ -731,7 +781,7 @@ func (rdClient *RedisClient) AddLoosingPosition(id string) error {
 
 func (rdClient *RedisClient) IsLosingPosition(id string) bool {
 	// Define the Redis key for storing losing positions
-	losingPositionsKey := "losing_positions"
+	losingPositionsKey := rdClient.key("losing_positions")
 
 	// Check if the position ID is a member of the losing positions set
 	isMember, err := rdClient.Rdb.SIsMember(ctx, losingPositionsKey, id).Result()
@@ -776,3 +826,364 @@ func (rdClient *RedisClient) SetMaxHourForTrade(maxHourForTrade int) {
 	// Set the "max_hour_for_trade" key to the specified value
 	rdClient.Rdb.Set(ctx, "max_hour_for_trade", maxHourForTrade, 0)
 }
+
+// policy applied when the signal message of a channel is deleted : CANCEL, CLOSE_NEAR_ENTRY or ALERT
+func (rdClient *RedisClient) GetChannelDeletePolicy(i int) string {
+	policy := rdClient.Rdb.HGet(ctx, "channel_delete_policy", strconv.Itoa(i))
+	if policy.Err() != nil || policy.Val() == "" {
+		return "ALERT"
+	}
+	return policy.Val()
+}
+
+func (rdClient *RedisClient) SetChannelDeletePolicy(i int, policy string) {
+	rdClient.Rdb.HSet(ctx, "channel_delete_policy", strconv.Itoa(i), policy)
+}
+
+// trading signals stream and its consumer group
+const (
+	SignalStream           = "trading_signals_stream"
+	SignalDeadLetterStream = "trading_signals_dead"
+	SignalConsumerGroup    = "trading_signals_group"
+)
+
+// create the consumer group of the trading signals stream if not exist
+func (rdClient *RedisClient) CreateSignalConsumerGroup() error {
+	err := rdClient.Rdb.XGroupCreateMkStream(ctx, SignalStream, SignalConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// add a trading signal to the stream
+func (rdClient *RedisClient) AddSignal(payload []byte) (string, error) {
+	return rdClient.Rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: SignalStream,
+		Values: map[string]interface{}{"payload": payload},
+	}).Result()
+}
+
+// read signals for a consumer. id ">" read new signals, id "0" read signals delivered but not acknowledged yet
+func (rdClient *RedisClient) ReadSignals(consumer string, id string, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := rdClient.Rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    SignalConsumerGroup,
+		Consumer: consumer,
+		Streams:  []string{SignalStream, id},
+		Count:    10,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []redis.XMessage
+	for _, stream := range streams {
+		messages = append(messages, stream.Messages...)
+	}
+	return messages, nil
+}
+
+// take over signals left pending by another consumer for more than minIdle. the signals of the consumer itself are
+// left, they may still wait in its queues and a claim counts as a delivery
+func (rdClient *RedisClient) ClaimIdleSignals(consumer string, minIdle time.Duration) ([]redis.XMessage, error) {
+	pending, err := rdClient.Rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: SignalStream,
+		Group:  SignalConsumerGroup,
+		Idle:   minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range pending {
+		if entry.Consumer != consumer {
+			ids = append(ids, entry.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	messages, err := rdClient.Rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   SignalStream,
+		Group:    SignalConsumerGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return messages, err
+}
+
+// number of times a signal has been delivered to a consumer
+func (rdClient *RedisClient) GetSignalDeliveryCount(id string) int64 {
+	pending, err := rdClient.Rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: SignalStream,
+		Group:  SignalConsumerGroup,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// acknowledge a handled signal
+func (rdClient *RedisClient) AckSignal(id string) error {
+	return rdClient.Rdb.XAck(ctx, SignalStream, SignalConsumerGroup, id).Err()
+}
+
+// move a signal that keeps failing to the dead letter stream
+func (rdClient *RedisClient) DeadLetterSignal(message redis.XMessage, reason string) error {
+	values := map[string]interface{}{"signal_id": message.ID, "reason": reason}
+	for k, v := range message.Values {
+		values[k] = v
+	}
+	err := rdClient.Rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: SignalDeadLetterStream,
+		Values: values,
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return rdClient.AckSignal(message.ID)
+}
+
+// seconds to wait for the following messages of a signal posted in several messages, 0 to disable
+func (rdClient *RedisClient) GetChannelAssemblyWindow(i int) int {
+	window := rdClient.Rdb.HGet(ctx, "channel_assembly_window", strconv.Itoa(i))
+	if window.Err() != nil {
+		return 0
+	}
+	windowInt, _ := strconv.Atoi(window.Val())
+	return windowInt
+}
+
+func (rdClient *RedisClient) SetChannelAssemblyWindow(i int, seconds int) {
+	rdClient.Rdb.HSet(ctx, "channel_assembly_window", strconv.Itoa(i), seconds)
+}
+
+// percentage of the volume closed when a channel asks to secure profits, the rest is moved to breakeven
+func (rdClient *RedisClient) GetChannelSecureProfitPercent(i int) int {
+	percent := rdClient.Rdb.HGet(ctx, "channel_secure_profit_percent", strconv.Itoa(i))
+	if percent.Err() != nil {
+		return 50
+	}
+	percentInt, err := strconv.Atoi(percent.Val())
+	if err != nil {
+		return 50
+	}
+	return percentInt
+}
+
+func (rdClient *RedisClient) SetChannelSecureProfitPercent(i int, percent int) {
+	rdClient.Rdb.HSet(ctx, "channel_secure_profit_percent", strconv.Itoa(i), percent)
+}
+
+// entry zone ladder of a channel : OFF, LINEAR or WEIGHTED
+func (rdClient *RedisClient) GetChannelLadderMode(i int) string {
+	mode := rdClient.Rdb.HGet(ctx, "channel_ladder_mode", strconv.Itoa(i))
+	if mode.Err() != nil || mode.Val() == "" {
+		return "OFF"
+	}
+	return mode.Val()
+}
+
+func (rdClient *RedisClient) SetChannelLadderMode(i int, mode string) {
+	rdClient.Rdb.HSet(ctx, "channel_ladder_mode", strconv.Itoa(i), mode)
+}
+
+// minimum reward to risk left at the current price to take a signal received late, 0 to disable
+func (rdClient *RedisClient) GetChannelMinRewardRisk(i int) float64 {
+	value := rdClient.Rdb.HGet(ctx, "channel_min_reward_risk", strconv.Itoa(i))
+	if value.Err() != nil {
+		return 0.5
+	}
+	minRewardRisk, err := strconv.ParseFloat(value.Val(), 64)
+	if err != nil {
+		return 0.5
+	}
+	return minRewardRisk
+}
+
+func (rdClient *RedisClient) SetChannelMinRewardRisk(i int, minRewardRisk float64) {
+	rdClient.Rdb.HSet(ctx, "channel_min_reward_risk", strconv.Itoa(i), minRewardRisk)
+}
+
+// what to do with a signal whose entry is missed : SKIP or LIMIT
+func (rdClient *RedisClient) GetChannelStaleAction(i int) string {
+	action := rdClient.Rdb.HGet(ctx, "channel_stale_action", strconv.Itoa(i))
+	if action.Err() != nil || action.Val() == "" {
+		return "SKIP"
+	}
+	return action.Val()
+}
+
+func (rdClient *RedisClient) SetChannelStaleAction(i int, action string) {
+	rdClient.Rdb.HSet(ctx, "channel_stale_action", strconv.Itoa(i), action)
+}
+
+// volume split of the TP legs of a channel, STRATEGY to use the one of the strategy
+func (rdClient *RedisClient) GetChannelAllocationProfile(i int) string {
+	profile := rdClient.Rdb.HGet(ctx, "channel_allocation_profile", strconv.Itoa(i))
+	if profile.Err() != nil || profile.Val() == "" {
+		return "STRATEGY"
+	}
+	return profile.Val()
+}
+
+func (rdClient *RedisClient) SetChannelAllocationProfile(i int, profile string) {
+	rdClient.Rdb.HSet(ctx, "channel_allocation_profile", strconv.Itoa(i), profile)
+}
+
+// volume split of the TP legs of a strategy
+func (rdClient *RedisClient) GetStrategyAllocationProfile(strategy string) string {
+	profile := rdClient.Rdb.HGet(ctx, "strategy_allocation_profile", strategy)
+	if profile.Err() != nil || profile.Val() == "" {
+		return "70/20/10"
+	}
+	return profile.Val()
+}
+
+func (rdClient *RedisClient) SetStrategyAllocationProfile(strategy string, profile string) {
+	rdClient.Rdb.HSet(ctx, "strategy_allocation_profile", strategy, profile)
+}
+
+// strategies defined by the user, json by name
+func (rdClient *RedisClient) GetCustomStrategies() map[string]string {
+	strategies := rdClient.Rdb.HGetAll(ctx, "custom_strategies")
+	if strategies.Err() != nil {
+		return map[string]string{}
+	}
+	return strategies.Val()
+}
+
+func (rdClient *RedisClient) GetCustomStrategy(name string) string {
+	strategy := rdClient.Rdb.HGet(ctx, "custom_strategies", name)
+	if strategy.Err() != nil {
+		return ""
+	}
+	return strategy.Val()
+}
+
+func (rdClient *RedisClient) SetCustomStrategy(name string, strategyBytes []byte) {
+	rdClient.Rdb.HSet(ctx, "custom_strategies", name, strategyBytes)
+}
+
+func (rdClient *RedisClient) DeleteCustomStrategy(name string) {
+	rdClient.Rdb.HDel(ctx, "custom_strategies", name)
+}
+
+// trailing stop of a channel : OFF, DISTANCE, THRESHOLD or ATR
+func (rdClient *RedisClient) GetChannelTrailingMode(i int) string {
+	mode := rdClient.Rdb.HGet(ctx, "channel_trailing_mode", strconv.Itoa(i))
+	if mode.Err() != nil || mode.Val() == "" {
+		return "OFF"
+	}
+	return mode.Val()
+}
+
+func (rdClient *RedisClient) SetChannelTrailingMode(i int, mode string) {
+	rdClient.Rdb.HSet(ctx, "channel_trailing_mode", strconv.Itoa(i), mode)
+}
+
+// trailing started on a position : BROKER when the broker trails it, BOT otherwise, and its distance in price
+func (rdClient *RedisClient) GetPositionTrailing(id string) (string, float64) {
+	trailing := rdClient.Rdb.HGet(ctx, rdClient.key("position_trailing"), id)
+	if trailing.Err() != nil {
+		return "", 0
+	}
+	side, distance, _ := strings.Cut(trailing.Val(), ":")
+	value, _ := strconv.ParseFloat(distance, 64)
+	return side, value
+}
+
+func (rdClient *RedisClient) SetPositionTrailing(id string, side string, distance float64) {
+	rdClient.Rdb.HSet(ctx, rdClient.key("position_trailing"), id, side+":"+strconv.FormatFloat(distance, 'f', -1, 64))
+}
+
+// market sessions a channel is traded in, all of them when empty
+func (rdClient *RedisClient) GetChannelSessions(i int) []string {
+	sessions := rdClient.Rdb.HGet(ctx, "channel_sessions", strconv.Itoa(i))
+	if sessions.Err() != nil || sessions.Val() == "" {
+		return nil
+	}
+	return strings.Split(sessions.Val(), ",")
+}
+
+func (rdClient *RedisClient) SetChannelSessions(i int, sessions []string) {
+	rdClient.Rdb.HSet(ctx, "channel_sessions", strconv.Itoa(i), strings.Join(sessions, ","))
+}
+
+// what to do with a signal received when its market or the sessions of the channel are closed : QUEUE or REJECT
+func (rdClient *RedisClient) GetChannelClosedMarketAction(i int) string {
+	action := rdClient.Rdb.HGet(ctx, "channel_closed_market_action", strconv.Itoa(i))
+	if action.Err() != nil || action.Val() == "" {
+		return "QUEUE"
+	}
+	return action.Val()
+}
+
+func (rdClient *RedisClient) SetChannelClosedMarketAction(i int, action string) {
+	rdClient.Rdb.HSet(ctx, "channel_closed_market_action", strconv.Itoa(i), action)
+}
+
+// keep a signal until its market opens. the payload names the account which queued it
+func (rdClient *RedisClient) QueueSignal(payload []byte, at time.Time) error {
+	return rdClient.Rdb.ZAdd(ctx, "queued_signals", redis.Z{Score: float64(at.Unix()), Member: string(payload)}).Err()
+}
+
+// signals whose market is open again, removed from the queue
+func (rdClient *RedisClient) PopDueSignals(now time.Time) []string {
+	payloads, err := rdClient.Rdb.ZRangeByScore(ctx, "queued_signals", &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil
+	}
+	var due []string
+	for _, payload := range payloads {
+		// only the one that removed it releases it
+		if removed, err := rdClient.Rdb.ZRem(ctx, "queued_signals", payload).Result(); err == nil && removed > 0 {
+			due = append(due, payload)
+		}
+	}
+	return due
+}
+
+// number of signals waiting for their market
+func (rdClient *RedisClient) CountQueuedSignals() int64 {
+	return rdClient.Rdb.ZCard(ctx, "queued_signals").Val()
+}
+
+// what is done with the open positions before a news event : NONE, TIGHTEN or FLATTEN
+func (rdClient *RedisClient) GetNewsPositionAction() string {
+	action := rdClient.Rdb.Get(ctx, "news_position_action")
+	if action.Err() != nil || action.Val() == "" {
+		return "NONE"
+	}
+	return action.Val()
+}
+
+func (rdClient *RedisClient) SetNewsPositionAction(action string) {
+	rdClient.Rdb.Set(ctx, "news_position_action", action, 0)
+}
+
+// news event a position has already been protected for
+func (rdClient *RedisClient) GetPositionNewsEvent(id string) string {
+	return rdClient.Rdb.HGet(ctx, rdClient.key("position_news_event"), id).Val()
+}
+
+func (rdClient *RedisClient) SetPositionNewsEvent(id string, event string) {
+	rdClient.Rdb.HSet(ctx, rdClient.key("position_news_event"), id, event)
+}
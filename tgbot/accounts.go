@@ -0,0 +1,313 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccountProfile is a trading account receiving the signals, with its own risk. the settings left empty are the
+// ones set with the bot commands
+type AccountProfile struct {
+	// tag of the notifications and namespace of the account in redis
+	Name string `json:"name"`
+	// metaapi or paper, the broker of the bot when empty
+	Broker           string  `json:"broker,omitempty"`
+	MetaApiAccountID string  `json:"metaApiAccountId,omitempty"`
+	MetaApiToken     string  `json:"metaApiToken,omitempty"`
+	PaperBalance     float64 `json:"paperBalance,omitempty"`
+	RiskPercentage   float64 `json:"riskPercentage,omitempty"`
+	// volume of a signal, before it is split between the TPs
+	MinVolume float64 `json:"minVolume,omitempty"`
+	MaxVolume float64 `json:"maxVolume,omitempty"`
+	Strategy  string  `json:"strategy,omitempty"`
+	// symbols traded on this account
+	Symbols                  []string `json:"symbols,omitempty"`
+	DailyLossLimitPercentage float64  `json:"dailyLossLimitPercentage,omitempty"`
+	DailyProfitGoal          float64  `json:"dailyProfitGoal,omitempty"`
+}
+
+// LoadAccountProfiles read the json list of accounts
+func LoadAccountProfiles(path string) ([]AccountProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading accounts file: %w", err)
+	}
+	var profiles []AccountProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error parsing accounts file: %w", err)
+	}
+	if len(profiles) == 0 {
+		return nil, errors.New("no account in the accounts file")
+	}
+	names := make(map[string]bool)
+	for _, profile := range profiles {
+		if profile.Name == "" || strings.Contains(profile.Name, ":") {
+			return nil, fmt.Errorf("invalid account name %q", profile.Name)
+		}
+		if names[profile.Name] {
+			return nil, fmt.Errorf("account %s given twice", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return profiles, nil
+}
+
+// bot trading one account of the profiles : its own broker, symbol specifications, executor and redis namespace, the telegram bot, the
+// parser and the settings of the channels are shared
+func (tgBot *TgBot) newAccountBot(profile AccountProfile) (*TgBot, error) {
+	appConfig := *tgBot.AppConfig
+	if profile.Broker != "" {
+		appConfig.Broker = profile.Broker
+	}
+	if profile.MetaApiAccountID != "" {
+		appConfig.MetaApiAccountID = profile.MetaApiAccountID
+	}
+	if profile.MetaApiToken != "" {
+		appConfig.MetaApiToken = profile.MetaApiToken
+	}
+	if profile.PaperBalance > 0 {
+		appConfig.PaperBalance = profile.PaperBalance
+	}
+	broker, err := NewBroker(&appConfig)
+	if err != nil {
+		return nil, fmt.Errorf("account %s: %w", profile.Name, err)
+	}
+	accountBot := &TgBot{
+		RedisClient:      tgBot.RedisClient.WithNamespace(profile.Name),
+		AppConfig:        &appConfig,
+		Bot:              tgBot.Bot,
+		CurrentPositions: make(map[string]MetaApiPosition),
+		assembler:        tgBot.assembler,
+		LLM:              tgBot.LLM,
+		SignalParser:     tgBot.SignalParser,
+		Broker:           broker,
+		specifications:   newSymbolSpecificationCache(broker),
+		calendar:         tgBot.calendar,
+		news:             tgBot.news,
+		Account:          &profile,
+	}
+	accountBot.Executor = NewTradeExecutor(&appConfig, func() Broker { return accountBot.Broker })
+	return accountBot, nil
+}
+
+// bots placing the trades : the accounts of the profiles, or the bot itself
+func (tgBot *TgBot) tradingBots() []*TgBot {
+	if len(tgBot.Accounts) == 0 {
+		return []*TgBot{tgBot}
+	}
+	return tgBot.Accounts
+}
+
+// trade request of a signal message on any account
+func (tgBot *TgBot) signalTradeRequest(messageId int) []byte {
+	for _, accountBot := range tgBot.tradingBots() {
+		if request := accountBot.RedisClient.GetTradeRequest(int64(messageId)); request != nil {
+			return request
+		}
+	}
+	return nil
+}
+
+// handle a signal on every account at the same time, a slow account does not delay the entries of the others
+func (tgBot *TgBot) fanOutSignal(input HandleRequestInput) {
+	var wg sync.WaitGroup
+	for _, accountBot := range tgBot.tradingBots() {
+		if input.Account != "" && input.Account != accountBot.accountName() {
+			continue
+		}
+		accountInput := input
+		if input.ParentRequest != nil && accountBot != tgBot {
+			// the update applies to the trade of this account
+			accountInput.ParentRequest = nil
+			if input.ParentRequest.MessageId != nil {
+				accountInput.ParentRequest = accountBot.storedTradeRequest(*input.ParentRequest.MessageId)
+			}
+			if accountInput.ParentRequest == nil {
+				log.Printf("No trade for the replied message on account %s", accountBot.accountName())
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(accountBot *TgBot, accountInput HandleRequestInput) {
+			defer wg.Done()
+			// a panic of an account must not stop the others
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Panic handling trade request on account %s: %v", accountBot.accountName(), r)
+				}
+			}()
+			var err error
+			switch {
+			case input.Deleted:
+				err = accountBot.HandleDeletedTradeRequest(accountInput)
+			case input.Assembled && accountBot.RedisClient.GetTradeRequest(int64(input.MessageId)) == nil:
+				// the bare signal opened no trade on this account, the completed one is a new signal
+				accountInput.Edited = false
+				_, _, err = accountBot.HandleTradeRequest(accountInput)
+			case input.Edited:
+				_, err = accountBot.HandleEditedTradeRequest(accountInput)
+			default:
+				_, _, err = accountBot.HandleTradeRequest(accountInput)
+			}
+			if err != nil {
+				log.Printf("Error handling trade request on account %s: %v", accountBot.accountName(), err)
+			}
+		}(accountBot, accountInput)
+	}
+	wg.Wait()
+}
+
+func (tgBot *TgBot) accountName() string {
+	if tgBot.Account == nil {
+		return "default"
+	}
+	return tgBot.Account.Name
+}
+
+// settings of the account, the ones of the bot commands when not set in the profile
+
+func (tgBot *TgBot) riskPercentage() float64 {
+	if tgBot.Account != nil && tgBot.Account.RiskPercentage > 0 {
+		return tgBot.Account.RiskPercentage
+	}
+	return tgBot.RedisClient.GetRiskPercentage()
+}
+
+func (tgBot *TgBot) strategyName() string {
+	if tgBot.Account != nil && tgBot.Account.Strategy != "" {
+		return tgBot.Account.Strategy
+	}
+	return tgBot.RedisClient.GetStrategy()
+}
+
+func (tgBot *TgBot) isSymbolAllowed(symbol string) bool {
+	if tgBot.Account != nil && len(tgBot.Account.Symbols) > 0 {
+		return StringInSlice(symbol, tgBot.Account.Symbols)
+	}
+	return tgBot.RedisClient.IsSymbolExist(symbol)
+}
+
+func (tgBot *TgBot) dailyProfitGoal() float64 {
+	if tgBot.Account != nil && tgBot.Account.DailyProfitGoal > 0 {
+		return tgBot.Account.DailyProfitGoal
+	}
+	return tgBot.RedisClient.GetDailyProfitGoal()
+}
+
+func (tgBot *TgBot) dailyLossLimitPercentage() float64 {
+	if tgBot.Account != nil && tgBot.Account.DailyLossLimitPercentage > 0 {
+		return tgBot.Account.DailyLossLimitPercentage
+	}
+	return tgBot.RedisClient.GetDailyLossLimitPercentage()
+}
+
+// volume of a signal within the caps of the account, 0 stays 0. a volume under the minimum of the account is not
+// raised, it would risk more than the risk percentage : 0, the signal is not traded
+func (tgBot *TgBot) capVolume(volume float64) float64 {
+	if tgBot.Account == nil || volume <= 0 {
+		return volume
+	}
+	if tgBot.Account.MaxVolume > 0 && volume > tgBot.Account.MaxVolume {
+		return tgBot.Account.MaxVolume
+	}
+	if tgBot.Account.MinVolume > 0 && volume < tgBot.Account.MinVolume {
+		log.Printf("Volume %.2f under the minimum %.2f of account %s", volume, tgBot.Account.MinVolume, tgBot.Account.Name)
+		return 0
+	}
+	return volume
+}
+
+// how long a parsed signal is kept for the other accounts
+const parsedSignalTTL = time.Minute
+
+// cachedSignalParser parse a message once for all the accounts, the accounts asking it at the same time wait for the
+// first parse
+type cachedSignalParser struct {
+	parser   SignalParser
+	mu       sync.Mutex
+	entries  map[string]parsedSignal
+	inflight map[string]chan struct{}
+}
+
+type parsedSignal struct {
+	request *TradeRequest
+	update  *TradeUpdateRequest
+	err     error
+	time    time.Time
+}
+
+func newCachedSignalParser(parser SignalParser) SignalParser {
+	return &cachedSignalParser{parser: parser, entries: make(map[string]parsedSignal), inflight: make(map[string]chan struct{})}
+}
+
+func (p *cachedSignalParser) ParseNewMessage(message string, symbols []string) (*TradeRequest, error) {
+	entry := p.parse("new\x00"+message+"\x00"+strings.Join(symbols, ","), func(entry *parsedSignal) {
+		entry.request, entry.err = p.parser.ParseNewMessage(message, symbols)
+	})
+	if entry.request == nil {
+		return nil, entry.err
+	}
+	// each account changes its request
+	request := *entry.request
+	return &request, entry.err
+}
+
+func (p *cachedSignalParser) ParseUpdateMessage(message string) (*TradeUpdateRequest, error) {
+	entry := p.parse("update\x00"+message, func(entry *parsedSignal) {
+		entry.update, entry.err = p.parser.ParseUpdateMessage(message)
+	})
+	if entry.update == nil {
+		return nil, entry.err
+	}
+	update := *entry.update
+	return &update, entry.err
+}
+
+// cached parse of a message, parsed without the lock when it is not. failed parses are not cached
+func (p *cachedSignalParser) parse(key string, parse func(entry *parsedSignal)) parsedSignal {
+	for {
+		p.mu.Lock()
+		if entry, ok := p.entries[key]; ok && time.Since(entry.time) <= parsedSignalTTL {
+			p.mu.Unlock()
+			return entry
+		}
+		done, ok := p.inflight[key]
+		if !ok {
+			done = make(chan struct{})
+			p.inflight[key] = done
+			p.mu.Unlock()
+			break
+		}
+		p.mu.Unlock()
+		<-done
+	}
+	// the accounts waiting parse it again when this parse fails or panics
+	defer func() {
+		p.mu.Lock()
+		close(p.inflight[key])
+		delete(p.inflight, key)
+		p.mu.Unlock()
+	}()
+	var entry parsedSignal
+	parse(&entry)
+	entry.time = time.Now()
+	if entry.err != nil {
+		// errors of the llm or of the network are not kept
+		return entry
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, e := range p.entries {
+		if time.Since(e.time) > parsedSignalTTL {
+			delete(p.entries, k)
+		}
+	}
+	p.entries[key] = entry
+	return entry
+}
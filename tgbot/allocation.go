@@ -0,0 +1,120 @@
+package tgbot
+
+import (
+	"math"
+	"sort"
+)
+
+// allocation profiles : how the volume of a signal is split between its TP legs
+const (
+	AllocationProfileDefault = "70/20/10"
+	AllocationProfileHalf    = "50/30/20"
+	AllocationProfileEqual   = "EQUAL"
+	// most of the volume on the last TP
+	AllocationProfileRunner = "RUNNER"
+	// a channel using the profile of the strategy
+	AllocationProfileStrategy = "STRATEGY"
+)
+
+var AllocationProfiles = []string{AllocationProfileDefault, AllocationProfileHalf, AllocationProfileEqual, AllocationProfileRunner}
+
+// share of the volume of each leg, by number of legs
+var allocationWeights = map[string][][]float64{
+	AllocationProfileDefault: {{1}, {0.7, 0.3}, {0.7, 0.2, 0.1}},
+	AllocationProfileHalf:    {{1}, {0.6, 0.4}, {0.5, 0.3, 0.2}},
+	AllocationProfileRunner:  {{1}, {0.4, 0.6}, {0.2, 0.3, 0.5}},
+}
+
+func allocationProfileWeights(profile string, legs int) []float64 {
+	if byLegs, ok := allocationWeights[profile]; ok && legs <= len(byLegs) && legs > 0 {
+		return byLegs[legs-1]
+	}
+	weights := make([]float64, legs)
+	for i := range weights {
+		weights[i] = 1 / float64(legs)
+	}
+	return weights
+}
+
+// profile of a channel, the one of the strategy when the channel has none
+func (tgBot *TgBot) allocationProfile(channelID int, strategy string) string {
+	profile := tgBot.RedisClient.GetChannelAllocationProfile(channelID)
+	if profile == AllocationProfileStrategy || !StringInSlice(profile, AllocationProfiles) {
+		profile = tgBot.RedisClient.GetStrategyAllocationProfile(strategy)
+	}
+	return profile
+}
+
+// splitVolume split a volume between legs in multiples of the volume step, each leg at least the minimum volume.
+// the total is never exceeded : when the volume is too small for every leg, the legs with the smallest share get
+// 0 and are not placed
+func splitVolume(total float64, weights []float64, minVolume, maxVolume, volumeStep float64) []float64 {
+	if volumeStep <= 0 {
+		volumeStep = 0.01
+	}
+	if minVolume < volumeStep {
+		minVolume = volumeStep
+	}
+	volumes := make([]float64, len(weights))
+	units := int(math.Floor(total/volumeStep + 1e-6))
+	minUnits := int(math.Ceil(minVolume/volumeStep - 1e-6))
+	legs := len(weights)
+	if maxLegs := units / minUnits; maxLegs < legs {
+		legs = maxLegs
+	}
+	if legs <= 0 {
+		return volumes
+	}
+
+	// legs kept, biggest shares first
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return weights[order[a]] > weights[order[b]] })
+	kept := order[:legs]
+	sort.Ints(kept)
+	totalWeight := 0.0
+	for _, i := range kept {
+		totalWeight += weights[i]
+	}
+
+	legUnits := make(map[int]int, legs)
+	remainders := make(map[int]float64, legs)
+	used := 0
+	for _, i := range kept {
+		exact := float64(units) * weights[i] / totalWeight
+		legUnits[i] = int(math.Floor(exact + 1e-6))
+		remainders[i] = exact - float64(legUnits[i])
+		used += legUnits[i]
+	}
+	// leftovers to the legs the closest to their next lot
+	byRemainder := append([]int(nil), kept...)
+	sort.SliceStable(byRemainder, func(a, b int) bool { return remainders[byRemainder[a]] > remainders[byRemainder[b]] })
+	for j := 0; used < units; j++ {
+		legUnits[byRemainder[j%legs]]++
+		used++
+	}
+	// legs under the minimum take it from the biggest legs
+	for _, i := range kept {
+		for legUnits[i] < minUnits {
+			biggest := -1
+			for _, k := range kept {
+				if legUnits[k] > minUnits && (biggest < 0 || legUnits[k] > legUnits[biggest]) {
+					biggest = k
+				}
+			}
+			legUnits[biggest]--
+			legUnits[i]++
+		}
+	}
+
+	for _, i := range kept {
+		volume := float64(legUnits[i]) * volumeStep
+		if maxVolume > 0 && volume > maxVolume {
+			volume = math.Floor(maxVolume/volumeStep+1e-6) * volumeStep
+		}
+		volumes[i] = math.Round(volume*1e8) / 1e8
+	}
+	return volumes
+}
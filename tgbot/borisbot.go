@@ -2,6 +2,7 @@ package tgbot
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
@@ -68,6 +69,29 @@ func (tgBot *TgBot) LaunchBorisBot(*telegram.Client) {
 	dispatcher.AddHandler(handlers.NewCommand("close_all_trades", tgBot.closeAllTradesCallback))
 	// max allowed hour for trade
 	dispatcher.AddHandler(handlers.NewCommand("set_maxi_hour_for_trade", tgBot.setMaxHourForTradeCallback))
+	// policy applied when a signal message is deleted
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_delete_policy", tgBot.setChannelDeletePolicyCallback))
+	// forum topics allowed for each channel
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_topics", tgBot.setChannelTopicsCallback))
+	// wait for signals posted in several messages
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_assembly_window", tgBot.setChannelAssemblyWindowCallback))
+	// part of the volume closed when a channel asks to secure profits
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_secure_profit", tgBot.setChannelSecureProfitCallback))
+	// limit orders spread across the entry zone
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_ladder", tgBot.setChannelLadderCallback))
+	// signals received after their entry
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_stale_guard", tgBot.setChannelStaleGuardCallback))
+	// volume split between the TP legs
+	dispatcher.AddHandler(handlers.NewCommand("set_allocation", tgBot.setAllocationCallback))
+	// trailing stop of each channel
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_trailing", tgBot.setChannelTrailingCallback))
+	// trading sessions of each channel and signals received when the market is closed
+	dispatcher.AddHandler(handlers.NewCommand("set_channel_sessions", tgBot.setChannelSessionsCallback))
+	// economic news events and what is done with the positions before them
+	dispatcher.AddHandler(handlers.NewCommand("news", tgBot.newsCallback))
+	// strategies defined by the user
+	dispatcher.AddHandler(handlers.NewCommand("add_strategy", tgBot.addStrategy))
+	dispatcher.AddHandler(handlers.NewCommand("delete_strategy", tgBot.deleteStrategy))
 
 	dispatcher.AddHandler(handlers.NewCallback(nil, tgBot.handleCallback))
 
@@ -164,6 +188,54 @@ func (tgBot *TgBot) LaunchBorisBot(*telegram.Client) {
 			Command:     "set_maxi_hour_for_trade",
 			Description: "Set max hour for trade",
 		},
+		{
+			Command:     "set_channel_delete_policy",
+			Description: "Set what to do when a channel deletes a signal",
+		},
+		{
+			Command:     "set_channel_topics",
+			Description: "Set the forum topics to follow for each channel",
+		},
+		{
+			Command:     "set_channel_assembly_window",
+			Description: "Set how long to wait for the rest of a signal",
+		},
+		{
+			Command:     "set_channel_secure_profit",
+			Description: "Set the volume closed when a channel secures profits",
+		},
+		{
+			Command:     "set_channel_ladder",
+			Description: "Set the entry zone ladder of each channel",
+		},
+		{
+			Command:     "set_channel_stale_guard",
+			Description: "Set what to do with signals received after their entry",
+		},
+		{
+			Command:     "set_allocation",
+			Description: "Set the volume split between TPs of each strategy and channel",
+		},
+		{
+			Command:     "set_channel_trailing",
+			Description: "Set the trailing stop of each channel",
+		},
+		{
+			Command:     "set_channel_sessions",
+			Description: "Set the trading sessions of each channel",
+		},
+		{
+			Command:     "news",
+			Description: "List the upcoming news events",
+		},
+		{
+			Command:     "add_strategy",
+			Description: "Add a strategy : /add_strategy NAME 1,3 [60/40] [trail]",
+		},
+		{
+			Command:     "delete_strategy",
+			Description: "Delete a strategy : /delete_strategy NAME",
+		},
 	}, nil)
 
 	// Idle, to keep updates coming in, and avoid bot stopping.
@@ -421,7 +493,7 @@ func (tgBot *TgBot) getChannelsDailyStats(b *gotgbot.Bot, ctx *ext.Context, upda
 						positionNewClTotalProfit = 0.0
 					}
 					positionNewClTotalProfit = positionNewClTotalProfit + chanPositionItem.Profit
-					m := chanPositionItem.outcomeMessage(positionNewClTotalProfit)
+					m := chanPositionItem.outcomeMessage(tgBot.specifications, positionNewClTotalProfit)
 					if m != "" {
 						clientIdToMessage[newClientId] = m
 
@@ -871,7 +943,7 @@ func (tgBot *TgBot) GetBotStatus(b *gotgbot.Bot, ctx *ext.Context) error {
 	//
 	// meta apî account info
 	// name
-	information, err := tgBot.getAccountInformation()
+	information, err := tgBot.Broker.AccountInformation()
 	if err != nil {
 		return err
 	}
@@ -913,6 +985,14 @@ func (tgBot *TgBot) GetBotStatus(b *gotgbot.Bot, ctx *ext.Context) error {
 	// current profit reached
 	text = text + "\nCurrent Profit 💰: " + fmt.Sprintf("%.2f", tgBot.getTodayProfit()) + " " + information.Currency
 	text = text + "\n-------------------------"
+	// accounts the signals fan out to
+	for _, accountBot := range tgBot.Accounts {
+		text = text + fmt.Sprintf("\n🏦 %s : risk %.2f%%, %s, profit %.2f", accountBot.Account.Name,
+			accountBot.riskPercentage(), accountBot.strategyName(), accountBot.getTodayProfit())
+	}
+	if len(tgBot.Accounts) > 0 {
+		text = text + "\n-------------------------"
+	}
 
 	//  open balance
 	text = text + "\nAccount Open Balance 💰: " + fmt.Sprintf("%.2f", tgBot.getAccountBalance()) + " " + information.Currency
@@ -931,17 +1011,19 @@ func (tgBot *TgBot) GetBotStatus(b *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
+// strategies that can be chosen
+var Strategies = []string{"3TP", "TP1", "TP2", "TP1_ONLY", "TP2_ONLY", "TP3_ONLY"}
+
 func (tgBot *TgBot) setStrategy(b *gotgbot.Bot, ctx *ext.Context, b2 bool) error {
 	// Create the inline keyboard buttons
 	// list of volumes
-	strategies := []string{"3TP", "TP1", "TP2", "TP1_ONLY", "TP2_ONLY", "TP3_ONLY"}
 	// generate inlineKeyboard base on strategies
 	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
-	for _, strategy := range strategies {
+	for _, strategy := range tgBot.strategyNames() {
 		// current volule
 		currentStrategy := tgBot.RedisClient.GetStrategy()
 		// limit to 2
-		text := strategy
+		text := strategy + " : " + tgBot.strategy(strategy).String()
 		if currentStrategy == strategy {
 			text = text + " ✅"
 		}
@@ -976,6 +1058,48 @@ func (tgBot *TgBot) setStrategy(b *gotgbot.Bot, ctx *ext.Context, b2 bool) error
 	return nil
 }
 
+// /add_strategy NAME 1,3 [60/40] [trail] : legs on TP1 and TP3, 60% of the volume on TP1, TP2 moves the stop loss
+func (tgBot *TgBot) addStrategy(b *gotgbot.Bot, ctx *ext.Context) error {
+	strategy, err := parseStrategy(ctx.Args()[1:])
+	text := ""
+	if err != nil {
+		text = fmt.Sprintf("❌ %v", err)
+	} else if strategyBytes, errJ := json.Marshal(strategy); errJ != nil {
+		text = fmt.Sprintf("❌ %v", errJ)
+	} else {
+		tgBot.RedisClient.SetCustomStrategy(strategy.Name, strategyBytes)
+		text = fmt.Sprintf("✅ Strategy %s saved\n🤔 %s", strategy.Name, strategy.String())
+	}
+	_, err = ctx.EffectiveMessage.Reply(b, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send strategy message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) deleteStrategy(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()
+	text := "❌ usage: /delete_strategy NAME"
+	if len(args) > 1 {
+		name := strings.ToUpper(args[1])
+		if tgBot.RedisClient.GetCustomStrategy(name) == "" {
+			text = fmt.Sprintf("❌ Unknown strategy %s, built-in strategies can not be deleted", name)
+		} else {
+			tgBot.RedisClient.DeleteCustomStrategy(name)
+			text = fmt.Sprintf("✅ Strategy %s deleted", name)
+			if tgBot.RedisClient.GetStrategy() == name {
+				tgBot.RedisClient.SetStrategy(DefaultStrategy)
+				text = fmt.Sprintf("%s\n🤔 Strategy back to %s", text, DefaultStrategy)
+			}
+		}
+	}
+	_, err := ctx.EffectiveMessage.Reply(b, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send strategy message: %w", err)
+	}
+	return nil
+}
+
 func (tgBot *TgBot) setSymbolsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	return tgBot.setSymbols(b, ctx, 0)
 }
@@ -984,7 +1108,7 @@ func (tgBot *TgBot) setSymbolsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 func (tgBot *TgBot) setSymbols(b *gotgbot.Bot, ctx *ext.Context, page int) error {
 	symbolsPerPage := 20
 	// Récupérer la liste des symboles depuis MetaTrader
-	symbols, errS := fetchAllSymbols(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+	symbols, errS := tgBot.Broker.Symbols()
 	if errS != nil {
 		return fmt.Errorf("failed to fetch symbols: %w", errS)
 	}
@@ -1383,7 +1507,7 @@ func (tgBot *TgBot) start_trading(b *gotgbot.Bot, ctx *ext.Context) error {
 		}
 	} else {
 		tgBot.RedisClient.SetBotOn()
-		err := tgBot.deployAccount()
+		err := tgBot.Broker.Deploy()
 		if err != nil {
 			ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Failed to deploy account"), &gotgbot.SendMessageOpts{
 				ParseMode: "HTML",
@@ -1698,6 +1822,288 @@ func (tgBot *TgBot) handleCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 		return tgBot.setMaxHourForTrade(b, ctx, true)
 	}
 
+	// channel delete policy
+	if strings.HasPrefix(data, "channel_delete_policy_") {
+		channelIDStr := strings.TrimPrefix(data, "channel_delete_policy_")
+		channelID, err := strconv.Atoi(channelIDStr)
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelDeletePolicy(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_delete_policy_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_delete_policy_"), "_")
+		if len(parts) < 2 {
+			return fmt.Errorf("invalid delete policy")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		// policy may contain underscores
+		policy := strings.Join(parts[1:], "_")
+		if !StringInSlice(policy, DeletePolicies) {
+			return fmt.Errorf("invalid delete policy")
+		}
+		tgBot.RedisClient.SetChannelDeletePolicy(channelID, policy)
+		return tgBot.selectChannelDeletePolicy(b, ctx, channelID)
+	}
+
+	// channel topics
+	if strings.HasPrefix(data, "channel_topics_") {
+		channelID, err := strconv.ParseInt(strings.TrimPrefix(data, "channel_topics_"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelTopics(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "toggle_channel_topic_") {
+		parts := strings.Split(strings.TrimPrefix(data, "toggle_channel_topic_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid channel topic")
+		}
+		channelID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		topicID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid topic ID")
+		}
+		if tgBot.RedisClient.IsChannelTopicExist(channelID, topicID) {
+			tgBot.RedisClient.RemoveChannelTopic(channelID, topicID)
+		} else {
+			tgBot.RedisClient.AddChannelTopic(channelID, topicID)
+		}
+		return tgBot.selectChannelTopics(b, ctx, channelID)
+	}
+
+	// channel assembly window
+	if strings.HasPrefix(data, "channel_assembly_window_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_assembly_window_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelAssemblyWindow(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_assembly_window_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_assembly_window_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid assembly window")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		seconds, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid assembly window")
+		}
+		tgBot.RedisClient.SetChannelAssemblyWindow(channelID, seconds)
+		return tgBot.selectChannelAssemblyWindow(b, ctx, channelID)
+	}
+
+	// channel secure profit percentage
+	if strings.HasPrefix(data, "channel_secure_profit_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_secure_profit_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelSecureProfit(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_secure_profit_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_secure_profit_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid secure profit percentage")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		percent, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid secure profit percentage")
+		}
+		tgBot.RedisClient.SetChannelSecureProfitPercent(channelID, percent)
+		return tgBot.selectChannelSecureProfit(b, ctx, channelID)
+	}
+
+	// channel entry zone ladder
+	if strings.HasPrefix(data, "channel_ladder_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_ladder_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelLadder(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_ladder_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_ladder_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid ladder mode")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if !StringInSlice(parts[1], LadderModes) {
+			return fmt.Errorf("invalid ladder mode")
+		}
+		tgBot.RedisClient.SetChannelLadderMode(channelID, parts[1])
+		return tgBot.selectChannelLadder(b, ctx, channelID)
+	}
+
+	// channel trailing stop
+	if strings.HasPrefix(data, "channel_trailing_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_trailing_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelTrailing(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_trailing_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_trailing_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid trailing mode")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if !StringInSlice(parts[1], TrailingModes) {
+			return fmt.Errorf("invalid trailing mode")
+		}
+		tgBot.RedisClient.SetChannelTrailingMode(channelID, parts[1])
+		return tgBot.selectChannelTrailing(b, ctx, channelID)
+	}
+
+	// positions before the news events
+	if strings.HasPrefix(data, "news_action_") {
+		action := strings.TrimPrefix(data, "news_action_")
+		if !StringInSlice(action, NewsActions) {
+			return fmt.Errorf("invalid news action")
+		}
+		tgBot.RedisClient.SetNewsPositionAction(action)
+		return tgBot.showNews(b, ctx, true)
+	}
+
+	// channel trading sessions
+	if strings.HasPrefix(data, "channel_sessions_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_sessions_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelSessions(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "toggle_session_") {
+		// session names contain "_"
+		parts := strings.SplitN(strings.TrimPrefix(data, "toggle_session_"), "_", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid session")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if !StringInSlice(parts[1], TradingSessions) {
+			return fmt.Errorf("invalid session")
+		}
+		var sessions []string
+		for _, session := range TradingSessions {
+			selected := StringInSlice(session, tgBot.RedisClient.GetChannelSessions(channelID))
+			if (session == parts[1]) != selected {
+				sessions = append(sessions, session)
+			}
+		}
+		tgBot.RedisClient.SetChannelSessions(channelID, sessions)
+		return tgBot.selectChannelSessions(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "toggle_closed_action_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "toggle_closed_action_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if tgBot.RedisClient.GetChannelClosedMarketAction(channelID) == ClosedMarketQueue {
+			tgBot.RedisClient.SetChannelClosedMarketAction(channelID, ClosedMarketReject)
+		} else {
+			tgBot.RedisClient.SetChannelClosedMarketAction(channelID, ClosedMarketQueue)
+		}
+		return tgBot.selectChannelSessions(b, ctx, channelID)
+	}
+
+	// channel stale signal guard
+	if strings.HasPrefix(data, "channel_stale_guard_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "channel_stale_guard_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelStaleGuard(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "toggle_stale_action_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "toggle_stale_action_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if tgBot.RedisClient.GetChannelStaleAction(channelID) == StaleActionLimit {
+			tgBot.RedisClient.SetChannelStaleAction(channelID, StaleActionSkip)
+		} else {
+			tgBot.RedisClient.SetChannelStaleAction(channelID, StaleActionLimit)
+		}
+		return tgBot.selectChannelStaleGuard(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_stale_rr_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_stale_rr_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid reward to risk")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		minRewardRisk, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid reward to risk")
+		}
+		tgBot.RedisClient.SetChannelMinRewardRisk(channelID, minRewardRisk)
+		return tgBot.selectChannelStaleGuard(b, ctx, channelID)
+	}
+
+	// allocation profiles
+	if strings.HasPrefix(data, "allocation_strategy_") {
+		return tgBot.selectStrategyAllocation(b, ctx, strings.TrimPrefix(data, "allocation_strategy_"))
+	}
+	if strings.HasPrefix(data, "allocation_channel_") {
+		channelID, err := strconv.Atoi(strings.TrimPrefix(data, "allocation_channel_"))
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		return tgBot.selectChannelAllocation(b, ctx, channelID)
+	}
+	if strings.HasPrefix(data, "select_allocation_strategy_") {
+		// strategies may contain _, the profile is after the last one
+		value := strings.TrimPrefix(data, "select_allocation_strategy_")
+		separator := strings.LastIndex(value, "_")
+		if separator < 0 || !StringInSlice(value[separator+1:], AllocationProfiles) {
+			return fmt.Errorf("invalid allocation profile")
+		}
+		tgBot.RedisClient.SetStrategyAllocationProfile(value[:separator], value[separator+1:])
+		return tgBot.selectStrategyAllocation(b, ctx, value[:separator])
+	}
+	if strings.HasPrefix(data, "select_allocation_channel_") {
+		parts := strings.Split(strings.TrimPrefix(data, "select_allocation_channel_"), "_")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid allocation profile")
+		}
+		channelID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid channel ID")
+		}
+		if parts[1] != AllocationProfileStrategy && !StringInSlice(parts[1], AllocationProfiles) {
+			return fmt.Errorf("invalid allocation profile")
+		}
+		tgBot.RedisClient.SetChannelAllocationProfile(channelID, parts[1])
+		return tgBot.selectChannelAllocation(b, ctx, channelID)
+	}
+
 	switch ctx.CallbackQuery.Data {
 	case "start_trading":
 		// Add your logic to start trading
@@ -1716,6 +2122,24 @@ func (tgBot *TgBot) handleCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 		return tgBot.setTradeVolume(b, ctx, false)
 	case "set_channel_volume":
 		return tgBot.setChannelVolume(b, ctx, true)
+	case "set_channel_delete_policy":
+		return tgBot.setChannelDeletePolicy(b, ctx, true)
+	case "set_channel_topics":
+		return tgBot.setChannelTopics(b, ctx, true)
+	case "set_channel_assembly_window":
+		return tgBot.setChannelAssemblyWindow(b, ctx, true)
+	case "set_channel_secure_profit":
+		return tgBot.setChannelSecureProfit(b, ctx, true)
+	case "set_channel_ladder":
+		return tgBot.setChannelLadder(b, ctx, true)
+	case "set_channel_stale_guard":
+		return tgBot.setChannelStaleGuard(b, ctx, true)
+	case "set_allocation":
+		return tgBot.setAllocation(b, ctx, true)
+	case "set_channel_trailing":
+		return tgBot.setChannelTrailing(b, ctx, true)
+	case "set_channel_sessions":
+		return tgBot.setChannelSessions(b, ctx, true)
 	case "set_daily_profit_goal":
 		return tgBot.setDailyProfitGoal(b, ctx, false)
 	case "authorize_all_symb":
@@ -1798,66 +2222,976 @@ func (tgBot *TgBot) selectChannelVolume(b *gotgbot.Bot, ctx *ext.Context, channe
 	return nil
 }
 
-func (tgBot *TgBot) addWorkingChannels(b *gotgbot.Bot, ctx *ext.Context) error {
-	return tgBot.paginateChannels(b, ctx, -1)
+func (tgBot *TgBot) setChannelDeletePolicyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelDeletePolicy(b, ctx, false)
 }
 
-func (tgBot *TgBot) paginateChannels(b *gotgbot.Bot, ctx *ext.Context, offset int) error {
-	log, err := zap.NewDevelopment(zap.IncreaseLevel(zapcore.InfoLevel), zap.AddStacktrace(zapcore.FatalLevel))
-	if err != nil {
-		return fmt.Errorf("failed to initialize logger: %w", err)
+// select a channel then the policy applied when this channel deletes a signal message
+func (tgBot *TgBot) setChannelDeletePolicy(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	channelIds := tgBot.RedisClient.GetChannels()
+	telegramChats := make([]tg.MessagesChats, 0)
+	for _, channelId := range channelIds {
+		inputChannles := make([]tg.InputChannelClass, 0)
+		inputChannles = append(inputChannles, &tg.InputChannel{
+			ChannelID: channelId,
+		})
+		telegramChannelById, errTg := tgBot.tdClient.API().ChannelsGetChannels(context.Background(), inputChannles)
+		if errTg != nil || telegramChannelById == nil {
+			continue
+		}
+		if tMessageChat, ok := telegramChannelById.(*tg.MessagesChats); ok {
+			telegramChats = append(telegramChats, *tMessageChat)
+		}
 	}
-	defer log.Sync()
-
-	client, err := telegram.ClientFromEnvironment(telegram.Options{Logger: log})
-	if err != nil {
-		return fmt.Errorf("failed to create telegram client: %w", err)
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelItemA := range telegramChats {
+		for _, channelItem := range channelItemA.Chats {
+			if channel, ok := channelItem.(*tg.Channel); ok {
+				policy := tgBot.RedisClient.GetChannelDeletePolicy(int(channel.ID))
+				inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+					{
+						Text:         channel.Title + " ➡️ " + policy,
+						CallbackData: fmt.Sprintf("channel_delete_policy_%s", strconv.Itoa(int(channel.ID))),
+					},
+				})
+			}
+		}
 	}
-
-	err = client.Run(context.Background(), func(ctxA context.Context) error {
-		dialogs, err := client.API().MessagesGetDialogs(ctxA, &tg.MessagesGetDialogsRequest{
-			OffsetID:   offset, // Utiliser l'offset ici
-			OffsetPeer: &tg.InputPeerEmpty{},
-			Limit:      500, // Nombre d'éléments à récupérer
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the delete policy:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to get dialogs: %w", err)
+			return fmt.Errorf("failed to send start message: %w", err)
 		}
-		var selectedChannels []tg.Channel
-		var unselectedChannels []tg.Channel
-
-		// Gérer les différents types de dialogues
-		switch d := dialogs.(type) {
-		case *tg.MessagesDialogs:
-			for _, chat := range d.Chats {
-				if channel, ok := chat.(*tg.Channel); ok {
-					if tgBot.RedisClient.IsChannelExist(channel.ID) {
-						selectedChannels = append(selectedChannels, *channel)
-					} else {
-						unselectedChannels = append(unselectedChannels, *channel)
-					}
-				}
-			}
-		case *tg.MessagesDialogsSlice:
-			for _, chat := range d.Chats {
-				if channel, ok := chat.(*tg.Channel); ok {
-					if tgBot.RedisClient.IsChannelExist(channel.ID) {
-						selectedChannels = append(selectedChannels, *channel)
-					} else {
-						unselectedChannels = append(unselectedChannels, *channel)
-					}
-				}
-			}
-		default:
-			return fmt.Errorf("unsupported dialog type")
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the delete policy:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
 		}
+	}
+	return nil
+}
 
-		// Créer un tableau combiné avec les canaux sélectionnés en premier
-		var inlineKeyboard [][]gotgbot.InlineKeyboardButton
-		for _, channel := range selectedChannels {
-			inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
-				{
-					Text:         fmt.Sprintf("%s (✅)", channel.Title),
+// list of delete policies for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelDeletePolicy(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_delete_policy",
+		},
+	})
+	currentPolicy := tgBot.RedisClient.GetChannelDeletePolicy(channelID)
+	for _, policy := range DeletePolicies {
+		text := policy
+		if policy == currentPolicy {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_delete_policy_%d_%s", channelID, policy),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, "Choose what to do when the channel deletes a signal:\n"+
+		"CANCEL : cancel pending orders\n"+
+		"CLOSE_NEAR_ENTRY : cancel pending orders and close positions still near entry\n"+
+		"ALERT : only notify", &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelTopicsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelTopics(b, ctx, false)
+}
+
+// select a working forum then the topics to follow. a forum without selected topic is followed entirely
+func (tgBot *TgBot) setChannelTopics(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		channel, err := tgBot.getTelegramChannel(channelId)
+		if err != nil || !channel.Forum {
+			continue
+		}
+		text := channel.Title
+		if topics := tgBot.RedisClient.GetChannelTopics(channel.ID); len(topics) > 0 {
+			text = fmt.Sprintf("%s ➡️ %d topics", text, len(topics))
+		} else {
+			text = text + " ➡️ all topics"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("channel_topics_%d", channel.ID),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the forum to set the topics:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the forum to set the topics:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of topics of a forum, click to allow/block a topic
+func (tgBot *TgBot) selectChannelTopics(b *gotgbot.Bot, ctx *ext.Context, channelID int64) error {
+	channel, err := tgBot.getTelegramChannel(channelID)
+	if err != nil {
+		return err
+	}
+	forumTopics, err := tgBot.tdClient.API().ChannelsGetForumTopics(context.Background(), &tg.ChannelsGetForumTopicsRequest{
+		Channel: channel.AsInput(),
+		Limit:   100,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get forum topics: %w", err)
+	}
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_topics",
+		},
+	})
+	for _, topicItem := range forumTopics.Topics {
+		topic, ok := topicItem.(*tg.ForumTopic)
+		if !ok {
+			continue
+		}
+		text := fmt.Sprintf("%s (❌)", topic.Title)
+		if tgBot.RedisClient.IsChannelTopicExist(channelID, topic.ID) {
+			text = fmt.Sprintf("%s (✅)", topic.Title)
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("toggle_channel_topic_%d_%d", channelID, topic.ID),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err = ctx.EffectiveMessage.EditText(b, "Voici les topics du forum, cliquer pour autoriser/bloquer (aucun topic = tout le forum) : ", &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelAssemblyWindowCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelAssemblyWindow(b, ctx, false)
+}
+
+// select a channel then how long to wait for the rest of a signal posted in several messages
+func (tgBot *TgBot) setChannelAssemblyWindow(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		window := tgBot.RedisClient.GetChannelAssemblyWindow(int(channelId))
+		text := title + " ➡️ off"
+		if window > 0 {
+			text = fmt.Sprintf("%s ➡️ %ds ✅", title, window)
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("channel_assembly_window_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the assembly window:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the assembly window:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of assembly windows for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelAssemblyWindow(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	windows := []int{0, 10, 20, 30, 45, 60, 90, 120}
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_assembly_window",
+		},
+	})
+	currentWindow := tgBot.RedisClient.GetChannelAssemblyWindow(channelID)
+	for _, window := range windows {
+		text := fmt.Sprintf("%ds", window)
+		if window == 0 {
+			text = "off"
+		}
+		if window == currentWindow {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_assembly_window_%d_%d", channelID, window),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, "Choose how long to wait for the rest of a signal:", &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelSecureProfitCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelSecureProfit(b, ctx, false)
+}
+
+// select a channel then the percentage of the volume closed when the channel secures profits
+func (tgBot *TgBot) setChannelSecureProfit(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		percent := tgBot.RedisClient.GetChannelSecureProfitPercent(int(channelId))
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s ➡️ %d%%", title, percent),
+				CallbackData: fmt.Sprintf("channel_secure_profit_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the secure profit volume:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the secure profit volume:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of secure profit percentages for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelSecureProfit(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	percents := []int{0, 25, 50, 75, 100}
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_secure_profit",
+		},
+	})
+	currentPercent := tgBot.RedisClient.GetChannelSecureProfitPercent(channelID)
+	for _, percent := range percents {
+		text := fmt.Sprintf("%d%%", percent)
+		if percent == 0 {
+			text = "breakeven only"
+		}
+		if percent == currentPercent {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_secure_profit_%d_%d", channelID, percent),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the volume to close when the channel secures profits:", &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelLadderCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelLadder(b, ctx, false)
+}
+
+// select a channel then how its entry zones are laddered
+func (tgBot *TgBot) setChannelLadder(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		mode := tgBot.RedisClient.GetChannelLadderMode(int(channelId))
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s ➡️ %s", title, mode),
+				CallbackData: fmt.Sprintf("channel_ladder_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the entry zone ladder:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the entry zone ladder:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of ladder modes for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelLadder(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_ladder",
+		},
+	})
+	currentMode := tgBot.RedisClient.GetChannelLadderMode(channelID)
+	for _, mode := range LadderModes {
+		text := mode
+		if mode == currentMode {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_ladder_%d_%s", channelID, mode),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	text := fmt.Sprintf("Choose how to enter the zone (%d limit orders per TP, cancelled after %s):",
+		tgBot.AppConfig.LadderSteps, tgBot.AppConfig.LadderOrderTimeout)
+	_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelTrailingCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelTrailing(b, ctx, false)
+}
+
+// select a channel then how the stop loss of its trades is trailed
+func (tgBot *TgBot) setChannelTrailing(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		mode := tgBot.RedisClient.GetChannelTrailingMode(int(channelId))
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s ➡️ %s", title, mode),
+				CallbackData: fmt.Sprintf("channel_trailing_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the trailing stop:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the trailing stop:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of trailing modes for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelTrailing(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_trailing",
+		},
+	})
+	currentMode := tgBot.RedisClient.GetChannelTrailingMode(channelID)
+	for _, mode := range TrailingModes {
+		text := mode
+		if mode == currentMode {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_trailing_%d_%s", channelID, mode),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	by := "the bot"
+	if tgBot.brokerTrails() {
+		by = "the broker"
+	}
+	text := fmt.Sprintf("Choose how to trail the stop loss (moved by %s) :\n"+
+		"DISTANCE : after TP1 at the distance between the entry and TP1\n"+
+		"THRESHOLD : to the entry at TP1, to TP1 at TP2...\n"+
+		"ATR : after TP1 at %.1f ATR(%d) %s", by, tgBot.AppConfig.TrailingATRMultiplier, tgBot.AppConfig.TrailingATRPeriod,
+		tgBot.AppConfig.TrailingATRTimeframe)
+	_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) newsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.showNews(b, ctx, false)
+}
+
+// news events of the next days and what is done with the open positions before them
+func (tgBot *TgBot) showNews(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	const maxEvents = 30
+	now := time.Now()
+	events := tgBot.news.upcoming(now.Add(-tgBot.AppConfig.NewsBlackoutAfter), now.Add(7*24*time.Hour))
+	text := fmt.Sprintf("📰 News events of the next 7 days (%s impact, entries blocked %s before to %s after):",
+		tgBot.AppConfig.NewsMinImpact, tgBot.AppConfig.NewsBlackoutBefore, tgBot.AppConfig.NewsBlackoutAfter)
+	if len(events) == 0 {
+		text = text + "\nNo event"
+	}
+	for i, event := range events {
+		if i == maxEvents {
+			text = text + fmt.Sprintf("\n... %d more", len(events)-maxEvents)
+			break
+		}
+		line := event.String()
+		if event.Time.Add(-tgBot.AppConfig.NewsBlackoutBefore).Before(now) {
+			line = "⛔️ " + line
+		}
+		text = text + "\n" + line
+	}
+	text = text + "\n\nOpen positions before the news:"
+	currentAction := tgBot.RedisClient.GetNewsPositionAction()
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, action := range NewsActions {
+		buttonText := action
+		if action == currentAction {
+			buttonText = buttonText + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         buttonText,
+				CallbackData: "news_action_" + action,
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelSessionsCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelSessions(b, ctx, false)
+}
+
+// select a channel then the sessions it is traded in and what to do with its signals outside them
+func (tgBot *TgBot) setChannelSessions(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		sessions := "ALL"
+		if channelSessions := tgBot.RedisClient.GetChannelSessions(int(channelId)); len(channelSessions) > 0 {
+			sessions = strings.Join(channelSessions, ",")
+		}
+		action := tgBot.RedisClient.GetChannelClosedMarketAction(int(channelId))
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s ➡️ %s %s", title, sessions, action),
+				CallbackData: fmt.Sprintf("channel_sessions_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	text := fmt.Sprintf("Choose the channel to set the trading sessions (%d signals queued):", tgBot.RedisClient.CountQueuedSignals())
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// sessions of a channel to toggle with a back button to the list of channels
+func (tgBot *TgBot) selectChannelSessions(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_sessions",
+		},
+	})
+	actionText := "Market closed ➡️ queue until it opens"
+	if tgBot.RedisClient.GetChannelClosedMarketAction(channelID) == ClosedMarketReject {
+		actionText = "Market closed ➡️ reject the signal"
+	}
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         actionText,
+			CallbackData: fmt.Sprintf("toggle_closed_action_%d", channelID),
+		},
+	})
+	channelSessions := tgBot.RedisClient.GetChannelSessions(channelID)
+	for _, session := range TradingSessions {
+		hours := tradingSessionHours[session]
+		text := fmt.Sprintf("%s %02d:00-%02d:00 UTC", session, int(hours.From.Hours()), int(hours.To.Hours()))
+		if StringInSlice(session, channelSessions) {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("toggle_session_%d_%s", channelID, session),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the sessions the channel is traded in, all of them when none is chosen:", &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setChannelStaleGuardCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setChannelStaleGuard(b, ctx, false)
+}
+
+// select a channel then the minimum reward to risk left and what to do with a signal received too late
+func (tgBot *TgBot) setChannelStaleGuard(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		minRewardRisk := tgBot.RedisClient.GetChannelMinRewardRisk(int(channelId))
+		action := tgBot.RedisClient.GetChannelStaleAction(int(channelId))
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("%s ➡️ RR %.1f %s", title, minRewardRisk, action),
+				CallbackData: fmt.Sprintf("channel_stale_guard_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, "Choose the channel to set the late signals guard:", &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the channel to set the late signals guard:", &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// action and reward to risk thresholds for a channel with a back button to the list of channels
+func (tgBot *TgBot) selectChannelStaleGuard(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	thresholds := []float64{0, 0.3, 0.5, 1, 1.5, 2}
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_channel_stale_guard",
+		},
+	})
+	actionText := "Entry missed ➡️ skip the signal"
+	if tgBot.RedisClient.GetChannelStaleAction(channelID) == StaleActionLimit {
+		actionText = "Entry missed ➡️ limit order at the zone edge"
+	}
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         actionText,
+			CallbackData: fmt.Sprintf("toggle_stale_action_%d", channelID),
+		},
+	})
+	currentMinRewardRisk := tgBot.RedisClient.GetChannelMinRewardRisk(channelID)
+	for _, threshold := range thresholds {
+		text := fmt.Sprintf("Min RR %.1f", threshold)
+		if threshold == 0 {
+			text = "Min RR off (TP1 and SL only)"
+		}
+		if threshold == currentMinRewardRisk {
+			text = text + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         text,
+				CallbackData: fmt.Sprintf("select_stale_rr_%d_%s", channelID, strconv.FormatFloat(threshold, 'f', -1, 64)),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, "Choose the reward to risk left under which the entry is missed:", &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) setAllocationCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.setAllocation(b, ctx, false)
+}
+
+// select a strategy or a channel then how the volume is split between its TPs
+func (tgBot *TgBot) setAllocation(b *gotgbot.Bot, ctx *ext.Context, update bool) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	for _, strategy := range tgBot.strategyNames() {
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("🤔 %s ➡️ %s", strategy, tgBot.RedisClient.GetStrategyAllocationProfile(strategy)),
+				CallbackData: fmt.Sprintf("allocation_strategy_%s", strategy),
+			},
+		})
+	}
+	for _, channelId := range tgBot.RedisClient.GetChannels() {
+		title := strconv.FormatInt(channelId, 10)
+		if channel, err := tgBot.getTelegramChannel(channelId); err == nil {
+			title = channel.Title
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("🏀 %s ➡️ %s", title, tgBot.RedisClient.GetChannelAllocationProfile(int(channelId))),
+				CallbackData: fmt.Sprintf("allocation_channel_%d", channelId),
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	text := "Choose the strategy or the channel to set the volume split between TPs (a channel overrides its strategy):"
+	if !update {
+		_, err := ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	} else {
+		_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+			ParseMode:   "HTML",
+			ReplyMarkup: replyMarkup,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send start message: %w", err)
+		}
+	}
+	return nil
+}
+
+// list of allocation profiles for a strategy with a back button
+func (tgBot *TgBot) selectStrategyAllocation(b *gotgbot.Bot, ctx *ext.Context, strategy string) error {
+	currentProfile := tgBot.RedisClient.GetStrategyAllocationProfile(strategy)
+	var callbacks []string
+	for _, profile := range AllocationProfiles {
+		callbacks = append(callbacks, fmt.Sprintf("select_allocation_strategy_%s_%s", strategy, profile))
+	}
+	return tgBot.selectAllocation(b, ctx, fmt.Sprintf("Choose the volume split of the %s strategy:", strategy),
+		AllocationProfiles, callbacks, currentProfile)
+}
+
+// list of allocation profiles for a channel with a back button
+func (tgBot *TgBot) selectChannelAllocation(b *gotgbot.Bot, ctx *ext.Context, channelID int) error {
+	currentProfile := tgBot.RedisClient.GetChannelAllocationProfile(channelID)
+	profiles := append([]string{AllocationProfileStrategy}, AllocationProfiles...)
+	var callbacks []string
+	for _, profile := range profiles {
+		callbacks = append(callbacks, fmt.Sprintf("select_allocation_channel_%d_%s", channelID, profile))
+	}
+	return tgBot.selectAllocation(b, ctx, "Choose the volume split of the channel (STRATEGY uses the one of the strategy):",
+		profiles, callbacks, currentProfile)
+}
+
+func (tgBot *TgBot) selectAllocation(b *gotgbot.Bot, ctx *ext.Context, text string, profiles []string, callbacks []string,
+	currentProfile string) error {
+	var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+	inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+		{
+			Text:         " ⬅️ Back",
+			CallbackData: "set_allocation",
+		},
+	})
+	for i, profile := range profiles {
+		profileText := profile
+		if profile != AllocationProfileStrategy {
+			var shares []string
+			for _, weight := range allocationProfileWeights(profile, 3) {
+				shares = append(shares, strconv.Itoa(int(math.Round(weight*100))))
+			}
+			profileText = fmt.Sprintf("%s (%s)", profile, strings.Join(shares, "/"))
+		}
+		if profile == currentProfile {
+			profileText = profileText + " ✅"
+		}
+		inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         profileText,
+				CallbackData: callbacks[i],
+			},
+		})
+	}
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: inlineKeyboard,
+	}
+	_, _, err := ctx.EffectiveMessage.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: replyMarkup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+// get a telegram channel by id
+func (tgBot *TgBot) getTelegramChannel(channelId int64) (*tg.Channel, error) {
+	chats, err := tgBot.tdClient.API().ChannelsGetChannels(context.Background(), []tg.InputChannelClass{
+		&tg.InputChannel{ChannelID: channelId},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	for _, chat := range chats.GetChats() {
+		if channel, ok := chat.(*tg.Channel); ok {
+			return channel, nil
+		}
+	}
+	return nil, fmt.Errorf("channel %d not found", channelId)
+}
+
+func (tgBot *TgBot) addWorkingChannels(b *gotgbot.Bot, ctx *ext.Context) error {
+	return tgBot.paginateChannels(b, ctx, -1)
+}
+
+func (tgBot *TgBot) paginateChannels(b *gotgbot.Bot, ctx *ext.Context, offset int) error {
+	log, err := zap.NewDevelopment(zap.IncreaseLevel(zapcore.InfoLevel), zap.AddStacktrace(zapcore.FatalLevel))
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer log.Sync()
+
+	client, err := telegram.ClientFromEnvironment(telegram.Options{Logger: log})
+	if err != nil {
+		return fmt.Errorf("failed to create telegram client: %w", err)
+	}
+
+	err = client.Run(context.Background(), func(ctxA context.Context) error {
+		dialogs, err := client.API().MessagesGetDialogs(ctxA, &tg.MessagesGetDialogsRequest{
+			OffsetID:   offset, // Utiliser l'offset ici
+			OffsetPeer: &tg.InputPeerEmpty{},
+			Limit:      500, // Nombre d'éléments à récupérer
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get dialogs: %w", err)
+		}
+		var selectedChannels []tg.Channel
+		var unselectedChannels []tg.Channel
+
+		// Gérer les différents types de dialogues
+		switch d := dialogs.(type) {
+		case *tg.MessagesDialogs:
+			for _, chat := range d.Chats {
+				channel := dialogChatAsChannel(chat)
+				if channel == nil {
+					continue
+				}
+				if tgBot.RedisClient.IsChannelExist(channel.ID) {
+					selectedChannels = append(selectedChannels, *channel)
+				} else {
+					unselectedChannels = append(unselectedChannels, *channel)
+				}
+			}
+		case *tg.MessagesDialogsSlice:
+			for _, chat := range d.Chats {
+				channel := dialogChatAsChannel(chat)
+				if channel == nil {
+					continue
+				}
+				if tgBot.RedisClient.IsChannelExist(channel.ID) {
+					selectedChannels = append(selectedChannels, *channel)
+				} else {
+					unselectedChannels = append(unselectedChannels, *channel)
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported dialog type")
+		}
+
+		// Créer un tableau combiné avec les canaux sélectionnés en premier
+		var inlineKeyboard [][]gotgbot.InlineKeyboardButton
+		for _, channel := range selectedChannels {
+			inlineKeyboard = append(inlineKeyboard, []gotgbot.InlineKeyboardButton{
+				{
+					Text:         fmt.Sprintf("%s (✅)", channel.Title),
 					CallbackData: fmt.Sprintf("select_channel_%d", channel.ID),
 				},
 			})
@@ -1898,10 +3232,24 @@ func (tgBot *TgBot) paginateChannels(b *gotgbot.Bot, ctx *ext.Context, offset in
 	return nil
 }
 
+// channels, supergroups and basic groups of the dialogs. basic groups only carry their id and title
+func dialogChatAsChannel(chat tg.ChatClass) *tg.Channel {
+	switch c := chat.(type) {
+	case *tg.Channel:
+		return c
+	case *tg.Chat:
+		return &tg.Channel{ID: c.ID, Title: c.Title}
+	}
+	return nil
+}
+
 // function to send a new parsed message from the bot to the current chat
 func (tgBot *TgBot) sendMessage(message string, replyToMessageID int) (*gotgbot.Message, error) {
 	//tgBot.Bot
 	chatID := tgBot.RedisClient.GetChatId()
+	if tgBot.Account != nil {
+		message = "🏦 " + tgBot.Account.Name + "\n" + message
+	}
 	if replyToMessageID != 0 {
 		return tgBot.Bot.SendMessage(chatID, message, &gotgbot.SendMessageOpts{
 			BusinessConnectionId: "",
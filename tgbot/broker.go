@@ -0,0 +1,63 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"tdlib/config"
+	"time"
+)
+
+// brokers the bot can trade with
+const (
+	BrokerMetaApi = "metaapi"
+	// simulated account, no real order is sent
+	BrokerPaper = "paper"
+)
+
+// Broker is the trading account used by the bot : orders, positions, history deals, prices, symbols and account
+// information. requests and answers use the MetaApi types
+type Broker interface {
+	// place, modify, close or cancel an order or a position
+	ExecuteTrade(trade MetaApiTradeRequest) (*TradeResponse, error)
+	// opened positions
+	Positions() ([]MetaApiPosition, error)
+	// pending orders
+	Orders() ([]MetaApiPosition, error)
+	// deals and orders done between two dates
+	HistoryDeals(from time.Time, to time.Time) ([]MetaApiPosition, error)
+	HistoryOrders(from time.Time, to time.Time) ([]MetaApiPosition, error)
+	Price(symbol string) (*MetaApiPriceResponse, error)
+	Symbols() ([]string, error)
+	// volume limits and contract of a symbol
+	Specification(symbol string) (*MetaApiSymbolSpecification, error)
+	// last candles of a symbol, oldest first. timeframe 1m, 15m, 1h...
+	Candles(symbol string, timeframe string, limit int) ([]MetaApiCandle, error)
+	// the broker moves the stop loss of the trades sent with a trailingStopLoss
+	TrailingStopLoss() bool
+	AccountInformation() (MetaApiAccountInformation, error)
+	// start the connection of the account to its server
+	Deploy() error
+}
+
+// NewBroker create the broker chosen in the configuration
+func NewBroker(appConfig *config.AppConfig) (Broker, error) {
+	switch appConfig.Broker {
+	case BrokerMetaApi, "":
+		if appConfig.MetaApiEndpoint == "" || appConfig.MetaApiAccountID == "" || appConfig.MetaApiToken == "" {
+			return nil, errors.New("META_API_ENDPOINT, META_API_ACCOUNT_ID and META_API_TOKEN are required with the metaapi broker")
+		}
+		return NewMetaApiBroker(appConfig.MetaApiEndpoint, appConfig.MetaApiMarketDataEndpoint, appConfig.MetaApiAccountID,
+			appConfig.MetaApiToken), nil
+	case BrokerPaper:
+		return NewPaperBroker(appConfig)
+	}
+	return nil, fmt.Errorf("unknown broker %s", appConfig.Broker)
+}
+
+// format used by the history endpoints
+const brokerTimeLayout = "2006-01-02T15:04:05Z"
+
+// midnight of the day of t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
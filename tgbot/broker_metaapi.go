@@ -0,0 +1,264 @@
+package tgbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metaApiBroker trade on a MetaTrader account through the MetaApi REST api
+type metaApiBroker struct {
+	endpoint string
+	// historical market data api, in the same region as the client api
+	marketDataEndpoint string
+	accountId          string
+	token              string
+}
+
+func NewMetaApiBroker(endpoint string, marketDataEndpoint string, accountId string, token string) Broker {
+	if marketDataEndpoint == "" {
+		marketDataEndpoint = strings.Replace(endpoint, "mt-client-api-v1", "mt-market-data-client-api-v1", 1)
+	}
+	return &metaApiBroker{endpoint: endpoint, marketDataEndpoint: marketDataEndpoint, accountId: accountId, token: token}
+}
+
+// Function to place a trade and retrieve the response
+func (b *metaApiBroker) ExecuteTrade(trade MetaApiTradeRequest) (*TradeResponse, error) {
+	// Convert TradeRequest to JSON
+	tradeJSON, err := json.Marshal(trade)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling trade request: %v", err)
+	}
+
+	// Define MetaApi endpoint URL
+	url := fmt.Sprintf(b.endpoint+"/users/current/accounts/%s/trade", b.accountId)
+
+	// Create HTTP request
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(tradeJSON))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+
+	// Set headers
+	req.Header.Set("auth-token", b.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	// Execute HTTP request
+	client := &http.Client{Timeout: time.Second * 10}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending trade request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		// response body string
+		reponseBody := ""
+		if resp.Body != nil {
+			bodyBytes, _ := ioutil.ReadAll(resp.Body)
+			reponseBody = string(bodyBytes)
+		}
+		return nil, fmt.Errorf("failed to execute trade, status code: %d body : %s", resp.StatusCode, reponseBody)
+	}
+
+	// Read response body
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	// Parse response JSON into TradeResponse struct
+	var tradeResponse TradeResponse
+	err = json.Unmarshal(body, &tradeResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling response: %v", err)
+	}
+
+	// Return the response object
+	return &tradeResponse, nil
+}
+
+func (b *metaApiBroker) Positions() ([]MetaApiPosition, error) {
+	var positions []MetaApiPosition
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/positions", b.endpoint, b.accountId), "application/json", &positions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current user positions: %w", err)
+	}
+	return positions, nil
+}
+
+// pending orders of the account
+func (b *metaApiBroker) Orders() ([]MetaApiPosition, error) {
+	var orders []MetaApiPosition
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/orders", b.endpoint, b.accountId), "application/json", &orders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current user orders: %w", err)
+	}
+	return orders, nil
+}
+
+// {{baseUrl}}/users/current/accounts/:accountId/history-deals/time/:startTime/:endTime
+func (b *metaApiBroker) HistoryDeals(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	var deals []MetaApiPosition
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/history-deals/time/%s/%s", b.endpoint, b.accountId,
+		from.Format(brokerTimeLayout), to.Format(brokerTimeLayout)), "application/json", &deals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch history deals: %w", err)
+	}
+	return deals, nil
+}
+
+// {{baseUrl}}/users/current/accounts/:accountId/history-orders/time/:startTime/:endTime
+func (b *metaApiBroker) HistoryOrders(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	var orders []MetaApiPosition
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/history-orders/time/%s/%s", b.endpoint, b.accountId,
+		from.Format(brokerTimeLayout), to.Format(brokerTimeLayout)), "application/json", &orders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch history orders: %w", err)
+	}
+	return orders, nil
+}
+
+func (b *metaApiBroker) Price(symbol string) (*MetaApiPriceResponse, error) {
+	var priceResponse MetaApiPriceResponse
+	err := b.get(fmt.Sprintf("https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/%s/symbols/%s/current-price?keepSubscription=false",
+		b.accountId, symbol), "application/json", &priceResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current price: %w", err)
+	}
+	return &priceResponse, nil
+}
+
+// get all symbos
+// curl --location 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/symbols' \
+// --header 'auth-token: <string>' \
+// --header 'Accept: application/json'
+func (b *metaApiBroker) Symbols() ([]string, error) {
+	var symbols []string
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/symbols", b.endpoint, b.accountId), "application/json", &symbols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch symbols: %w", err)
+	}
+	return symbols, nil
+}
+
+// {{baseUrl}}/users/current/accounts/:accountId/symbols/:symbol/specification
+func (b *metaApiBroker) Specification(symbol string) (*MetaApiSymbolSpecification, error) {
+	var specification MetaApiSymbolSpecification
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/symbols/%s/specification", b.endpoint, b.accountId, symbol),
+		"application/json", &specification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch symbol specification: %w", err)
+	}
+	return &specification, nil
+}
+
+// {{marketDataUrl}}/users/current/accounts/:accountId/historical-market-data/symbols/:symbol/timeframes/:timeframe/candles
+func (b *metaApiBroker) Candles(symbol string, timeframe string, limit int) ([]MetaApiCandle, error) {
+	var candles []MetaApiCandle
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/historical-market-data/symbols/%s/timeframes/%s/candles?limit=%d",
+		b.marketDataEndpoint, b.accountId, symbol, timeframe, limit), "application/json", &candles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch candles: %w", err)
+	}
+	// oldest first whatever the order of the api
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Time < candles[j].Time })
+	return candles, nil
+}
+
+// trailing stop losses are applied by MetaApi
+func (b *metaApiBroker) TrailingStopLoss() bool {
+	return true
+}
+
+func (b *metaApiBroker) AccountInformation() (MetaApiAccountInformation, error) {
+	var accountInformation MetaApiAccountInformation
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s/account-information", b.endpoint, b.accountId), "application/json",
+		&accountInformation)
+	if err != nil {
+		return MetaApiAccountInformation{}, fmt.Errorf("failed to fetch account information: %w", err)
+	}
+	return accountInformation, nil
+}
+
+// curl --location --request POST 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/deploy?executeForAllReplicas=true' \
+// --header 'auth-token: <string>' \
+// --header 'Accept: */*'
+// deploy account
+func (b *metaApiBroker) Deploy() error {
+	return b.post(fmt.Sprintf("%s/users/current/accounts/%s/deploy?executeForAllReplicas=true", b.endpoint, b.accountId),
+		"deploy account")
+}
+
+// undeploy
+// //curl --location --request POST 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/deploy?executeForAllReplicas=true' \
+// //--header 'auth-token: <string>' \
+// //--header 'Accept: */*'
+func (b *metaApiBroker) Undeploy() error {
+	return b.post(fmt.Sprintf("%s/users/current/accounts/%s/undeploy?executeForAllReplicas=true", b.endpoint, b.accountId),
+		"undeploy account")
+}
+
+type MetaApiAccount struct {
+	ID               string `json:"_id"`
+	State            string `json:"state"`
+	ConnectionStatus string `json:"connectionStatus"`
+}
+
+// curl --location 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>' \
+// --header 'auth-token: <string>' \
+// --header 'Accept: */*'
+func (b *metaApiBroker) Account() (MetaApiAccount, error) {
+	var account MetaApiAccount
+	err := b.get(fmt.Sprintf("%s/users/current/accounts/%s", b.endpoint, b.accountId), "*/*", &account)
+	if err != nil {
+		return MetaApiAccount{}, fmt.Errorf("failed to fetch account: %w", err)
+	}
+	return account, nil
+}
+
+// GET an endpoint of the account and decode the json answer in target
+func (b *metaApiBroker) get(url string, accept string, target interface{}) error {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Add("auth-token", b.token)
+	req.Header.Add("Accept", accept)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// POST an action without body on the account
+func (b *metaApiBroker) post(url string, action string) error {
+	req, _ := http.NewRequest("POST", url, nil)
+	req.Header.Add("auth-token", b.token)
+	req.Header.Add("Accept", "*/*")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New("failed to " + action)
+	}
+	return nil
+}
@@ -0,0 +1,556 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"tdlib/config"
+	"time"
+)
+
+// price feeds of the paper broker
+const (
+	PaperPriceFeedMetaApi = "metaapi"
+	// prices move randomly from the ones of PAPER_SYMBOLS
+	PaperPriceFeedRandom = "random"
+)
+
+// paperBroker simulate an account in memory : market orders are filled at the current price, pending orders, stop
+// losses and take profits are checked each time positions or orders are read
+type paperBroker struct {
+	mu        sync.Mutex
+	priceFeed func(symbol string) (*MetaApiPriceResponse, error)
+	// candles of the metaapi price feed, none with the random one
+	candles    func(symbol string, timeframe string, limit int) ([]MetaApiCandle, error)
+	symbols    []string
+	prices     map[string]float64
+	random     *rand.Rand
+	balance    float64
+	nextTicket int64
+	positions  []MetaApiPosition
+	orders     []MetaApiPosition
+	// expiration of the pending orders by id
+	expirations   map[string]time.Time
+	deals         []MetaApiPosition
+	historyOrders []MetaApiPosition
+}
+
+func NewPaperBroker(appConfig *config.AppConfig) (Broker, error) {
+	b := &paperBroker{
+		prices:      make(map[string]float64),
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		balance:     appConfig.PaperBalance,
+		nextTicket:  time.Now().Unix(),
+		expirations: make(map[string]time.Time),
+	}
+	for _, symbolPrice := range strings.Split(appConfig.PaperSymbols, ",") {
+		symbol, price, _ := strings.Cut(strings.TrimSpace(symbolPrice), ":")
+		if symbol == "" {
+			continue
+		}
+		b.symbols = append(b.symbols, symbol)
+		if value, err := strconv.ParseFloat(price, 64); err == nil && value > 0 {
+			b.prices[symbol] = value
+		}
+	}
+	switch appConfig.PaperPriceFeed {
+	case PaperPriceFeedMetaApi:
+		if appConfig.MetaApiEndpoint == "" || appConfig.MetaApiAccountID == "" || appConfig.MetaApiToken == "" {
+			return nil, fmt.Errorf("META_API_ENDPOINT, META_API_ACCOUNT_ID and META_API_TOKEN are required with the metaapi price feed")
+		}
+		metaApi := NewMetaApiBroker(appConfig.MetaApiEndpoint, appConfig.MetaApiMarketDataEndpoint, appConfig.MetaApiAccountID,
+			appConfig.MetaApiToken)
+		b.priceFeed = metaApi.Price
+		b.candles = metaApi.Candles
+	case PaperPriceFeedRandom, "":
+		if len(b.prices) == 0 {
+			return nil, fmt.Errorf("PAPER_SYMBOLS must give a starting price to each symbol with the random price feed")
+		}
+		b.priceFeed = b.randomPrice
+	default:
+		return nil, fmt.Errorf("unknown paper price feed %s", appConfig.PaperPriceFeed)
+	}
+	return b, nil
+}
+
+// random walk of 0.05% at most per call, spread of 0.01%
+func (b *paperBroker) randomPrice(symbol string) (*MetaApiPriceResponse, error) {
+	price, ok := b.prices[symbol]
+	if !ok {
+		return nil, fmt.Errorf("no price for symbol %s", symbol)
+	}
+	price = price * (1 + (b.random.Float64()*2-1)*0.0005)
+	b.prices[symbol] = price
+	spread := price * 0.0001
+	return &MetaApiPriceResponse{Symbol: symbol, Ask: price + spread/2, Bid: price - spread/2}, nil
+}
+
+func (b *paperBroker) ExecuteTrade(trade MetaApiTradeRequest) (*TradeResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch trade.ActionType {
+	case "ORDER_TYPE_BUY", "ORDER_TYPE_SELL":
+		return b.openPosition(trade)
+	case "ORDER_TYPE_BUY_LIMIT", "ORDER_TYPE_SELL_LIMIT", "ORDER_TYPE_BUY_STOP", "ORDER_TYPE_SELL_STOP":
+		return b.placeOrder(trade)
+	case "POSITION_MODIFY":
+		i := b.positionIndex(trade.PositionID)
+		if i < 0 {
+			return paperRejected("unknown position"), nil
+		}
+		if trade.StopLoss != nil {
+			b.positions[i].StopLoss = *trade.StopLoss
+		}
+		if trade.TakeProfit != nil {
+			b.positions[i].TakeProfit = *trade.TakeProfit
+		}
+		b.positions[i].UpdateTime = paperTime(time.Now())
+		return paperDone(nil, trade.PositionID), nil
+	case "POSITION_CLOSE_ID":
+		i := b.positionIndex(trade.PositionID)
+		if i < 0 {
+			return paperRejected("unknown position"), nil
+		}
+		if err := b.closePosition(i, b.positions[i].Volume, "REASON_API"); err != nil {
+			return nil, err
+		}
+		return paperDone(nil, trade.PositionID), nil
+	case "POSITION_PARTIAL":
+		i := b.positionIndex(trade.PositionID)
+		if i < 0 || trade.Volume == nil || *trade.Volume <= 0 {
+			return paperRejected("unknown position or invalid volume"), nil
+		}
+		if err := b.closePosition(i, math.Min(*trade.Volume, b.positions[i].Volume), "REASON_API"); err != nil {
+			return nil, err
+		}
+		return paperDone(nil, trade.PositionID), nil
+	case "ORDER_CANCEL":
+		i := b.orderIndex(trade.OrderID)
+		if i < 0 {
+			return paperRejected("unknown order"), nil
+		}
+		b.removeOrder(i, "ORDER_STATE_CANCELED")
+		return paperDone(trade.OrderID, nil), nil
+	case "ORDER_MODIFY":
+		i := b.orderIndex(trade.OrderID)
+		if i < 0 {
+			return paperRejected("unknown order"), nil
+		}
+		if trade.OpenPrice != nil {
+			b.orders[i].OpenPrice = *trade.OpenPrice
+		}
+		if trade.StopLoss != nil {
+			b.orders[i].StopLoss = *trade.StopLoss
+		}
+		if trade.TakeProfit != nil {
+			b.orders[i].TakeProfit = *trade.TakeProfit
+		}
+		return paperDone(trade.OrderID, nil), nil
+	}
+	return paperRejected("unsupported action " + trade.ActionType), nil
+}
+
+func (b *paperBroker) openPosition(trade MetaApiTradeRequest) (*TradeResponse, error) {
+	if trade.Volume == nil || *trade.Volume <= 0 {
+		return paperRejected("invalid volume"), nil
+	}
+	price, err := b.priceFeed(trade.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	openPrice := price.Bid
+	if trade.ActionType == "ORDER_TYPE_BUY" {
+		openPrice = price.Ask
+	}
+	b.nextTicket++
+	id := strconv.FormatInt(b.nextTicket, 10)
+	b.addPosition(id, trade, openPrice)
+	return paperDone(&id, &id), nil
+}
+
+func (b *paperBroker) placeOrder(trade MetaApiTradeRequest) (*TradeResponse, error) {
+	if trade.Volume == nil || *trade.Volume <= 0 || trade.OpenPrice == nil || *trade.OpenPrice <= 0 {
+		return paperRejected("invalid volume or open price"), nil
+	}
+	b.nextTicket++
+	id := strconv.FormatInt(b.nextTicket, 10)
+	now := time.Now()
+	order := MetaApiPosition{
+		ID:        id,
+		Platform:  "paper",
+		Type:      trade.ActionType,
+		Symbol:    trade.Symbol,
+		Time:      paperTime(now),
+		OpenPrice: *trade.OpenPrice,
+		Volume:    *trade.Volume,
+	}
+	fillPaperTrade(&order, trade)
+	if trade.Expiration != nil && trade.Expiration.Time != "" {
+		if expiration, err := time.Parse(time.RFC3339, trade.Expiration.Time); err == nil {
+			b.expirations[id] = expiration
+		}
+	}
+	b.orders = append(b.orders, order)
+	return paperDone(&id, nil), nil
+}
+
+// a filled pending order keeps its id as position id, like MetaTrader
+func (b *paperBroker) addPosition(id string, trade MetaApiTradeRequest, openPrice float64) {
+	now := time.Now()
+	positionType := "POSITION_TYPE_SELL"
+	if strings.HasPrefix(trade.ActionType, "ORDER_TYPE_BUY") {
+		positionType = "POSITION_TYPE_BUY"
+	}
+	position := MetaApiPosition{
+		ID:           id,
+		Platform:     "paper",
+		Type:         positionType,
+		Symbol:       trade.Symbol,
+		Time:         paperTime(now),
+		UpdateTime:   paperTime(now),
+		OpenPrice:    openPrice,
+		CurrentPrice: openPrice,
+		Volume:       *trade.Volume,
+	}
+	fillPaperTrade(&position, trade)
+	b.positions = append(b.positions, position)
+	b.historyOrders = append(b.historyOrders, MetaApiPosition{
+		ID:           id,
+		Platform:     "paper",
+		Type:         trade.ActionType,
+		Symbol:       trade.Symbol,
+		Time:         paperTime(now),
+		DoneTime:     paperTimePtr(now),
+		OpenPrice:    openPrice,
+		CurrentPrice: openPrice,
+		Volume:       *trade.Volume,
+		ClientID:     position.ClientID,
+	})
+}
+
+func fillPaperTrade(position *MetaApiPosition, trade MetaApiTradeRequest) {
+	if trade.StopLoss != nil {
+		position.StopLoss = *trade.StopLoss
+	}
+	if trade.TakeProfit != nil {
+		position.TakeProfit = *trade.TakeProfit
+	}
+	if trade.ClientID != nil {
+		position.ClientID = *trade.ClientID
+	}
+	if trade.Comment != nil {
+		position.BrokerComment = *trade.Comment
+	}
+}
+
+// close a volume of a position at the current price and record the deal
+func (b *paperBroker) closePosition(i int, volume float64, reason string) error {
+	position := &b.positions[i]
+	price, err := b.priceFeed(position.Symbol)
+	if err != nil {
+		return err
+	}
+	closePrice, dealType := price.Bid, "DEAL_TYPE_SELL"
+	if position.Type == "POSITION_TYPE_SELL" {
+		closePrice, dealType = price.Ask, "DEAL_TYPE_BUY"
+	}
+	b.recordClose(i, volume, closePrice, dealType, reason)
+	return nil
+}
+
+func (b *paperBroker) recordClose(i int, volume float64, closePrice float64, dealType string, reason string) {
+	position := &b.positions[i]
+	profit := paperProfit(position, closePrice, volume)
+	b.balance += profit
+	now := time.Now()
+	b.deals = append(b.deals, MetaApiPosition{
+		ID:           position.ID,
+		Platform:     "paper",
+		Type:         dealType,
+		Symbol:       position.Symbol,
+		Time:         paperTime(now),
+		EntryType:    "DEAL_ENTRY_OUT",
+		OpenPrice:    position.OpenPrice,
+		CurrentPrice: closePrice,
+		Price:        closePrice,
+		Volume:       volume,
+		Profit:       profit,
+		Reason:       reason,
+		ClientID:     position.ClientID,
+		StopLoss:     position.StopLoss,
+		TakeProfit:   position.TakeProfit,
+	})
+	position.Volume = math.Round((position.Volume-volume)*100) / 100
+	if position.Volume <= 0 {
+		b.positions = append(b.positions[:i], b.positions[i+1:]...)
+	}
+}
+
+func (b *paperBroker) removeOrder(i int, state string) {
+	order := b.orders[i]
+	now := time.Now()
+	order.DoneTime = paperTimePtr(now)
+	order.Reason = state
+	b.historyOrders = append(b.historyOrders, order)
+	delete(b.expirations, order.ID)
+	b.orders = append(b.orders[:i], b.orders[i+1:]...)
+}
+
+// move prices : fill pending orders, expire them, hit stop losses and take profits, update the profits
+func (b *paperBroker) tick() error {
+	now := time.Now()
+	for i := len(b.orders) - 1; i >= 0; i-- {
+		order := b.orders[i]
+		if expiration, ok := b.expirations[order.ID]; ok && now.After(expiration) {
+			b.removeOrder(i, "ORDER_STATE_EXPIRED")
+			continue
+		}
+		price, err := b.priceFeed(order.Symbol)
+		if err != nil {
+			return err
+		}
+		order.CurrentPrice = price.Bid
+		buy := strings.HasPrefix(order.Type, "ORDER_TYPE_BUY")
+		if buy {
+			order.CurrentPrice = price.Ask
+		}
+		b.orders[i].CurrentPrice = order.CurrentPrice
+		limit := strings.HasSuffix(order.Type, "_LIMIT")
+		below := order.CurrentPrice <= order.OpenPrice
+		if (buy && limit == below) || (!buy && limit != below) {
+			volume := order.Volume
+			trade := MetaApiTradeRequest{
+				ActionType: order.Type,
+				Symbol:     order.Symbol,
+				Volume:     &volume,
+				StopLoss:   &order.StopLoss,
+				TakeProfit: &order.TakeProfit,
+				ClientID:   &order.ClientID,
+			}
+			delete(b.expirations, order.ID)
+			b.orders = append(b.orders[:i], b.orders[i+1:]...)
+			b.addPosition(order.ID, trade, order.OpenPrice)
+		}
+	}
+	for i := len(b.positions) - 1; i >= 0; i-- {
+		position := &b.positions[i]
+		price, err := b.priceFeed(position.Symbol)
+		if err != nil {
+			return err
+		}
+		closePrice, dealType := price.Bid, "DEAL_TYPE_SELL"
+		if position.Type == "POSITION_TYPE_SELL" {
+			closePrice, dealType = price.Ask, "DEAL_TYPE_BUY"
+		}
+		buy := position.Type == "POSITION_TYPE_BUY"
+		if position.StopLoss > 0 && ((buy && closePrice <= position.StopLoss) || (!buy && closePrice >= position.StopLoss)) {
+			b.recordClose(i, position.Volume, position.StopLoss, dealType, "DEAL_REASON_SL")
+			continue
+		}
+		if position.TakeProfit > 0 && ((buy && closePrice >= position.TakeProfit) || (!buy && closePrice <= position.TakeProfit)) {
+			b.recordClose(i, position.Volume, position.TakeProfit, dealType, "DEAL_REASON_TP")
+			continue
+		}
+		position.CurrentPrice = closePrice
+		position.Profit = paperProfit(position, closePrice, position.Volume)
+		position.UnrealizedProfit = position.Profit
+	}
+	return nil
+}
+
+func (b *paperBroker) Positions() ([]MetaApiPosition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.tick(); err != nil {
+		return nil, err
+	}
+	return append([]MetaApiPosition(nil), b.positions...), nil
+}
+
+func (b *paperBroker) Orders() ([]MetaApiPosition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.tick(); err != nil {
+		return nil, err
+	}
+	return append([]MetaApiPosition(nil), b.orders...), nil
+}
+
+func (b *paperBroker) HistoryDeals(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return paperBetween(b.deals, from, to), nil
+}
+
+func (b *paperBroker) HistoryOrders(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return paperBetween(b.historyOrders, from, to), nil
+}
+
+func (b *paperBroker) Price(symbol string) (*MetaApiPriceResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.priceFeed(symbol)
+}
+
+func (b *paperBroker) Symbols() ([]string, error) {
+	return b.symbols, nil
+}
+
+// lots of 0.01 up to 100
+func (b *paperBroker) Specification(symbol string) (*MetaApiSymbolSpecification, error) {
+	if !StringInSlice(symbol, b.symbols) {
+		return nil, fmt.Errorf("unknown symbol %s", symbol)
+	}
+	tickSize, digits := 0.01, 2
+	if defaultContractSize(symbol) == 100000 {
+		tickSize, digits = 0.00001, 5
+		if strings.HasSuffix(symbol, "JPY") {
+			tickSize, digits = 0.001, 3
+		}
+	}
+	// in USD, like the paper profits
+	tickValue := tickSize * defaultContractSize(symbol)
+	if strings.HasPrefix(symbol, "USD") {
+		price, err := b.Price(symbol)
+		if err != nil {
+			return nil, err
+		}
+		tickValue = tickValue / price.Bid
+	}
+	return &MetaApiSymbolSpecification{
+		Symbol:       symbol,
+		TickSize:     tickSize,
+		MinVolume:    0.01,
+		MaxVolume:    100,
+		VolumeStep:   0.01,
+		ContractSize: defaultContractSize(symbol),
+		Digits:       digits,
+		Point:        tickSize,
+		TickValue:    tickValue,
+	}, nil
+}
+
+func (b *paperBroker) Candles(symbol string, timeframe string, limit int) ([]MetaApiCandle, error) {
+	if b.candles == nil {
+		return nil, errors.New("no candles with the random price feed")
+	}
+	return b.candles(symbol, timeframe, limit)
+}
+
+// stop losses are moved by the bot
+func (b *paperBroker) TrailingStopLoss() bool {
+	return false
+}
+
+func (b *paperBroker) AccountInformation() (MetaApiAccountInformation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.tick(); err != nil {
+		return MetaApiAccountInformation{}, err
+	}
+	equity := b.balance
+	for _, position := range b.positions {
+		equity += position.Profit
+	}
+	return MetaApiAccountInformation{
+		Platform:     "paper",
+		Broker:       BrokerPaper,
+		Currency:     "USD",
+		Server:       "paper",
+		Balance:      b.balance,
+		Equity:       equity,
+		FreeMargin:   equity,
+		Leverage:     100,
+		TradeAllowed: true,
+		Name:         "Paper trading",
+		Type:         "ACCOUNT_TRADE_MODE_DEMO",
+	}, nil
+}
+
+// nothing to deploy
+func (b *paperBroker) Deploy() error {
+	return nil
+}
+
+func (b *paperBroker) positionIndex(id *string) int {
+	if id == nil {
+		return -1
+	}
+	for i, position := range b.positions {
+		if position.ID == *id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *paperBroker) orderIndex(id *string) int {
+	if id == nil {
+		return -1
+	}
+	for i, order := range b.orders {
+		if order.ID == *id {
+			return i
+		}
+	}
+	return -1
+}
+
+// profit in USD of a volume closed at a price
+func paperProfit(position *MetaApiPosition, closePrice float64, volume float64) float64 {
+	diff := closePrice - position.OpenPrice
+	if position.Type == "POSITION_TYPE_SELL" {
+		diff = -diff
+	}
+	profit := diff * volume * defaultContractSize(position.Symbol)
+	// quote currency is not USD (USDJPY, USDCHF...)
+	if strings.HasPrefix(position.Symbol, "USD") && closePrice > 0 {
+		profit = profit / closePrice
+	}
+	return math.Round(profit*100) / 100
+}
+
+func paperBetween(positions []MetaApiPosition, from time.Time, to time.Time) []MetaApiPosition {
+	var result []MetaApiPosition
+	for _, position := range positions {
+		t, err := time.Parse(time.RFC3339, position.Time)
+		if err != nil || t.Before(from) || !t.Before(to) {
+			continue
+		}
+		result = append(result, position)
+	}
+	return result
+}
+
+func paperTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func paperTimePtr(t time.Time) *string {
+	s := paperTime(t)
+	return &s
+}
+
+func paperDone(orderId *string, positionId *string) *TradeResponse {
+	return &TradeResponse{
+		NumericCode: ERR_NO_ERROR,
+		StringCode:  "TRADE_RETCODE_DONE",
+		Message:     "Request completed",
+		OrderId:     orderId,
+		PositionId:  positionId,
+	}
+}
+
+func paperRejected(message string) *TradeResponse {
+	return &TradeResponse{
+		NumericCode: ERR_INVALID_TRADE_PARAMETERS,
+		StringCode:  "TRADE_RETCODE_INVALID",
+		Message:     message,
+	}
+}
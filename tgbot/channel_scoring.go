@@ -41,7 +41,7 @@ func (tgBot *TgBot) updateScores(positions []MetaApiPosition) map[string]float64
 		}
 
 		// Appliquer les règles de scoring
-		if pos.isBreakeven() {
+		if pos.isBreakeven(tgBot.specifications) {
 			continue
 		}
 		tpNumber := extractTPFromClientId(pos.ClientID)
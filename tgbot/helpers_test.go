@@ -0,0 +1,168 @@
+package tgbot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"tdlib/redis_client"
+	"testing"
+	"time"
+)
+
+// stubBroker answers the specifications and prices of its maps, the other calls of the Broker fail
+type stubBroker struct {
+	Broker
+	currency       string
+	specifications map[string]MetaApiSymbolSpecification
+	prices         map[string]MetaApiPriceResponse
+}
+
+func (b *stubBroker) Specification(symbol string) (*MetaApiSymbolSpecification, error) {
+	specification, ok := b.specifications[symbol]
+	if !ok {
+		return nil, fmt.Errorf("unknown symbol %s", symbol)
+	}
+	return &specification, nil
+}
+
+func (b *stubBroker) Price(symbol string) (*MetaApiPriceResponse, error) {
+	price, ok := b.prices[symbol]
+	if !ok {
+		return nil, fmt.Errorf("unknown symbol %s", symbol)
+	}
+	return &price, nil
+}
+
+func (b *stubBroker) AccountInformation() (MetaApiAccountInformation, error) {
+	if b.currency == "" {
+		return MetaApiAccountInformation{}, errors.New("no account")
+	}
+	return MetaApiAccountInformation{Currency: b.currency}, nil
+}
+
+// newFakeRedis serves GET, SET, HGET, HSET and HGETALL from memory, enough for the settings read by the bot
+func newFakeRedis(t *testing.T) *redis_client.RedisClient {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &fakeRedis{strings: make(map[string]string), hashes: make(map[string]map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	client := redis.NewClient(&redis.Options{
+		Addr:             listener.Addr().String(),
+		Protocol:         2,
+		DisableIndentity: true,
+		ReadTimeout:      time.Second,
+	})
+	t.Cleanup(func() {
+		client.Close()
+		listener.Close()
+	})
+	return &redis_client.RedisClient{Rdb: client}
+}
+
+type fakeRedis struct {
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) handle(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bulk := func(value string, ok bool) string {
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := s.strings[args[1]]
+		return bulk(value, ok)
+	case "SET":
+		s.strings[args[1]] = args[2]
+		return "+OK\r\n"
+	case "HGET":
+		value, ok := s.hashes[args[1]][args[2]]
+		return bulk(value, ok)
+	case "HSET":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = make(map[string]string)
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			s.hashes[args[1]][args[i]] = args[i+1]
+		}
+		return ":1\r\n"
+	case "HGETALL":
+		hash := s.hashes[args[1]]
+		reply := fmt.Sprintf("*%d\r\n", 2*len(hash))
+		for field, value := range hash {
+			reply += bulk(field, true) + bulk(value, true)
+		}
+		return reply
+	}
+	return "-ERR unknown command " + args[0] + "\r\n"
+}
+
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		args = append(args, string(value[:size]))
+	}
+	return args, nil
+}
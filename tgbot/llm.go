@@ -0,0 +1,267 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"tdlib/config"
+	"time"
+)
+
+// tasks sent to the llm, each one with its own model, temperature and timeout
+const (
+	LLMTaskSignal = "signal"
+	LLMTaskUpdate = "update"
+	LLMTaskTrend  = "trend"
+)
+
+// LLMClient send a conversation to a language model and return its answer
+type LLMClient interface {
+	Complete(ctx context.Context, task string, messages []ChatMessage) (string, error)
+	// answer constrained by a json schema
+	CompleteJSON(ctx context.Context, task string, messages []ChatMessage, schema LLMSchema) (string, error)
+}
+
+// json schema the answer of the model must follow
+type LLMSchema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+// SignalParser read new signals and updates of ongoing signals
+type SignalParser interface {
+	ParseNewMessage(message string, symbols []string) (*TradeRequest, error)
+	ParseUpdateMessage(message string) (*TradeUpdateRequest, error)
+}
+
+type LLMTaskConfig struct {
+	Model       string
+	Temperature float32
+	Timeout     time.Duration
+}
+
+// client of the OpenAi api or of any OpenAi compatible server (llama.cpp, vLLM, Ollama...)
+type openAiCompatibleClient struct {
+	client *openai.Client
+	tasks  map[string]LLMTaskConfig
+	// response format of the tasks whose model rejected the json schema
+	mu          sync.Mutex
+	jsonFormats map[string]openai.ChatCompletionResponseFormatType
+}
+
+func NewLLMClient(appConfig config.AppConfig) LLMClient {
+	clientConfig := openai.DefaultConfig(appConfig.OpenAiToken)
+	if appConfig.LLMBaseURL != "" {
+		clientConfig.BaseURL = appConfig.LLMBaseURL
+	}
+	return &openAiCompatibleClient{
+		client:      openai.NewClientWithConfig(clientConfig),
+		jsonFormats: make(map[string]openai.ChatCompletionResponseFormatType),
+		tasks: map[string]LLMTaskConfig{
+			LLMTaskSignal: {
+				Model:       appConfig.LLMSignalModel,
+				Temperature: appConfig.LLMSignalTemperature,
+				Timeout:     appConfig.LLMSignalTimeout,
+			},
+			LLMTaskUpdate: {
+				Model:       appConfig.LLMUpdateModel,
+				Temperature: appConfig.LLMUpdateTemperature,
+				Timeout:     appConfig.LLMUpdateTimeout,
+			},
+			LLMTaskTrend: {
+				Model:       appConfig.LLMTrendModel,
+				Temperature: appConfig.LLMTrendTemperature,
+				Timeout:     appConfig.LLMTrendTimeout,
+			},
+		},
+	}
+}
+
+func (c *openAiCompatibleClient) Complete(ctx context.Context, task string, messages []ChatMessage) (string, error) {
+	return c.complete(ctx, task, messages, nil)
+}
+
+// the strict json schema is not supported by every model (gpt-3.5-turbo, most local servers) : when it is rejected the
+// task falls back to a json object, then to plain text, the answer is validated by completeJSON anyway
+func (c *openAiCompatibleClient) CompleteJSON(ctx context.Context, task string, messages []ChatMessage, schema LLMSchema) (string, error) {
+	formats := []openai.ChatCompletionResponseFormatType{openai.ChatCompletionResponseFormatTypeJSONSchema,
+		openai.ChatCompletionResponseFormatTypeJSONObject, openai.ChatCompletionResponseFormatTypeText}
+	c.mu.Lock()
+	if format, ok := c.jsonFormats[task]; ok {
+		for len(formats) > 1 && formats[0] != format {
+			formats = formats[1:]
+		}
+	}
+	c.mu.Unlock()
+	for i, format := range formats {
+		var responseFormat *openai.ChatCompletionResponseFormat
+		switch format {
+		case openai.ChatCompletionResponseFormatTypeJSONSchema:
+			responseFormat = &openai.ChatCompletionResponseFormat{
+				Type: format,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:   schema.Name,
+					Schema: schema.Schema,
+					Strict: true,
+				},
+			}
+		case openai.ChatCompletionResponseFormatTypeJSONObject:
+			responseFormat = &openai.ChatCompletionResponseFormat{Type: format}
+		}
+		content, err := c.complete(ctx, task, messages, responseFormat)
+		if err == nil || i == len(formats)-1 || !isResponseFormatRejected(err) {
+			return content, err
+		}
+		log.Printf("Model of the %s task rejected the %s response format, falling back to %s: %v", task, format, formats[i+1], err)
+		c.mu.Lock()
+		c.jsonFormats[task] = formats[i+1]
+		c.mu.Unlock()
+	}
+	return "", errors.New("no response format accepted")
+}
+
+// the request was refused by the server, not lost or timed out
+func isResponseFormatRejected(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == 400 || apiErr.HTTPStatusCode == 422
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == 400 || requestErr.HTTPStatusCode == 422
+	}
+	return false
+}
+
+func (c *openAiCompatibleClient) complete(ctx context.Context, task string, messages []ChatMessage,
+	responseFormat *openai.ChatCompletionResponseFormat) (string, error) {
+	taskConfig, ok := c.tasks[task]
+	if !ok {
+		return "", fmt.Errorf("unknown llm task %s", task)
+	}
+	if taskConfig.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, taskConfig.Timeout)
+		defer cancel()
+	}
+	var chatMessages []openai.ChatCompletionMessage
+	for _, message := range messages {
+		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:          taskConfig.Model,
+		Temperature:    taskConfig.Temperature,
+		Messages:       chatMessages,
+		ResponseFormat: responseFormat,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("empty llm response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// llmSignalParser parse signals with a language model
+type llmSignalParser struct {
+	llm LLMClient
+}
+
+func NewLLMSignalParser(llm LLMClient) SignalParser {
+	return &llmSignalParser{llm: llm}
+}
+
+// answer of a new signal
+var tradeRequestSchema = LLMSchema{
+	Name: "trade_request",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "actionType": {"type": "string", "enum": ["ORDER_TYPE_BUY", "ORDER_TYPE_SELL"]},
+    "symbol": {"type": "string"},
+    "stopLoss": {"type": "number"},
+    "takeProfit1": {"type": "number"},
+    "takeProfit2": {"type": "number"},
+    "takeProfit3": {"type": "number"},
+    "entryZoneMin": {"type": "number"},
+    "entryZoneMax": {"type": "number"},
+    "orderKind": {"type": "string", "enum": ["MARKET", "LIMIT", "STOP"]}
+  },
+  "required": ["actionType", "symbol", "stopLoss", "takeProfit1", "takeProfit2", "takeProfit3", "entryZoneMin", "entryZoneMax", "orderKind"],
+  "additionalProperties": false
+}`),
+}
+
+// update types the llm may answer
+var llmUpdateTypes = []string{"TP1_HIT", "TP2_HIT", "TP3_HIT", "TP4_HIT", "STOPLOSS_HIT", "CLOSE_TRADE", "MODIFY_STOPLOSS",
+	"SL_TO_ENTRY_PRICE", "SECURE_PROFIT", "PARTIAL_CLOSE", "MODIFY_TAKEPROFIT"}
+
+// answer of an update of a signal
+var tradeUpdateRequestSchema = LLMSchema{
+	Name: "trade_update_request",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "updateType": {"type": "string", "enum": ["TP1_HIT", "TP2_HIT", "TP3_HIT", "TP4_HIT", "STOPLOSS_HIT", "CLOSE_TRADE", "MODIFY_STOPLOSS", "SL_TO_ENTRY_PRICE", "SECURE_PROFIT", "PARTIAL_CLOSE", "MODIFY_TAKEPROFIT"]},
+    "value": {"type": ["number", "null"]},
+    "percentage": {"type": ["number", "null"]},
+    "tpNumber": {"type": ["integer", "null"]}
+  },
+  "required": ["updateType", "value", "percentage", "tpNumber"],
+  "additionalProperties": false
+}`),
+}
+
+var jsonFencePattern = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+
+// extract the json object of an answer wrapped in markdown fences or commentary
+func extractJSON(content string) string {
+	if matches := jsonFencePattern.FindStringSubmatch(content); len(matches) > 1 {
+		content = matches[1]
+	}
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return strings.TrimSpace(content)
+	}
+	return content[start : end+1]
+}
+
+// ask a json answer following the schema and decode it in target. when the answer can not be read or is not valid
+// the model is asked once more with the error
+func completeJSON(llm LLMClient, task string, messages []ChatMessage, schema LLMSchema, target interface{},
+	validate func() error) error {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		content, err := llm.CompleteJSON(context.Background(), task, messages, schema)
+		if err != nil {
+			log.Printf("ChatCompletion error: %v", err)
+			return err
+		}
+		log.Printf("Réponse du modèle : %s", content)
+		err = json.Unmarshal([]byte(extractJSON(content)), target)
+		if err == nil {
+			err = validate()
+		}
+		if err == nil {
+			return nil
+		}
+		log.Printf("Invalid llm answer: %v", err)
+		lastErr = err
+		messages = append(messages,
+			ChatMessage{Role: "assistant", Content: content},
+			ChatMessage{Role: "user", Content: fmt.Sprintf("Réponse invalide : %v. Réponds uniquement avec le JSON corrigé.", err)},
+		)
+	}
+	return lastErr
+}
@@ -1,15 +1,12 @@
 package tgbot
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gotd/td/tg"
-	"io/ioutil"
 	"log"
 	"math"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,92 +14,6 @@ import (
 	"unicode"
 )
 
-// Function to place a trade and retrieve the response
-func executeTrade(endpoint string, trade MetaApiTradeRequest, accountId, authToken string) (*TradeResponse, error) {
-	// Convert TradeRequest to JSON
-	tradeJSON, err := json.Marshal(trade)
-	if err != nil {
-		return nil, fmt.Errorf("error marshalling trade request: %v", err)
-	}
-
-	// Define MetaApi endpoint URL
-	apiBaseUrl := endpoint
-	url := fmt.Sprintf(apiBaseUrl+"/users/current/accounts/%s/trade", accountId)
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(tradeJSON))
-	if err != nil {
-		return nil, fmt.Errorf("error creating HTTP request: %v", err)
-	}
-
-	// Set headers
-	req.Header.Set("auth-token", authToken)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	// Execute HTTP request
-	client := &http.Client{Timeout: time.Second * 10}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending trade request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		// response body string
-		reponseBody := ""
-		if resp.Body != nil {
-			bodyBytes, _ := ioutil.ReadAll(resp.Body)
-			reponseBody = string(bodyBytes)
-		}
-		return nil, fmt.Errorf("failed to execute trade, status code: %d body : %s", resp.StatusCode, reponseBody)
-	}
-
-	// Read response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %v", err)
-	}
-
-	// Parse response JSON into TradeResponse struct
-	var tradeResponse TradeResponse
-	err = json.Unmarshal(body, &tradeResponse)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling response: %v", err)
-	}
-
-	// Return the response object
-	return &tradeResponse, nil
-}
-
-func fetchCurrentPrice(symbol, metaApiAccountId, metaApiToken string) (*MetaApiPriceResponse, error) {
-	url := fmt.Sprintf("https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/%s/symbols/%s/current-price?keepSubscription=false", metaApiAccountId, symbol)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", metaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch current price")
-	}
-
-	var priceResponse MetaApiPriceResponse
-	err = json.NewDecoder(resp.Body).Decode(&priceResponse)
-	if err != nil {
-		return nil, err
-	}
-
-	return &priceResponse, nil
-}
-
 type HandleRequestInput struct {
 	MessageId         int
 	Message           string
@@ -110,20 +21,29 @@ type HandleRequestInput struct {
 	ChannelID         int64
 	ChannelName       string
 	ChannelAccessHash int64
+	// forum topic of the message, 0 outside forums
+	TopicId int
+	// set when the signal message has been edited in the channel
+	Edited   bool
+	EditDate int
+	// set on an edit completing a signal with the levels of a later message of the channel
+	Assembled bool
+	// set when the signal messages have been deleted from the channel
+	Deleted    bool
+	DeletedIds []int
+	// name of the only account handling the signal (queued by this account until its market opens), empty for all
+	Account string
 }
 
 func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest, *[]TradeResponse, error) {
 	// Parse the incoming message into a TradeRequest
-	symbols, err := fetchAllSymbols(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+	symbols, err := tgBot.Broker.Symbols()
 	if err != nil {
 		log.Printf("Error fetching symbols: %v", err)
 		tgBot.sendMessage(fmt.Sprintf("❌ Error fetching symbols from MetaApi : %v", err), 0)
 		return nil, nil, err
 	}
 
-	openaiApiKey := tgBot.AppConfig.OpenAiToken
-	metaApiToken := tgBot.AppConfig.MetaApiToken
-	metaApiAccountId := tgBot.AppConfig.MetaApiAccountID
 	channel := tg.Channel{
 		ID:    input.ChannelID,
 		Title: input.ChannelName,
@@ -140,7 +60,7 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 			return nil, nil, errors.New("channel score is negative")
 		}
 
-		tradeRequest, err := tgBot.GptParseNewMessage(input.Message, tgBot.AppConfig.OpenAiToken, symbols)
+		tradeRequest, err := tgBot.SignalParser.ParseNewMessage(input.Message, symbols)
 		if err != nil {
 			log.Printf("Error parsing trade request with Openai: %v", err)
 			// send erreur with log to telegram
@@ -150,7 +70,7 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 
 		// check if reached daily profit
 		todayProfit := tgBot.getTodayProfit()
-		dailyProfitGoal := tgBot.RedisClient.GetDailyProfitGoal()
+		dailyProfitGoal := tgBot.dailyProfitGoal()
 		riskableProfit := -1.0
 		if todayProfit >= dailyProfitGoal {
 			riskableProfit = todayProfit - dailyProfitGoal
@@ -173,7 +93,7 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 		// check symbol trend
 
 		// get current position
-		positions, err := tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, metaApiAccountId, metaApiToken)
+		positions, err := tgBot.Broker.Positions()
 		if err != nil {
 			return nil, nil, err
 		}
@@ -206,18 +126,43 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 		//		return nil, nil, errors.New("max opened trades reached")
 		//	}
 
+		// entry zone given by the channel, before it is widened
+		ladderMode := tgBot.RedisClient.GetChannelLadderMode(int(channel.ID))
+		zoneMin, zoneMax := tradeRequest.EntryZoneMin, tradeRequest.EntryZoneMax
+		if ladderMode != LadderModeOff && (tradeRequest.IsPendingOrder() || zoneMin <= 0 || zoneMax <= zoneMin) {
+			ladderMode = LadderModeOff
+		}
+		if tradeRequest.IsPendingOrder() {
+			// keep the price given by the channel before the entry zone is widened
+			tradeRequest.OpenPrice = tradeRequest.PendingOpenPrice()
+			if tradeRequest.OpenPrice <= 0 {
+				log.Printf("No price for %s order, placing a market order", tradeRequest.OrderKind)
+				tradeRequest.OrderKind = OrderKindMarket
+			}
+		}
 		tradeRequest = setTradeRequestEntryZone(tradeRequest)
-		if !tgBot.RedisClient.IsSymbolExist(tradeRequest.Symbol) {
+		if !tgBot.isSymbolAllowed(tradeRequest.Symbol) {
 			log.Printf("Symbol %s is not allowed", tradeRequest.Symbol)
 			// sen message
 			// Optional. Quoted part of the message to be replied to; 0-1024 characters after entities parsing. The quote must be an exact substring of the message to be replied to, including bold, italic, underline, strikethrough, spoiler, and custom_emoji entities. The message will fail to send if the quote isn't found in the original message.
 			tgBot.sendMessage("❌ Symbol is not allowed", 0)
 			return nil, nil, errors.New("symbol is not allowed")
 		}
-		strategy := tgBot.RedisClient.GetStrategy()
+		// market closed or outside the sessions of the channel
+		if reason := tgBot.tradingHours(int(channel.ID), tradeRequest.Symbol)(time.Now()); reason != "" {
+			return nil, nil, tgBot.holdSignal(input, tradeRequest, reason)
+		}
+		// news event of the currencies of the symbol coming
+		if event := tgBot.newsBlackout(tradeRequest.Symbol); event != nil {
+			log.Printf("Signal blocked by news: %s", event)
+			tgBot.sendMessage(fmt.Sprintf("📰 Signal blocked by news\n🏀 Channel : %s\n📈 %s %s\n📰 %s", channel.Title,
+				tradeRequest.ActionType, tradeRequest.Symbol, event), 0)
+			return nil, nil, fmt.Errorf("news blackout: %s", event)
+		}
+		strategy := tgBot.strategy(tgBot.strategyName())
 
 		// Fetch current price from MetaApi
-		priceResponse, err := fetchCurrentPrice(tradeRequest.Symbol, metaApiAccountId, metaApiToken)
+		priceResponse, err := tgBot.Broker.Price(tradeRequest.Symbol)
 		if err != nil {
 			log.Printf("Error fetching price: %v", err)
 			return nil, nil, err
@@ -235,15 +180,59 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 			log.Println("Unsupported action type")
 			return nil, nil, errors.New("unsupported action type")
 		}
+		if tradeRequest.IsPendingOrder() && !isPendingOrderPriceValid(tradeRequest, currentPrice) {
+			// the price already went through the order price
+			log.Printf("%s %s order price %.5f already reached (%.5f), placing a market order", tradeRequest.ActionType,
+				tradeRequest.OrderKind, tradeRequest.OpenPrice, currentPrice)
+			tradeRequest.OrderKind = OrderKindMarket
+			tradeRequest.OpenPrice = 0
+		}
+		// market orders, the converted ones included : the signal may be received late and the price already gone
+		if !tradeRequest.IsPendingOrder() {
+			minRewardRisk := tgBot.RedisClient.GetChannelMinRewardRisk(int(channel.ID))
+			reason, beyondStopLoss := staleSignalReason(tradeRequest, zoneMin, zoneMax, currentPrice, minRewardRisk)
+			if reason != "" {
+				// no limit price meeting the reward to risk below the ask (above the bid) : skipped, never sent at market
+				limitPrice := staleLimitPrice(tradeRequest, zoneMin, zoneMax, currentPrice, minRewardRisk)
+				if beyondStopLoss || limitPrice <= 0 || tgBot.RedisClient.GetChannelStaleAction(int(channel.ID)) != StaleActionLimit {
+					log.Printf("Stale signal skipped: %s", reason)
+					tgBot.sendMessage(fmt.Sprintf("❌ Signal skipped, entry missed\n🏀 Channel : %s\n📈 %s %s\n⚠️ Reason : %s",
+						channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, reason), 0)
+					return nil, nil, fmt.Errorf("stale signal: %s", reason)
+				}
+				log.Printf("Stale signal parked as limit at %.5f: %s", limitPrice, reason)
+				tgBot.sendMessage(fmt.Sprintf("⏳ Entry missed, parked as LIMIT at %.5f\n🏀 Channel : %s\n📈 %s %s\n⚠️ Reason : %s",
+					limitPrice, channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, reason), 0)
+				tradeRequest.OrderKind = OrderKindLimit
+				tradeRequest.OpenPrice = limitPrice
+				ladderMode = LadderModeOff
+			}
+		}
 
+		// a pending order risks the distance from its order price to the stop loss
+		entryPrice := currentPrice
+		if tradeRequest.IsPendingOrder() && tradeRequest.OpenPrice > 0 {
+			entryPrice = tradeRequest.OpenPrice
+		}
 		// pass trade request to risk management to validate or reject the trade
 		balance := tgBot.getAccountBalance()
-		volume := tgBot.GetTradingDynamicVolume(tradeRequest, currentPrice, balance, int(input.ChannelID), riskableProfit)
-		// do not trade if volume inferior to 0.01
-		if volume > 0 && volume < 0.01 {
-			volume = 0.01
-		}
+		volume := tgBot.GetTradingDynamicVolume(tradeRequest, entryPrice, balance, int(input.ChannelID), riskableProfit)
+		volume = tgBot.capVolume(volume)
 		tradeRequest.Volume = volume
+		// lots the broker accepts
+		minVolume, maxVolume, volumeStep := 0.01, 0.0, 0.01
+		if specification := tgBot.specifications.get(tradeRequest.Symbol); specification == nil {
+			log.Printf("No %s specification, lots of 0.01", tradeRequest.Symbol)
+		} else {
+			minVolume, maxVolume, volumeStep = specification.MinVolume, specification.MaxVolume, specification.VolumeStep
+		}
+		// never raised to the broker minimum, it would risk more than the risk percentage
+		if volume <= 0 || volume < minVolume {
+			log.Printf("Volume %.2f under the %s minimum %.2f", volume, tradeRequest.Symbol, minVolume)
+			tgBot.sendMessage(fmt.Sprintf("❌ Signal rejected\n🏀 Channel : %s\n📈 %s %s\n⚠️ Reason : risk sized volume %.2f under the broker minimum %.2f",
+				channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, volume, minVolume), 0)
+			return nil, nil, errors.New("volume under the broker minimum")
+		}
 
 		// avoid dboule trade
 		if tgBot.RedisClient.IsTradeKeyExist(tradeRequest.GenerateTradeRequestKey()) {
@@ -260,7 +249,7 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 			return nil, nil, errors.New("trade already exist")
 		}
 		// check if ongoing trades
-		if tgBot.CheckIfTradeCanFit(positions, *tradeRequest, currentPrice) {
+		if tgBot.CheckIfTradeCanFit(positions, *tradeRequest, entryPrice) {
 			log.Printf("Trade can fit")
 		} else {
 			log.Printf("Trade can't fit")
@@ -281,187 +270,119 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 		}
 
 		// Proceed with the trade
-		metaApiRequests := ConvertToMetaApiTradeRequests(*tradeRequest, strategy)
+		// TP legs of the strategy
+		legs := strategy.legsFor(tradeRequest)
+		metaApiRequests := ConvertToMetaApiTradeRequests(*tradeRequest, legs, tgBot.AppConfig.PendingOrderExpiration)
 		// trade response list
 		var tradeResponses []TradeResponse
 		tradeSuccess := false
-		remainingVolume := tradeRequest.Volume
-		v1 := 0.0
-		v2 := 0.0
-		v3 := 0.0
+		// split of the volume between the TP legs, in lots the broker accepts
+		allocationProfile := tgBot.allocationProfile(int(channel.ID), strategy.Name)
+		legVolumes := splitVolume(tradeRequest.Volume, strategy.legWeights(legs, allocationProfile), minVolume, maxVolume,
+			volumeStep)
+		placedVolume := 0.0
+		for _, legVolume := range legVolumes {
+			placedVolume += legVolume
+		}
+		if placedVolume == 0 {
+			log.Printf("Volume %.2f under the %s minimum %.2f", tradeRequest.Volume, tradeRequest.Symbol, minVolume)
+			tgBot.sendMessage(fmt.Sprintf("❌ Trade not placed\n🏀 Channel : %s\n📈 %s %s\n❌ Error: volume %.2f under the broker minimum %.2f",
+				channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.Volume, minVolume), 0)
+			return nil, nil, errors.New("volume under the broker minimum")
+		}
 		for i, metaApiRequest := range metaApiRequests {
-			if strategy == "TP1" {
-				if i > 0 {
-					break
-				}
-			} else if strategy == "TP2" {
-				if i > 1 {
-					break
-				}
-			} else if strategy == "3TP" {
-				if i > 2 {
-					break
-				}
-			}
-			takeProfit := 0.0
-			metaApiTradeVolume := remainingVolume
-			if i == 0 {
-				takeProfit = tradeRequest.TakeProfit1
-				// tp1 should be 60% of the volume
-				if len(metaApiRequests) == 1 {
-					metaApiTradeVolume = tradeRequest.Volume
-				} else {
-					metaApiTradeVolume = tradeRequest.Volume * 0.7
-				}
-				remainingVolume = tradeRequest.Volume - metaApiTradeVolume
-				v1 = metaApiTradeVolume
-			} else if i == 1 {
-				takeProfit = tradeRequest.TakeProfit2
-				// tp2 should be 40% of the volume
-				if len(metaApiRequests) == 2 {
-					metaApiTradeVolume = tradeRequest.Volume * 0.3
-				} else if len(metaApiRequests) == 3 {
-					metaApiTradeVolume = tradeRequest.Volume * 0.2
-				}
-				remainingVolume = remainingVolume - metaApiTradeVolume
-				v2 = metaApiTradeVolume
-			} else if i == 2 {
-				takeProfit = tradeRequest.TakeProfit3
-				// tp3 should be 10% of the volume
-				metaApiTradeVolume = remainingVolume
-				v3 = metaApiTradeVolume
-			}
-			tpNumber := i + 1
-			// 2 digits
-			// if volume is less than 0.01 skip trade²
-			if metaApiTradeVolume <= 0.01 {
-				// set minimum volume to take non risky trade
-				metaApiTradeVolume = 0.01
+			tpNumber := legs[i]
+			takeProfit := tradeRequest.TakeProfit(tpNumber)
+			metaApiTradeVolume := legVolumes[i]
+			if metaApiTradeVolume == 0 {
+				// too small to be split between every leg
+				log.Printf("TP%d not placed, volume %.2f too small for %d legs (%s)", tpNumber, tradeRequest.Volume, len(legs),
+					allocationProfile)
+				continue
 			}
-			metaApiTradeVolume = math.Floor(metaApiTradeVolume*100) / 100
-
 			metaApiRequest.Volume = &metaApiTradeVolume
 			// concat channel id and channel initial
 			chanelInitials := GenerateInitials(channel.Title) + "@" + strconv.Itoa(int(channel.ID))
-			clientId := fmt.Sprintf("%s_%s_%s", chanelInitials, strconv.Itoa(int(messageId)), "TP"+strconv.Itoa(i+1))
+			clientId := fmt.Sprintf("%s_%s_%s", chanelInitials, strconv.Itoa(int(messageId)), "TP"+strconv.Itoa(tpNumber))
 			// channelID_messageId_TP1
 			metaApiRequest.ClientID = &clientId
-			if tpNumber == 0 {
-
-			}
-			if takeProfit == 0 {
-			}
-			if v1 == v2 && v2 == v3 {
+			// threshold trailing done by the broker
+			entryPrice := currentPrice
+			if tradeRequest.IsPendingOrder() {
+				entryPrice = tradeRequest.OpenPrice
 			}
-
-			// try at least three time
-			for j := 0; j < 3; j++ {
-				trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, metaApiAccountId, metaApiToken)
-				if err != nil {
-					log.Printf("Error placing trade: %v", err)
-					if j == 2 {
-						// generate error message with reason
-						/**
-						❌ Trade not placed
-						🏀 Channel : @channel
-						 Buy EURUSD
-						 Entry Price: 1.1234
-						 Stop Loss: 1.1200
-						 Take Profit: 1.1300
-						 ❌ Error: Invalid volume
-						*/
-						errorReason := fmt.Sprintf("Error request %v", err)
-						messageText := fmt.Sprintf("❌ Trade not placed\n"+
-							"🏀 Channel : %s\n %s %s\n  Stop Loss: %.2f\n TP%s: %.2f\n❌ Error: %s",
-							channel.Title, tradeRequest.ActionType, tradeRequest.Symbol,
-							tradeRequest.StopLoss, strconv.Itoa(tpNumber), takeProfit, errorReason)
-						_, err := tgBot.sendMessage(messageText, 0)
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-						}
-					}
-					continue
+			metaApiRequest.TrailingStopLoss = tgBot.legTrailingStopLoss(int(channel.ID), tradeRequest, tpNumber, entryPrice)
+			if ladderMode != LadderModeOff {
+				// limit orders spread across the entry zone instead of a market order
+				if tgBot.placeLadderLeg(channel.Title, tradeRequest, metaApiRequest, clientId, zoneMin, zoneMax, currentPrice,
+					tpNumber, ladderMode) > 0 {
+					tradeSuccess = true
 				}
-				errorTrade := HandleTradeError(trade.NumericCode)
-				if tradeErr, ok := errorTrade.(*TradeError); ok {
-					if tradeErr.Type == Success {
-						if !tradeSuccess {
-							tradeSuccess = true
-						}
-						log.Printf("Trade placed successfully: %v", trade)
-						// send fancy bot message with emoji to  inform usser the trade was placed with additional info about the provenance (message , channel )
-						// ad next line separation also add also values info stopLoss takeprofit etc
-						// example
-						/**
-						Trade placed
-						⛏ ID : 1234
-						🏀 Channel : @channel
-						📈 Buy EURUSD
-						🔴 Stop Loss: 1.1200
-						🟢 Take Profit: 1.1300
-						*/
-						messageText := fmt.Sprintf("Trade placed\n⛏ ID : %s\n🏀 Channel : %s\n📈 %s %s\n🔴 SL: %.2f\n🟢 TP%s: %.2f",
-							clientId, channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.StopLoss, strconv.Itoa(tpNumber), takeProfit)
-						m, err := tgBot.sendMessage(messageText, 0)
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-						}
-						tgBot.RedisClient.SetPositionMessageId(*trade.PositionId, m.MessageId)
-						break
-					} else {
-						// if last retry send error message
-						if j == 2 {
-							// generate error message with reason
-							/**
-							❌ Trade not placed
-							🏀 Channel : @channel
-							 Buy EURUSD
-							 Entry Price: 1.1234
-							 Stop Loss: 1.1200
-							 Take Profit: 1.1300
-							 ❌ Error: Invalid volume
-							*/
-							messageText := fmt.Sprintf("❌ Trade not placed\n"+
-								"🏀 Channel : %s\n %s %s\n  Stop Loss: %.2f\n TP%s: %.2f\n❌ Error: %s",
-								channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.StopLoss,
-								strconv.Itoa(tpNumber), takeProfit, tradeErr.Description)
-							_, err := tgBot.sendMessage(messageText, 0)
-							if err != nil {
-								log.Printf("Error sending message: %v", err)
-								return nil, nil, err
-							}
-						}
-						continue
-					}
-				} else {
-					if j == 2 {
-						// generate error message with reason
-						/**
-						❌ Trade not placed
-						🏀 Channel : @channel
-						 Entry Price: 1.1234
-						 Stop Loss: 1.1200
-						 Take Profit: 1.1300
-						 ❌ Error: Invalid volume
-						*/
-						errorReason := fmt.Sprintf("Invalid code returned %v", trade)
-						messageText := fmt.Sprintf("❌ Trade not placed\n🏀"+
-							" Channel : %s\n %s %s\n  Stop Loss: %.2f\n TP%s: %.2f\n❌ Error: %s",
-							channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.StopLoss,
-							strconv.Itoa(tpNumber), takeProfit, errorReason)
-						_, err := tgBot.sendMessage(messageText, 0)
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-							return nil, nil, err
-						}
-					}
+				continue
+			}
 
+			trade, err := tgBot.Executor.Execute(metaApiRequest)
+			if err != nil {
+				log.Printf("Error placing trade: %v", err)
+				// generate error message with reason
+				/**
+				❌ Trade not placed
+				🏀 Channel : @channel
+				 Buy EURUSD
+				 Entry Price: 1.1234
+				 Stop Loss: 1.1200
+				 Take Profit: 1.1300
+				 ❌ Error: Invalid volume
+				*/
+				messageText := fmt.Sprintf("❌ Trade not placed\n"+
+					"🏀 Channel : %s\n %s %s\n  Stop Loss: %.2f\n TP%s: %.2f\n❌ Error: %s",
+					channel.Title, tradeRequest.ActionType, tradeRequest.Symbol,
+					tradeRequest.StopLoss, strconv.Itoa(tpNumber), takeProfit, tradeErrorReason(err))
+				_, errM := tgBot.sendMessage(messageText, 0)
+				if errM != nil {
+					log.Printf("Error sending message: %v", errM)
 				}
+				continue
+			}
+			if !tradeSuccess {
+				tradeSuccess = true
+			}
+			// send fancy bot message with emoji to  inform usser the trade was placed with additional info about the provenance (message , channel )
+			// ad next line separation also add also values info stopLoss takeprofit etc
+			// example
+			/**
+			Trade placed
+			⛏ ID : 1234
+			🏀 Channel : @channel
+			📈 Buy EURUSD
+			🔴 Stop Loss: 1.1200
+			🟢 Take Profit: 1.1300
+			*/
+			messageText := fmt.Sprintf("Trade placed\n⛏ ID : %s\n🏀 Channel : %s\n📈 %s %s\n🔴 SL: %.2f\n🟢 TP%s: %.2f",
+				clientId, channel.Title, tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.StopLoss, strconv.Itoa(tpNumber), takeProfit)
+			if tradeRequest.IsPendingOrder() {
+				messageText = fmt.Sprintf("%s\n⏳ %s order at %.2f", messageText, tradeRequest.OrderKind, tradeRequest.OpenPrice)
+			}
+			m, errM := tgBot.sendMessage(messageText, 0)
+			if errM != nil {
+				log.Printf("Error sending message: %v", errM)
+			}
+			// a pending order has no position yet, the position opened from it keeps the order id
+			positionId := trade.PositionId
+			if positionId == nil {
+				positionId = trade.OrderId
+			}
+			if m != nil && positionId != nil {
+				tgBot.RedisClient.SetPositionMessageId(*positionId, m.MessageId)
+			}
+			if positionId != nil && metaApiRequest.TrailingStopLoss != nil {
+				tgBot.RedisClient.SetPositionTrailing(*positionId, TrailingSideBroker, 0)
 			}
 		}
 		if tradeSuccess {
 			// save trade request
 			tradeRequest.MessageId = &messageId
+			tradeRequest.Strategy = strategy.Name
 			tradeRbytes, errJ := json.Marshal(tradeRequest)
 			if errJ == nil {
 				tgBot.RedisClient.SetTradeRequest(int64(messageId), tradeRbytes)
@@ -478,101 +399,77 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 		}
 	} else {
 		//here its an update of a given order so we need to fetch the order and update it
-		tradeUpdate, err := GptParseUpdateMessage(message, openaiApiKey)
+		tradeUpdate, err := tgBot.SignalParser.ParseUpdateMessage(message)
 		if err != nil {
 			log.Printf("Error parsing trade request: %v", err)
 			// send erreur with log to telegram
 			tgBot.sendMessage(fmt.Sprintf("❌ Error parsing trade request: %v", err), 0)
 			return nil, nil, err
 		}
-		positions, err := tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, metaApiAccountId, metaApiToken)
+		currentMessagePositions, err := tgBot.messagePositions(channel.ID, *parentRequest.MessageId)
+		if err != nil {
+			return nil, nil, err
+		}
+		// limit and stop orders of the signal not filled yet
+		currentMessageOrders, err := tgBot.messageOrders(channel.ID, *parentRequest.MessageId)
 		if err != nil {
 			return nil, nil, err
 		}
-		currentMessagePositions := getPositionsByMessageId(positions, *parentRequest.MessageId)
 		var tradeResponses []TradeResponse
-		if tradeUpdate.UpdateType == "TP1_HIT" {
-			// do breakeven
-			//	if tp1 hit modify SL to tp 1 value on all other TP
-			if parentRequest.TakeProfit1 == -1 {
-				// manual close tp1
-				positionTP1 := getPositionByMessageIdAndTP(currentMessagePositions, *parentRequest.MessageId, 1)
-				if positionTP1 != nil && positionTP1.TakeProfit == 0 {
-					customPositions := []MetaApiPosition{*positionTP1}
-					_ = tgBot.doCloseTrade(customPositions)
-					positions, err = tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, metaApiAccountId, metaApiToken)
-					if err != nil {
-						return nil, nil, err
-					}
-					currentMessagePositions = getPositionsByMessageId(positions, *parentRequest.MessageId)
-				}
-
-			}
-			if tgBot.RedisClient.IsBreakevenEnabled(int(channel.ID)) {
-				tgBot.doBreakeven(currentMessagePositions, 1)
-			}
-
-		} else if tradeUpdate.UpdateType == "TP2_HIT" {
-			// do breakeven
-			//	if tp1 hit modify SL to tp 1 value on all other TP
-			if parentRequest.TakeProfit2 == -1 {
-				// manual close tp1
-				positionTP1 := getPositionByMessageIdAndTP(currentMessagePositions, *parentRequest.MessageId, 2)
-				if positionTP1 != nil && positionTP1.TakeProfit == 0 {
-					customPositions := []MetaApiPosition{*positionTP1}
-					_ = tgBot.doCloseTrade(customPositions)
-					positions, err = tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, metaApiAccountId, metaApiToken)
-					if err != nil {
-						return nil, nil, err
-					}
-					currentMessagePositions = getPositionsByMessageId(positions, *parentRequest.MessageId)
-				}
-
-			}
-			if tgBot.RedisClient.IsBreakevenEnabled(int(channel.ID)) {
-				tgBot.doBreakeven(currentMessagePositions, 2)
+		switch tradeUpdate.UpdateType {
+		case "TP1_HIT", "TP2_HIT", "TP3_HIT", "TP4_HIT":
+			// the signal went without us, orders left are cancelled then breakeven
+			tgBot.doCancelOrders(currentMessageOrders, tradeUpdate.UpdateType)
+			tpNumber := int(tradeUpdate.UpdateType[2] - '0')
+			_, err = tgBot.doTakeProfitHit(channel.ID, parentRequest, currentMessagePositions, tpNumber)
+		case "STOPLOSS_HIT":
+			// close the legs left opened
+			tgBot.doCancelOrders(currentMessageOrders, tradeUpdate.UpdateType)
+			err = tgBot.doStopLossHit(currentMessagePositions)
+		case "CLOSE_TRADE":
+			// close all positions
+			tgBot.doCancelOrders(currentMessageOrders, tradeUpdate.UpdateType)
+			err = tgBot.doCloseTrade(currentMessagePositions)
+		case "MODIFY_STOPLOSS":
+			// modify stop loss to the value given
+			if tradeUpdate.Value == nil {
+				err = errors.New("no stop loss given")
+				break
 			}
-		} else if tradeUpdate.UpdateType == "TP3_HIT" {
-			// do breakeven
-			//	if tp1 hit modify SL to tp 1 value on all other TP
-			if parentRequest.TakeProfit3 == -1 {
-				// manual close tp1
-				positionTP1 := getPositionByMessageIdAndTP(currentMessagePositions, *parentRequest.MessageId, 3)
-				if positionTP1 != nil && positionTP1.TakeProfit == 0 {
-					customPositions := []MetaApiPosition{*positionTP1}
-					_ = tgBot.doCloseTrade(customPositions)
-					positions, err = tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, metaApiAccountId, metaApiToken)
-					if err != nil {
-						return nil, nil, err
-					}
-					currentMessagePositions = getPositionsByMessageId(positions, *parentRequest.MessageId)
-				}
-
+			err = tgBot.doModifyOrders(currentMessageOrders, *tradeUpdate.Value, 0, 0)
+			if len(currentMessagePositions) > 0 {
+				err = errors.Join(err, tgBot.doModifyStopLoss(parentRequest, tradeUpdate, currentMessagePositions))
 			}
-			if tgBot.RedisClient.IsBreakevenEnabled(int(channel.ID)) {
-				tgBot.doBreakeven(currentMessagePositions, 3)
+		case "MODIFY_TAKEPROFIT":
+			if tradeUpdate.Value == nil {
+				err = errors.New("no take profit given")
+				break
 			}
-
-		} else if tradeUpdate.UpdateType == "CLOSE_TRADE" {
-			// close all positions
-			errClodeTrade := tgBot.doCloseTrade(currentMessagePositions)
-			if errClodeTrade != nil {
-
+			tpNumber := 0
+			if tradeUpdate.TpNumber != nil {
+				tpNumber = *tradeUpdate.TpNumber
 			}
-		} else if tradeUpdate.UpdateType == "MODIFY_STOPLOSS" {
-			// modify stop loss to the value given
-			errModifyStopLoss := tgBot.doModifyStopLoss(parentRequest, tradeUpdate, currentMessagePositions, metaApiAccountId, metaApiToken)
-			if errModifyStopLoss != nil {
-
+			err = tgBot.doModifyOrders(currentMessageOrders, 0, *tradeUpdate.Value, tpNumber)
+			if len(currentMessagePositions) > 0 {
+				err = errors.Join(err, tgBot.doModifyTakeProfit(tradeUpdate, currentMessagePositions))
 			}
-
-		} else if tradeUpdate.UpdateType == "SL_TO_ENTRY_PRICE" {
-			// modify stop loss to the value given
-			errSlToEntryPrice := tgBot.doSlToEntryPrice(currentMessagePositions)
-			if errSlToEntryPrice != nil {
-
+		case "SL_TO_ENTRY_PRICE":
+			err = tgBot.doSlToEntryPrice(currentMessagePositions)
+		case "SECURE_PROFIT":
+			// partial close then breakeven
+			err = tgBot.doSecureProfit(channel.ID, *parentRequest.MessageId, currentMessagePositions)
+		case "PARTIAL_CLOSE":
+			if tradeUpdate.Percentage == nil {
+				err = errors.New("no percentage given for partial close")
+				break
 			}
-
+			err = tgBot.doPartialClose(currentMessagePositions, *tradeUpdate.Percentage)
+		default:
+			err = fmt.Errorf("unknown update type %s", tradeUpdate.UpdateType)
+		}
+		if err != nil {
+			log.Printf("Error handling %s update: %v", tradeUpdate.UpdateType, err)
+			tgBot.sendMessage(fmt.Sprintf("❌ Error handling %s update: %v", tradeUpdate.UpdateType, err), 0)
 		}
 		//get list active positions
 
@@ -581,26 +478,28 @@ func (tgBot *TgBot) HandleTradeRequest(input HandleRequestInput) (*TradeRequest,
 	return nil, nil, errors.New("trade not placed")
 }
 
-func (tgBot *TgBot) CheckIfTradeCanFit(positions []MetaApiPosition, request TradeRequest, currentPrice float64) bool {
+func (tgBot *TgBot) CheckIfTradeCanFit(positions []MetaApiPosition, request TradeRequest, entryPrice float64) bool {
 	// calculate total loss possible on all trades
 	totalLoss := 0.0
 	for _, position := range positions {
-		stopLoss := position.StopLoss
-		entryPrice := position.OpenPrice
-		volume := position.Volume
-		// stopLoss distance in pips
-		pipsToStopLoss := calculatePips(entryPrice, stopLoss, position.Symbol)
-		// use absolute value
-		if pipsToStopLoss < 0 {
-			pipsToStopLoss = pipsToStopLoss * -1
-		}
-		// calculate loss
-		loss := pipsToStopLoss * volume
-		totalLoss += loss
+		totalLoss += position.riskedLoss(tgBot.specifications)
+	}
+	// pending orders (limits, ladder steps, parked signals) risk their loss once filled
+	orders, err := tgBot.Broker.Orders()
+	if err != nil {
+		log.Printf("Error fetching orders: %v", err)
+		return false
+	}
+	for _, order := range orders {
+		totalLoss += order.riskedLoss(tgBot.specifications)
 	}
 	// get trading dynamic volume
 	// get possible loss on the trade request
-	possibleLoss := tgBot.GetTradeRequestPossibleLoss(&request, currentPrice)
+	possibleLoss, err := tgBot.GetTradeRequestPossibleLoss(&request, entryPrice)
+	if err != nil {
+		log.Printf("Error valuing the possible loss: %v", err)
+		return false
+	}
 	// check if possible loss is less than total loss
 	totalLoss = totalLoss + possibleLoss
 	lossLimitamount := tgBot.getDailyLossLimitAmount()
@@ -616,7 +515,7 @@ func (tgBot *TgBot) CountSimilarTrades(positions []MetaApiPosition, request Trad
 	similarPositions := []MetaApiPosition{}
 	for _, position := range positions {
 		// count only tp1 positions
-		if position.isBreakevenSetted() {
+		if position.isBreakevenSetted(tgBot.specifications) {
 			// do not count breakeven positions
 			continue
 		}
@@ -652,7 +551,7 @@ func (tgBot *TgBot) doSlToEntryPrice(positions []MetaApiPosition) error {
 	// generate a telegram response for the bot
 	botMessage := fmt.Sprintf("✅ SL to Entry Price 🎉")
 	for _, position := range positions {
-		newStopLoss := calculateNewStopLossPriceForBreakeven(position.OpenPrice, position.Type, position.Symbol)
+		newStopLoss := calculateNewStopLossPriceForBreakeven(tgBot.specifications, position.OpenPrice, position.Type, position.Symbol)
 		positionMessageId := tgBot.RedisClient.GetPositionMessageId(position.ID)
 		metaApiRequest := MetaApiTradeRequest{
 			ActionType: "POSITION_MODIFY",
@@ -661,62 +560,30 @@ func (tgBot *TgBot) doSlToEntryPrice(positions []MetaApiPosition) error {
 			TakeProfit: &position.TakeProfit,
 		}
 		// place all positions stop loss to their open price
-		for j := 0; j < 3; j++ {
-			trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, tgBot.AppConfig.MetaApiAccountID,
-				tgBot.AppConfig.MetaApiToken)
-			//
-			if err != nil {
-				log.Printf("Error placing trade: %v", err)
-				if j == 2 {
-					// send parsed error message from bot
-					// generate error message with reason
-					botErrorMessage := fmt.Sprintf("❌ Failed moving SL to entry price")
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", err))
-					tgBot.sendMessage(botMessage, int(positionMessageId))
-				}
-				continue
-			}
-			errorTrade := HandleTradeError(trade.NumericCode)
-			if tradeErr, ok := errorTrade.(*TradeError); ok {
-				if tradeErr.Type == Success {
-					if !tradeSuccess {
-						tradeSuccess = true
-					}
-					if tradeErr.Type == Success {
-						log.Printf("Trade update placed successfully: %v", trade)
-						// append message to inform user that we moved the stop loss to the entry price of this current tp
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Moving SL to entry price"))
-						// append with values on next  line
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, position.OpenPrice))
-						// get message to reply to
-						// get chat message and reply to it
-						sendMessage, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if sendMessage != nil {
-
-						}
-						if errM != nil {
-							return errM
-						}
-						break
-					} else {
-						time.Sleep(150 * time.Millisecond)
-						continue
-					}
-				} else {
-					// if last retry send error message
-					if j == 2 {
-						botErrorMessage := fmt.Sprintf("❌ Failed moving SL to entry price")
-						botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-							fmt.Sprintf("❌ Error: %s", tradeErr.Description))
-						tgBot.sendMessage(botMessage, int(positionMessageId))
-					}
-					time.Sleep(150 * time.Millisecond)
-					continue
-				}
-			}
+		trade, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error placing trade: %v", err)
+			// send parsed error message from bot
+			botErrorMessage := fmt.Sprintf("❌ Failed moving SL to entry price")
+			botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
+				fmt.Sprintf("❌ Error: %s", tradeErrorReason(err)))
+			tgBot.sendMessage(botErrorMessage, int(positionMessageId))
+			continue
+		}
+		if !tradeSuccess {
+			tradeSuccess = true
+		}
+		log.Printf("Trade update placed successfully: %v", trade)
+		// append message to inform user that we moved the stop loss to the entry price of this current tp
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Moving SL to entry price"))
+		// append with values on next  line
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, position.OpenPrice))
+		// get chat message and reply to it
+		_, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
+		if errM != nil {
+			return errM
 		}
 	}
 	return nil
@@ -735,94 +602,43 @@ func (tgBot *TgBot) doBreakeven(currentMessagePositions []MetaApiPosition, tpHit
 		// safe
 		entryPrice = position.OpenPrice
 		// add a litle margin
-		newStopLoss := calculateNewStopLossPriceForBreakeven(position.OpenPrice, position.Type, position.Symbol)
+		newStopLoss := calculateNewStopLossPriceForBreakeven(tgBot.specifications, position.OpenPrice, position.Type, position.Symbol)
 		positionMessageId := tgBot.RedisClient.GetPositionMessageId(position.ID)
-		_ = TrailingStopLoss{
-			Distance: &DistanceTrailingStopLoss{
-				Distance: 0.1,
-				Units:    "RELATIVE_PRICE",
-			},
-		}
 		metaApiRequest := MetaApiTradeRequest{
 			ActionType: "POSITION_MODIFY",
 			StopLoss:   &newStopLoss,
 			PositionID: &position.ID,
 			TakeProfit: &position.TakeProfit,
-			//TrailingStopLoss: &trailingStopLoss,
 		}
 		curentTp := extractTPFromClientId(position.ClientID)
 		// place all positions stop loss to their open price
-		for j := 0; j < 3; j++ {
-			trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, tgBot.AppConfig.MetaApiAccountID,
-				tgBot.AppConfig.MetaApiToken)
-			//
-			if err != nil {
-				log.Printf("Error placing trade: %v", err)
-				if j == 2 {
-					// send parsed error message from bot
-					// generate error message with reason
-					botErrorMessage := fmt.Sprintf("❌ Failed moving TP%d SL to entry price", curentTp)
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", err))
-					tgBot.sendMessage(botErrorMessage, int(positionMessageId))
-				}
-				continue
-			}
-			errorTrade := HandleTradeError(trade.NumericCode)
-			if tradeErr, ok := errorTrade.(*TradeError); ok {
-				if tradeErr.Type == Success {
-					if !tradeSuccess {
-						tradeSuccess = true
-					}
-					if tradeErr.Type == Success {
-						log.Printf("Trade update placed successfully: %v", trade)
-						// append message to inform user that we moved the stop loss to the entry price of this current tp
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Moving TP%d SL to entry price", curentTp))
-						// append with values on next  line
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, entryPrice))
-						// get message to reply to
-						// get chat message and reply to it
-						sendMessage, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if errM != nil {
-							return errM
-						}
-						if sendMessage != nil {
-
-						}
-						break
-					} else {
-						time.Sleep(150 * time.Millisecond)
-						continue
-					}
-				} else {
-					// if last retry send error message
-					if j == 2 {
-						botErrorMessage := fmt.Sprintf("❌ Failed moving TP%d SL to entry price", curentTp)
-						botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-							fmt.Sprintf("❌ Error: %s", tradeErr.Description))
-						messageT, err := tgBot.sendMessage(botErrorMessage, int(positionMessageId))
-						if messageT != nil {
-
-						}
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-						}
-						break
-					}
-					time.Sleep(150 * time.Millisecond)
-					continue
-				}
-			} else {
-				if j == 2 {
-					botErrorMessage := fmt.Sprintf("❌ Failed moving TP%d SL to entry price", curentTp)
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", "Invalid code returned"))
-					tgBot.sendMessage(botErrorMessage, int(positionMessageId))
-				}
-
+		trade, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error placing trade: %v", err)
+			// send parsed error message from bot
+			botErrorMessage := fmt.Sprintf("❌ Failed moving TP%d SL to entry price", curentTp)
+			botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
+				fmt.Sprintf("❌ Error: %s", tradeErrorReason(err)))
+			_, errM := tgBot.sendMessage(botErrorMessage, int(positionMessageId))
+			if errM != nil {
+				log.Printf("Error sending message: %v", errM)
 			}
+			continue
+		}
+		if !tradeSuccess {
+			tradeSuccess = true
+		}
+		log.Printf("Trade update placed successfully: %v", trade)
+		// append message to inform user that we moved the stop loss to the entry price of this current tp
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Moving TP%d SL to entry price", curentTp))
+		// append with values on next  line
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, entryPrice))
+		// get chat message and reply to it
+		_, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
+		if errM != nil {
+			return errM
 		}
 
 	}
@@ -831,7 +647,7 @@ func (tgBot *TgBot) doBreakeven(currentMessagePositions []MetaApiPosition, tpHit
 
 // automatic breakeven triggered by cron job
 
-func (tgBot *TgBot) doModifyStopLoss(request *TradeRequest, update *TradeUpdateRequest, positions []MetaApiPosition, id string, token string) error {
+func (tgBot *TgBot) doModifyStopLoss(request *TradeRequest, update *TradeUpdateRequest, positions []MetaApiPosition) error {
 	// get entry price base on positions
 	tradeSuccess := false
 	// generate a telegram response for the bot
@@ -850,69 +666,30 @@ func (tgBot *TgBot) doModifyStopLoss(request *TradeRequest, update *TradeUpdateR
 			TakeProfit: &position.TakeProfit,
 		}
 		// place all positions stop loss to their open price
-		for j := 0; j < 3; j++ {
-			trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, tgBot.AppConfig.MetaApiAccountID,
-				tgBot.AppConfig.MetaApiToken)
-			//
-			if err != nil {
-				log.Printf("Error placing trade: %v", err)
-				if j == 2 {
-					// send parsed error message from bot
-					// generate error message with reason
-					botErrorMessage := fmt.Sprintf("❌ Failed moving stop loss")
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", err))
-					tgBot.sendMessage(botMessage, int(positionMessageId))
-				}
-				continue
-			}
-			errorTrade := HandleTradeError(trade.NumericCode)
-			if tradeErr, ok := errorTrade.(*TradeError); ok {
-				if tradeErr.Type == Success {
-					if !tradeSuccess {
-						tradeSuccess = true
-					}
-					if tradeErr.Type == Success {
-						log.Printf("Trade update placed successfully: %v", trade)
-						// append message to inform user that we moved the stop loss to the entry price of this current tp
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Moving SL to %.2f", *update.Value))
-						// append with values on next  line
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, *update.Value))
-						// get message to reply to
-						// get chat message and reply to it
-						sendMessage, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if errM != nil {
-							return errM
-						}
-						if sendMessage != nil {
-
-						}
-						break
-					} else {
-						time.Sleep(150 * time.Millisecond)
-						continue
-					}
-				} else {
-					// if last retry send error message
-					if j == 2 {
-						botErrorMessage := fmt.Sprintf("❌ Failed moving stop loss")
-						botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-							fmt.Sprintf("❌ Error: %s", tradeErr.Description))
-						messageT, err := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if messageT != nil {
-
-						}
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-						}
-						break
-					}
-					time.Sleep(150 * time.Millisecond)
-					continue
-				}
-			}
+		trade, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error placing trade: %v", err)
+			// send parsed error message from bot
+			botErrorMessage := fmt.Sprintf("❌ Failed moving stop loss")
+			botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
+				fmt.Sprintf("❌ Error: %s", tradeErrorReason(err)))
+			tgBot.sendMessage(botErrorMessage, int(positionMessageId))
+			continue
+		}
+		if !tradeSuccess {
+			tradeSuccess = true
+		}
+		log.Printf("Trade update placed successfully: %v", trade)
+		// append message to inform user that we moved the stop loss to the entry price of this current tp
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Moving SL to %.2f", *update.Value))
+		// append with values on next  line
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Position ID: %s\nSL: %.2f -> %.2f", position.ID, position.StopLoss, *update.Value))
+		// get chat message and reply to it
+		_, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
+		if errM != nil {
+			return errM
 		}
 	}
 	return nil
@@ -937,69 +714,30 @@ func (tgBot *TgBot) doCloseTrade(positions []MetaApiPosition) error {
 			PositionID: &position.ID,
 		}
 		// place all positions stop loss to their open price
-		for j := 0; j < 3; j++ {
-			trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, tgBot.AppConfig.MetaApiAccountID,
-				tgBot.AppConfig.MetaApiToken)
-			//
-			if err != nil {
-				log.Printf("Error placing trade: %v", err)
-				if j == 2 {
-					// send parsed error message from bot
-					// generate error message with reason
-					botErrorMessage := fmt.Sprintf("❌ Failed closing trade")
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", err))
-					tgBot.sendMessage(botMessage, int(positionMessageId))
-				}
-				continue
-			}
-			errorTrade := HandleTradeError(trade.NumericCode)
-			if tradeErr, ok := errorTrade.(*TradeError); ok {
-				if tradeErr.Type == Success {
-					if !tradeSuccess {
-						tradeSuccess = true
-					}
-					if tradeErr.Type == Success {
-						log.Printf("Trade update placed successfully: %v", trade)
-						// append message to inform user that we moved the stop loss to the entry price of this current tp
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Closed trade"))
-						// append with values on next  line
-						botMessage = fmt.Sprintf("%s\n%s", botMessage,
-							fmt.Sprintf("➡️Position ID: %s\n", position.ID))
-						// get message to reply to
-						// get chat message and reply to it
-						sendMessage, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if errM != nil {
-							return errM
-						}
-						if sendMessage != nil {
-
-						}
-						break
-					} else {
-						time.Sleep(150 * time.Millisecond)
-						continue
-					}
-				} else {
-					// if last retry send error message
-					if j == 2 {
-						botErrorMessage := fmt.Sprintf("❌ Failed closing trade")
-						botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-							fmt.Sprintf("❌ Error: %s", tradeErr.Description))
-						messageT, err := tgBot.sendMessage(botMessage, int(positionMessageId))
-						if messageT != nil {
-
-						}
-						if err != nil {
-							log.Printf("Error sending message: %v", err)
-						}
-						break
-					}
-					time.Sleep(150 * time.Millisecond)
-					continue
-				}
-			}
+		trade, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error placing trade: %v", err)
+			// send parsed error message from bot
+			botErrorMessage := fmt.Sprintf("❌ Failed closing trade")
+			botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
+				fmt.Sprintf("❌ Error: %s", tradeErrorReason(err)))
+			tgBot.sendMessage(botErrorMessage, int(positionMessageId))
+			continue
+		}
+		if !tradeSuccess {
+			tradeSuccess = true
+		}
+		log.Printf("Trade update placed successfully: %v", trade)
+		// append message to inform user that we moved the stop loss to the entry price of this current tp
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Closed trade"))
+		// append with values on next  line
+		botMessage = fmt.Sprintf("%s\n%s", botMessage,
+			fmt.Sprintf("➡️Position ID: %s\n", position.ID))
+		// get chat message and reply to it
+		_, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
+		if errM != nil {
+			return errM
 		}
 	}
 	return nil
@@ -1056,7 +794,7 @@ func setTradeRequestEntryZone(request *TradeRequest) *TradeRequest {
 	return request
 }
 
-func (tgBot *TgBot) validateTradeValue(r *TradeRequest, strategy string) error {
+func (tgBot *TgBot) validateTradeValue(r *TradeRequest, strategy Strategy) error {
 	// check if takeprofit1 is set
 
 	// check if volume is set
@@ -1072,13 +810,18 @@ func (tgBot *TgBot) validateTradeValue(r *TradeRequest, strategy string) error {
 		return errors.New("actionType is required")
 	}
 	// value coerence check
-	// if buy
-	if strategy == "TP1" {
-		r.TakeProfit2 = 0
-		r.TakeProfit3 = 0
+	legs := strategy.legsFor(r)
+	if len(legs) == 0 {
+		return fmt.Errorf("no take profit for the legs of the %s strategy", strategy.Name)
 	}
-	if strategy == "TP2" {
-		r.TakeProfit3 = 0
+	// the TPs after the last leg are not used
+	for tpNumber := legs[len(legs)-1] + 1; tpNumber <= 3; tpNumber++ {
+		switch tpNumber {
+		case 2:
+			r.TakeProfit2 = 0
+		case 3:
+			r.TakeProfit3 = 0
+		}
 	}
 	// error if  stop loss. inferior to 0
 	if r.StopLoss <= 0 {
@@ -1089,54 +832,6 @@ func (tgBot *TgBot) validateTradeValue(r *TradeRequest, strategy string) error {
 
 }
 
-func (tgBot *TgBot) currentUserPositions(endpoint string, metaApiAccountId, metaApiToken string) ([]MetaApiPosition, error) {
-	url := fmt.Sprintf("%s/users/current/accounts/%s/positions", endpoint, metaApiAccountId)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", metaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch current user positions")
-	}
-
-	var positions []MetaApiPosition
-	err = json.NewDecoder(resp.Body).Decode(&positions)
-	if err != nil {
-		return nil, err
-	}
-
-	return positions, nil
-}
-
-func ExtractReplyToMessageId(input string) (int, error) {
-	// Define a regular expression pattern to match "ReplyToMsgID:<some number>"
-	re := regexp.MustCompile(`ReplyToMsgID:(\d+)`)
-
-	// Find the first match in the input string
-	matches := re.FindStringSubmatch(input)
-
-	if len(matches) < 2 {
-		return 0, fmt.Errorf("ReplyToMsgID not found in the input string")
-	}
-
-	// Convert the matched ReplyToMsgID to an integer
-	replyToMsgID, err := strconv.Atoi(matches[1])
-	if err != nil {
-		return 0, fmt.Errorf("failed to convert ReplyToMsgID to integer: %w", err)
-	}
-
-	return replyToMsgID, nil
-}
-
-// get position by messageID containing in the clientID field with. Example for clientId 6203_TP2_pending 6203 is the messageID
 func getPositionsByMessageId(positions []MetaApiPosition, messageID int) []MetaApiPosition {
 	// search for position wich clientID start with messageID
 	var result []MetaApiPosition
@@ -1254,56 +949,31 @@ func (p *MetaApiPosition) ToMetaApiPositionLite() MetaApiPositionLite {
 	return out
 }
 
-func (position *MetaApiPosition) isBreakevenSetted() bool {
+func (position *MetaApiPosition) isBreakevenSetted(specifications *symbolSpecificationCache) bool {
 	if position.StopLoss == 0 {
 		return false
 	}
+	// stop loss on the profit side of the entry, or closer to it than the breakeven margin
+	margin := specifications.pointSize(position.Symbol) * 2
 	if position.Type == "POSITION_TYPE_BUY" {
-		// stop loss superior to entry price
-		if position.StopLoss >= position.OpenPrice {
-			return true
-		}
-		//
-		distance := position.OpenPrice - position.StopLoss
-		distance = math.Abs(distance)
-		symbole := position.Symbol
-		pointSize := getCurrencyPointSize(symbole)
-		margin := pointSize * 2
-		distancePoint := distance / pointSize
-		if distancePoint <= margin {
-			return true
-		}
+		return position.StopLoss >= position.OpenPrice-margin
 	} else if position.Type == "POSITION_TYPE_SELL" {
-		// stop loss inferior to entry price
-		if position.StopLoss <= position.OpenPrice {
-			return true
-		}
-		//
-		distance := position.StopLoss - position.OpenPrice
-		distance = math.Abs(distance)
-		symbole := position.Symbol
-		pointSize := getCurrencyPointSize(symbole)
-		margin := pointSize * 2
-		distancePoint := distance / pointSize
-		if distancePoint <= margin {
-			return true
-		}
-
+		return position.StopLoss <= position.OpenPrice+margin
 	}
 	return false
 }
 
-func (p *MetaApiPosition) isWin() bool {
-	if !p.isBreakeven() {
+func (p *MetaApiPosition) isWin(specifications *symbolSpecificationCache) bool {
+	if !p.isBreakeven(specifications) {
 		return p.Profit > 0
 	}
 	return false
 }
 
-func (p *MetaApiPosition) outcomeMessage(profit float64) string {
+func (p *MetaApiPosition) outcomeMessage(specifications *symbolSpecificationCache, profit float64) string {
 	// if dont time is set
 	// if broker comment contains [tp]=
-	if p.isBreakeven() {
+	if p.isBreakeven(specifications) {
 		return ""
 	}
 	if p.Profit == 0 {
@@ -1376,7 +1046,8 @@ type ThresholdTrailingStopLoss struct {
 }
 
 type TrailingStopLoss struct {
-	Distance *DistanceTrailingStopLoss `json:"distance,omitempty"` // Configuration TSL en fonction de la distance
+	Distance  *DistanceTrailingStopLoss  `json:"distance,omitempty"`  // Configuration TSL en fonction de la distance
+	Threshold *ThresholdTrailingStopLoss `json:"threshold,omitempty"` // Paliers de stop loss
 }
 
 type Expiration struct {
@@ -1384,17 +1055,24 @@ type Expiration struct {
 	Time string `json:"time,omitempty"`
 }
 
-func ConvertToMetaApiTradeRequests(trade TradeRequest, strategy string) []MetaApiTradeRequest {
+// one request by TP leg, legs are the tp numbers placed
+func ConvertToMetaApiTradeRequests(trade TradeRequest, legs []int, expiration time.Duration) []MetaApiTradeRequest {
 	var metaApiRequests []MetaApiTradeRequest
+	var orderExpiration *Expiration
+	if trade.IsPendingOrder() {
+		orderExpiration = &Expiration{
+			Type: "ORDER_TIME_SPECIFIED",
+			Time: time.Now().Add(expiration).UTC().Format(time.RFC3339),
+		}
+	}
 
-	tpValues := []float64{trade.TakeProfit1, trade.TakeProfit2, trade.TakeProfit3}
-
-	for _, tp := range tpValues {
+	for _, tpNumber := range legs {
+		tp := trade.TakeProfit(tpNumber)
 
 		//comment := fmt.Sprintf("Trade for TP%d", i+1)
 		if tp == -1 || tp > 0 {
 			metaTrade := MetaApiTradeRequest{
-				ActionType: trade.ActionType,
+				ActionType: trade.MetaApiActionType(),
 				Symbol:     trade.Symbol,
 				Volume:     &trade.Volume, // Assuming volume is the same for all trades
 				//OpenPriceUnits:      "RELATIVE_BALANCE_PERCENTAGE",
@@ -1415,6 +1093,10 @@ func ConvertToMetaApiTradeRequests(trade TradeRequest, strategy string) []MetaAp
 			if trade.StopLoss > 0 {
 				metaTrade.StopLoss = &trade.StopLoss
 			}
+			if trade.IsPendingOrder() {
+				metaTrade.OpenPrice = &trade.OpenPrice
+				metaTrade.Expiration = orderExpiration
+			}
 			metaApiRequests = append(metaApiRequests, metaTrade)
 		}
 	}
@@ -1456,42 +1138,46 @@ type Trade struct {
 	Profit     float64 `json:"profit,omitempty"` // Peut être mis à jour après l'exécution du trade
 }
 
+type MetaApiCandle struct {
+	Symbol    string  `json:"symbol"`
+	Timeframe string  `json:"timeframe"`
+	Time      string  `json:"time"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+}
+
 type MetaApiPriceResponse struct {
 	Symbol string  `json:"symbol"`
 	Ask    float64 `json:"ask"`
 	Bid    float64 `json:"bid"`
+	// value of a tick for one lot in the account currency
+	ProfitTickValue float64 `json:"profitTickValue,omitempty"`
+	LossTickValue   float64 `json:"lossTickValue,omitempty"`
+	// rate from the profit currency of the symbol to the account currency
+	AccountCurrencyExchangeRate float64 `json:"accountCurrencyExchangeRate,omitempty"`
 	// other fields you may want to include...
 }
 
-// get all symbos
-// curl --location 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/symbols' \
-// --header 'auth-token: <string>' \
-// --header 'Accept: application/json'
-func fetchAllSymbols(endpoint string, metaApiAccountId, metaApiToken string) ([]string, error) {
-	url := fmt.Sprintf("%s/users/current/accounts/%s/symbols", endpoint, metaApiAccountId)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", metaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch symbols")
-	}
-
-	var symbols []string
-	err = json.NewDecoder(resp.Body).Decode(&symbols)
-	if err != nil {
-		return nil, err
-	}
-
-	return symbols, nil
+// trading conditions of a symbol
+type MetaApiSymbolSpecification struct {
+	Symbol       string  `json:"symbol"`
+	TickSize     float64 `json:"tickSize,omitempty"`
+	MinVolume    float64 `json:"minVolume,omitempty"`
+	MaxVolume    float64 `json:"maxVolume,omitempty"`
+	VolumeStep   float64 `json:"volumeStep,omitempty"`
+	ContractSize float64 `json:"contractSize,omitempty"`
+	Digits       int     `json:"digits,omitempty"`
+	Point        float64 `json:"point,omitempty"`
+	// currency of the symbol and currency of its prices
+	BaseCurrency   string `json:"baseCurrency,omitempty"`
+	ProfitCurrency string `json:"profitCurrency,omitempty"`
+	// trading hours of each day in broker time
+	TradeSessions map[string][]MetaApiSession `json:"tradeSessions,omitempty"`
+	// value of a tick for one lot in the account currency, from the price when the broker does not give it
+	TickValue   float64 `json:"tickValue,omitempty"`
+	Description string  `json:"description,omitempty"`
 }
 
 /**
@@ -1510,8 +1196,8 @@ WantedBy=multi-user.target
 ~
 */
 
-func calculateNewStopLossPriceForBreakeven(entryPrice float64, actionType string, symbol string) float64 {
-	pointSize := getCurrencyPointSize(symbol)
+func calculateNewStopLossPriceForBreakeven(specifications *symbolSpecificationCache, entryPrice float64, actionType string, symbol string) float64 {
+	pointSize := specifications.pointSize(symbol)
 	margin := pointSize * 2
 	pips := 0.0
 	// calculate new stop loss
@@ -1540,9 +1226,13 @@ func getDefaultStopLoss(actionType string, entryPrice float64) float64 {
 }
 
 func (tgBot *TgBot) checkCurrentPositions() {
+	if !tgBot.positionsCheck.TryLock() {
+		return
+	}
+	defer tgBot.positionsCheck.Unlock()
 	println("Checking current positions")
 	startTime := time.Now()
-	latestPositions, err := tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+	latestPositions, err := tgBot.Broker.Positions()
 	if err != nil {
 		println("Error getting current user positions: ", err)
 	}
@@ -1557,7 +1247,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 				tgBot.sendMessage("Error closing all trades "+err.Error(), 0)
 			} else {
 				// confirm
-				latestPositions, err = tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+				latestPositions, err = tgBot.Broker.Positions()
 				if err != nil {
 					println("Error getting current user positions: ", err)
 				} else {
@@ -1578,10 +1268,14 @@ func (tgBot *TgBot) checkCurrentPositions() {
 		// is position is winning
 		if position.Profit > 0 {
 			tpNumber := extractTPFromClientId(position.ClientID)
-			if tpNumber > 1 && isBreakevenSetted(&position) == false {
+			if tpNumber > 1 && isBreakevenSetted(tgBot.specifications, &position) == false {
 				clientId := position.ClientID
 				// check if tp1 is containing
 				messageId := extractMessageIdFromClientId(clientId)
+				if !tgBot.requestStrategy(tgBot.storedTradeRequest(messageId)).hasLeg(1) {
+					// no TP1 leg with this strategy, its TPs are trailed below
+					continue
+				}
 				tp1Position := getPositionByMessageIdAndTP(latestPositions, messageId, 1)
 				channelID := extractChannelIDFromClientId(clientId)
 				if tp1Position == nil {
@@ -1603,11 +1297,18 @@ func (tgBot *TgBot) checkCurrentPositions() {
 
 	}
 
+	// ladder steps and limits of a signal are not filled anymore once its TP1 is hit
+	tgBot.cancelOrdersAfterTP1()
+	// stop loss moved on the TPs without leg and trailing stops of the channels
+	tgBot.manageTrailingStops(latestPositions)
+	// positions protected before the news events
+	tgBot.manageNewsBlackout(latestPositions)
+
 	// if profit goal is not reached
 	// check if the bot reached the objective amount profit
 	// get amount from redis
 
-	defaultProfitGoal := tgBot.RedisClient.GetDailyProfitGoal()
+	defaultProfitGoal := tgBot.dailyProfitGoal()
 	profitGoal := defaultProfitGoal
 	if profitGoal > 0 {
 		// add margin of 10% to the profit goal
@@ -1636,7 +1337,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 					tgBot.doCloseTrade(latestPositions)
 					// breakeven to all
 					// confirm by get current positions
-					latestPositions, err := tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+					latestPositions, err := tgBot.Broker.Positions()
 					if err != nil {
 						println("Error getting current user positions: ", err)
 					}
@@ -1660,13 +1361,13 @@ func (tgBot *TgBot) checkCurrentPositions() {
 		}
 		positionMessageId := tgBot.RedisClient.GetPositionMessageId(position.ID)
 		// check if position is making profit
-		if position.Profit > 0 && position.isBreakevenSetted() {
+		if position.Profit > 0 && position.isBreakevenSetted(tgBot.specifications) {
 			// check if position has take profit and we can split the volume
 			if position.Volume > 0.02 {
 				// if case no take profit setted use a max take profit
 				if position.TakeProfit == 0 {
 					// add 500 pips to the current price
-					pointSize := getCurrencyPointSize(position.Symbol)
+					pointSize := tgBot.specifications.pointSize(position.Symbol)
 					position.TakeProfit = position.CurrentPrice + (500 * pointSize)
 				}
 				// ensure that we've not already partially closed the position
@@ -1702,7 +1403,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 		isLoosing := tgBot.RedisClient.IsLosingPosition(position.ID)
 
 		// Check if position has a valid stop loss set
-		if !isLoosing && position.StopLoss > 0 && !position.isBreakevenSetted() {
+		if !isLoosing && position.StopLoss > 0 && !position.isBreakevenSetted(tgBot.specifications) {
 			// Calculate the distance to the stop loss
 			totalDistance := math.Abs(position.OpenPrice - position.StopLoss)
 			currentDistance := math.Abs(position.CurrentPrice - position.OpenPrice)
@@ -1725,7 +1426,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 	}
 	for _, position := range latestPositions {
 		isLoosing := tgBot.RedisClient.IsLosingPosition(position.ID)
-		if isLoosing && position.Profit > 0 && !position.isBreakevenSetted() {
+		if isLoosing && position.Profit > 0 && !position.isBreakevenSetted(tgBot.specifications) {
 			positionMessageId := tgBot.RedisClient.GetPositionMessageId(position.ID)
 			// check if breakeven is setted for the channel on redis
 			tgBot.sendMessage("Auto breakeven triggered for deadly position", int(positionMessageId))
@@ -1739,7 +1440,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 	// if trade last too long set it to breakeven if positive
 	for _, position := range latestPositions {
 		tpNumber := extractTPFromClientId(position.ClientID)
-		if tpNumber == 1 && isBreakevenSetted(&position) == false {
+		if tpNumber == 1 && isBreakevenSetted(tgBot.specifications, &position) == false {
 			// check if position is older than 12 hours
 			timeString := position.Time
 			timePos, err := time.Parse(time.RFC3339, timeString)
@@ -1774,7 +1475,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 				} else if position.Profit < 0 {
 					// leave with low loss base on tpNumber and timeframe
 					// if tp1 we can leave with 0.5% loss every extra 15 minutes
-					maxLoss := position.CalculateMaxLoss()
+					maxLoss := position.CalculateMaxLoss(tgBot.specifications)
 					if maxLoss > 0 {
 						// count passed timeframes every 15 minutes
 						// 15 minutes
@@ -1817,7 +1518,7 @@ func (tgBot *TgBot) checkCurrentPositions() {
 		// check if position is older than 12 hours
 		if timePos.Before(time.Now().Add(-12 * time.Hour)) {
 			// check if position is making profit
-			if position.Profit > 0 && !position.isBreakevenSetted() {
+			if position.Profit > 0 && !position.isBreakevenSetted(tgBot.specifications) {
 				// send message
 				tgBot.doSlToEntryPrice([]MetaApiPosition{position})
 				// send message
@@ -1850,7 +1551,7 @@ func (tgBot *TgBot) getTodayProfit() float64 {
 
 // reached profit goal
 func (tgBot *TgBot) reachedProfitGoal() bool {
-	profitGoal := tgBot.RedisClient.GetDailyProfitGoal()
+	profitGoal := tgBot.dailyProfitGoal()
 	if profitGoal > 0 {
 		profit := tgBot.getTodayProfit()
 		if profit >= profitGoal {
@@ -1864,7 +1565,7 @@ func (tgBot *TgBot) reachedProfitGoal() bool {
 func (tgBot *TgBot) reachedDailyLossLimit() bool {
 	balance := tgBot.getAccountBalance()
 	// limit percentage
-	lossLimitPercentage := tgBot.RedisClient.GetDailyLossLimitPercentage()
+	lossLimitPercentage := tgBot.dailyLossLimitPercentage()
 	// daily profit
 	profit := tgBot.getTodayProfit()
 	// profit is negative on loss
@@ -1884,7 +1585,7 @@ func (tgBot *TgBot) reachedDailyLossLimit() bool {
 func (tgBot *TgBot) getDailyLossLimitAmount() float64 {
 	balance := tgBot.getAccountBalance()
 	// limit percentage
-	lossLimitPercentage := tgBot.RedisClient.GetDailyLossLimitPercentage()
+	lossLimitPercentage := tgBot.dailyLossLimitPercentage()
 	// calculate loss amount
 	lossAmount := balance * lossLimitPercentage / 100
 	return lossAmount
@@ -1901,14 +1602,14 @@ func (tgBot *TgBot) canSupportLossAmount(newLossAmount float64) bool {
 	if profit < 0 {
 		// get balance
 		// limit percentage
-		lossLimitPercentage := tgBot.RedisClient.GetDailyLossLimitPercentage()
+		lossLimitPercentage := tgBot.dailyLossLimitPercentage()
 		// calculate loss percentage
 		lossPercentage := (profit - newLossAmount) / balance * 100
 		if lossPercentage <= lossLimitPercentage {
 			return true
 		}
 	}
-	dailyProfitGoal := tgBot.RedisClient.GetDailyProfitGoal()
+	dailyProfitGoal := tgBot.dailyProfitGoal()
 	if dailyProfitGoal > 0 {
 		profitMinusNewLoss := profit - newLossAmount
 		if profitMinusNewLoss >= dailyProfitGoal {
@@ -1931,6 +1632,17 @@ func extractChannelIDFromClientId(id string) int {
 	return channelID
 }
 
+// keep positions opened from the given channel only (message ids are only unique per channel)
+func filterPositionsByChannel(positions []MetaApiPosition, channelID int64) []MetaApiPosition {
+	var result []MetaApiPosition
+	for _, position := range positions {
+		if int64(extractChannelIDFromClientId(position.ClientID)) == channelID {
+			result = append(result, position)
+		}
+	}
+	return result
+}
+
 func getWinnigPositions(positions []MetaApiPosition) []MetaApiPosition {
 	var result []MetaApiPosition
 	for _, position := range positions {
@@ -1957,8 +1669,6 @@ func getLoosingPositions(positions []MetaApiPosition) []MetaApiPosition {
 // "volume": 0.01
 // }' 'https://mt-client-api-v1.new-york.agiliumtrade.ai/users/current/accounts/865d3a4d-3803-486d-bdf3-a85679d9fad2/trade'
 func (tgBot *TgBot) doCloseHalfProfitTrade(position MetaApiPosition) error {
-	// get entry price base on positions
-	tradeSuccess := false
 	// if volume is lower than 0.02 skip
 	if position.Volume < 0.02 {
 		return errors.New("Volume is lower than 0.02. Can't close half profit")
@@ -1975,66 +1685,21 @@ func (tgBot *TgBot) doCloseHalfProfitTrade(position MetaApiPosition) error {
 		PositionID: &position.ID,
 		Volume:     &halfVolume,
 	}
-	// place all positions stop loss to their open price
-	for j := 0; j < 3; j++ {
-		trade, err := executeTrade(tgBot.AppConfig.MetaApiEndpoint, metaApiRequest, tgBot.AppConfig.MetaApiAccountID,
-			tgBot.AppConfig.MetaApiToken)
-		//
-		if err != nil {
-			log.Printf("Error placing trade: %v", err)
-			if j == 2 {
-				// send parsed error message from bot
-				// generate error message with reason
-				botErrorMessage := fmt.Sprintf("❌ Failed closing half profit trade")
-				botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-					fmt.Sprintf("❌ Error: %s", err))
-				tgBot.sendMessage(botMessage, int(positionMessageId))
-			}
-			continue
-		}
-		errorTrade := HandleTradeError(trade.NumericCode)
-		if tradeErr, ok := errorTrade.(*TradeError); ok {
-			if tradeErr.Type == Success {
-				if !tradeSuccess {
-					tradeSuccess = true
-				}
-				log.Printf("Trade update placed successfully: %v", trade)
-				// append message to inform user that we moved the stop loss to the entry price of this current tp
-				botMessage = fmt.Sprintf("%s\n%s", botMessage,
-					fmt.Sprintf("➡️Closed half profit trade"))
-				// append with values on next  line
-				botMessage = fmt.Sprintf("%s\n%s", botMessage,
-					fmt.Sprintf("➡️Position ID: %s\n", position.ID))
-				// get message to reply to // get chat message and reply to it
-				sendMessage, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
-				if errM != nil {
-					return errM
-				}
-				if sendMessage != nil {
-
-				}
-				break
-			} else {
-				// if last retry send error message
-				if j == 2 {
-					botErrorMessage := fmt.Sprintf("❌ Failed closing trade")
-					botErrorMessage = fmt.Sprintf("%s\n%s", botErrorMessage,
-						fmt.Sprintf("❌ Error: %s", tradeErr.Description))
-					messageT, err := tgBot.sendMessage(botMessage, int(positionMessageId))
-					if messageT != nil {
-
-					}
-					if err != nil {
-						log.Printf("Error sending message: %v", err)
-					}
-					break
-				}
-				time.Sleep(150 * time.Millisecond)
-				continue
-			}
-		}
+	trade, err := tgBot.Executor.Execute(metaApiRequest)
+	if err != nil {
+		log.Printf("Error placing trade: %v", err)
+		return err
 	}
-	return nil
+	log.Printf("Trade update placed successfully: %v", trade)
+	// append message to inform user that we moved the stop loss to the entry price of this current tp
+	botMessage = fmt.Sprintf("%s\n%s", botMessage,
+		fmt.Sprintf("➡️Closed half profit trade"))
+	// append with values on next  line
+	botMessage = fmt.Sprintf("%s\n%s", botMessage,
+		fmt.Sprintf("➡️Position ID: %s\n", position.ID))
+	// get message to reply to // get chat message and reply to it
+	_, errM := tgBot.sendMessage(botMessage, int(positionMessageId))
+	return errM
 }
 
 func calculateProfit(positions []MetaApiPosition, filledOnly bool) float64 {
@@ -2046,89 +1711,20 @@ func calculateProfit(positions []MetaApiPosition, filledOnly bool) float64 {
 	return profit
 }
 
-// curl --location 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/174013a4-0a6e-4f10-bda7-feee1a846b4a/history-orders/time/2024-10-27T00:00:16Z/2024-10-28T00:00:16Z' \
-// --header 'auth-token: eyJhbGciOiJSUzUxMiIsInR5cCI6IkpXVCJ9.eyJfaWQiOiJhOWI3Y2M0ZDkzYzA2NDNmYjc1NDYyNjI1YmI3YjBmMiIsInBlcm1pc3Npb25zIjpbXSwiYWNjZXNzUnVsZXMiOlt7ImlkIjoidHJhZGluZy1hY2NvdW50LW1hbmFnZW1lbnQtYXBpIiwibWV0aG9kcyI6WyJ0cmFkaW5nLWFjY291bnQtbWFuYWdlbWVudC1hcGk6cmVzdDpwdWJsaWM6KjoqIl0sInJvbGVzIjpbInJlYWRlciIsIndyaXRlciJdLCJyZXNvdXJjZXMiOlsiKjokVVNFUl9JRCQ6KiJdfSx7ImlkIjoibWV0YWFwaS1yZXN0LWFwaSIsIm1ldGhvZHMiOlsibWV0YWFwaS1hcGk6cmVzdDpwdWJsaWM6KjoqIl0sInJvbGVzIjpbInJlYWRlciIsIndyaXRlciJdLCJyZXNvdXJjZXMiOlsiKjokVVNFUl9JRCQ6KiJdfSx7ImlkIjoibWV0YWFwaS1ycGMtYXBpIiwibWV0aG9kcyI6WyJtZXRhYXBpLWFwaTp3czpwdWJsaWM6KjoqIl0sInJvbGVzIjpbInJlYWRlciIsIndyaXRlciJdLCJyZXNvdXJjZXMiOlsiKjokVVNFUl9JRCQ6KiJdfSx7ImlkIjoibWV0YWFwaS1yZWFsLXRpbWUtc3RyZWFtaW5nLWFwaSIsIm1ldGhvZHMiOlsibWV0YWFwaS1hcGk6d3M6cHVibGljOio6KiJdLCJyb2xlcyI6WyJyZWFkZXIiLCJ3cml0ZXIiXSwicmVzb3VyY2VzIjpbIio6JFVTRVJfSUQkOioiXX0seyJpZCI6Im1ldGFzdGF0cy1hcGkiLCJtZXRob2RzIjpbIm1ldGFzdGF0cy1hcGk6cmVzdDpwdWJsaWM6KjoqIl0sInJvbGVzIjpbInJlYWRlciIsIndyaXRlciJdLCJyZXNvdXJjZXMiOlsiKjokVVNFUl9JRCQ6KiJdfSx7ImlkIjoicmlzay1tYW5hZ2VtZW50LWFwaSIsIm1ldGhvZHMiOlsicmlzay1tYW5hZ2VtZW50LWFwaTpyZXN0OnB1YmxpYzoqOioiXSwicm9sZXMiOlsicmVhZGVyIiwid3JpdGVyIl0sInJlc291cmNlcyI6WyIqOiRVU0VSX0lEJDoqIl19LHsiaWQiOiJjb3B5ZmFjdG9yeS1hcGkiLCJtZXRob2RzIjpbImNvcHlmYWN0b3J5LWFwaTpyZXN0OnB1YmxpYzoqOioiXSwicm9sZXMiOlsicmVhZGVyIiwid3JpdGVyIl0sInJlc291cmNlcyI6WyIqOiRVU0VSX0lEJDoqIl19LHsiaWQiOiJtdC1tYW5hZ2VyLWFwaSIsIm1ldGhvZHMiOlsibXQtbWFuYWdlci1hcGk6cmVzdDpkZWFsaW5nOio6KiIsIm10LW1hbmFnZXItYXBpOnJlc3Q6cHVibGljOio6KiJdLCJyb2xlcyI6WyJyZWFkZXIiLCJ3cml0ZXIiXSwicmVzb3VyY2VzIjpbIio6JFVTRVJfSUQkOioiXX0seyJpZCI6ImJpbGxpbmctYXBpIiwibWV0aG9kcyI6WyJiaWxsaW5nLWFwaTpyZXN0OnB1YmxpYzoqOioiXSwicm9sZXMiOlsicmVhZGVyIl0sInJlc291cmNlcyI6WyIqOiRVU0VSX0lEJDoqIl19XSwidG9rZW5JZCI6IjIwMjEwMjEzIiwiaW1wZXJzb25hdGVkIjpmYWxzZSwicmVhbFVzZXJJZCI6ImE5YjdjYzRkOTNjMDY0M2ZiNzU0NjI2MjViYjdiMGYyIiwiaWF0IjoxNzI5OTgyOTIxLCJleHAiOjE3Mzc3NTg5MjF9.Io-bIjaBeEZyYAcNpta8QlGM3HeOtS8v4x3rJoSTuzP4aqqLmazYMhsvVVWXAOa-7BW0Idp5HwVkxp2oACPj8vcdSoRY0OsmopAcSP6tWGK-S3oCPS2ig3EaYR2WNiaPkg5rnye_lafBNKEZnQ9OrETYJOl_7hT-Rbw_PIOJMhASzdHsiBKsPJ7_h-qI_xTFVLtBfMgwBsnoAL_RCc4SwbyShw7kIwqv1t2aKrZOOzfDrTlYLCeDXOou62nezHxAHmSmPoiUgcSOq1Q34n71xq12H2Jk9AecyFJrP-Ayycx1a7fy0Nb6kanvMHV-SYQwkLDcC-J1h8QN5uqnSXSByI6K9JheopN-bG14VXFRu6DYOr-MCHDiv1tRkPzc_P9SJQKktkN_Tvrodp7pEVdr4Bczghd6dcZ0OoauwF_dlreHx12hHTEoH-pnfglW5zdtirp0BlUpBAg6OHMWzc1aVz8HKhgANQfACJys62FqUgpwe0d_sZ2rRJI6aA8mp5bkC3uMlN-dtCI82WhOvoXyBqCGp2lPxwxiXClR7m2DDq5OzVIeDolW94G0HJV-CADAQlu4xkKwpGVDovFytzXwuvRxoMxrAu1W1SxIDEOXa5t-vFUrV0coaaiPeRzTRaYYAyKul143TYDCKK62ve1G7kwXOZWjuk3pcUkrO2Uvl1o' \
-// --header 'Accept: application/json'
 // day from midnight to midnight
 func (tgBot *TgBot) getTodayPositions() ([]MetaApiPosition, error) {
-	startDay := time.Now().Format("2006-01-02T00:00:00Z")
-	//
-	endDay := time.Now().Add(24 * time.Hour).Format("2006-01-02T00:00:00Z")
-	url := fmt.Sprintf("%s/users/current/accounts/%s/history-deals/time/%s/%s", tgBot.AppConfig.MetaApiEndpoint,
-		tgBot.AppConfig.MetaApiAccountID, startDay, endDay)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch today positions")
-	}
-
-	var positions []MetaApiPosition
-	err = json.NewDecoder(resp.Body).Decode(&positions)
-	if err != nil {
-		return nil, err
-	}
-	// exclud positions of type DEAL_TYPE_BALANCE
-	var filteredPositions []MetaApiPosition
-	for _, position := range positions {
-		if position.Type != "DEAL_TYPE_BALANCE" {
-			filteredPositions = append(filteredPositions, position)
-		}
-	}
-	// enchace value with order
-	positionOrders, errO := tgBot.getTodayOrders()
-	if errO != nil {
-
-	}
-	// merge positions and orders
-	for _, order := range positionOrders {
-		for i, position := range filteredPositions {
-			if position.ID == order.ID {
-				filteredPositions[i].OpenPrice = order.OpenPrice
-				filteredPositions[i].CurrentPrice = order.CurrentPrice
-			}
-		}
-	}
-	return filteredPositions, nil
+	startDay := startOfDay(time.Now())
+	return tgBot.getHistoryPositions(startDay, startDay.AddDate(0, 0, 1))
 }
 
 func (tgBot *TgBot) getMonthPositions() ([]MetaApiPosition, error) {
 	now := time.Now()
-	// Set startDay to the first day of the current month at midnight
-	startDay := now.AddDate(0, 0, -16).Format("2006-01-02T00:00:00Z")
-
-	// Set endDay to tomorrow at midnight
-	endDay := now.Add(24 * time.Hour).Truncate(24 * time.Hour).Format("2006-01-02T00:00:00Z")
-
-	url := fmt.Sprintf("%s/users/current/accounts/%s/history-deals/time/%s/%s", tgBot.AppConfig.MetaApiEndpoint,
-		tgBot.AppConfig.MetaApiAccountID, startDay, endDay)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch today positions")
-	}
+	return tgBot.getHistoryPositions(startOfDay(now).AddDate(0, 0, -16), startOfDay(now).AddDate(0, 0, 1))
+}
 
-	var positions []MetaApiPosition
-	err = json.NewDecoder(resp.Body).Decode(&positions)
+// deals done between two dates, with the open price of their order
+func (tgBot *TgBot) getHistoryPositions(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	positions, err := tgBot.Broker.HistoryDeals(from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -2140,9 +1736,9 @@ func (tgBot *TgBot) getMonthPositions() ([]MetaApiPosition, error) {
 		}
 	}
 	// enchace value with order
-	positionOrders, errO := tgBot.getMonthOrders()
+	positionOrders, errO := tgBot.Broker.HistoryOrders(from, to)
 	if errO != nil {
-
+		log.Printf("Error fetching history orders: %v", errO)
 	}
 	// merge positions and orders
 	for _, order := range positionOrders {
@@ -2156,83 +1752,6 @@ func (tgBot *TgBot) getMonthPositions() ([]MetaApiPosition, error) {
 	return filteredPositions, nil
 }
 
-// todays position orders ! {{baseUrl}}/users/current/accounts/:accountId/history-orders/time/:startTime/:endTime
-func (tgBot *TgBot) getTodayOrders() ([]MetaApiPosition, error) {
-	startDay := time.Now().Format("2006-01-02T00:00:00Z")
-	endDay := time.Now().Add(24 * time.Hour).Format("2006-01-02T00:00:00Z")
-	url := fmt.Sprintf("%s/users/current/accounts/%s/history-orders/time/%s/%s", tgBot.AppConfig.MetaApiEndpoint,
-		tgBot.AppConfig.MetaApiAccountID, startDay, endDay)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch today positions")
-	}
-
-	var positions []MetaApiPosition
-	err = json.NewDecoder(resp.Body).Decode(&positions)
-	if err != nil {
-		return nil, err
-	}
-	// exclud positions of type DEAL_TYPE_BALANCE
-	var filteredPositions []MetaApiPosition
-	for _, position := range positions {
-		if position.Type != "DEAL_TYPE_BALANCE" {
-			filteredPositions = append(filteredPositions, position)
-		}
-	}
-	return filteredPositions, nil
-}
-
-func (tgBot *TgBot) getMonthOrders() ([]MetaApiPosition, error) {
-	now := time.Now()
-	// Set startDay to the first day of the current month at midnight
-	startDay := now.AddDate(0, 0, -16).Format("2006-01-02T00:00:00Z")
-
-	// Set endDay to tomorrow at midnight
-	endDay := now.Add(24 * time.Hour).Truncate(24 * time.Hour).Format("2006-01-02T00:00:00Z")
-	url := fmt.Sprintf("%s/users/current/accounts/%s/history-orders/time/%s/%s", tgBot.AppConfig.MetaApiEndpoint,
-		tgBot.AppConfig.MetaApiAccountID, startDay, endDay)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch today positions")
-	}
-
-	var positions []MetaApiPosition
-	err = json.NewDecoder(resp.Body).Decode(&positions)
-	if err != nil {
-		return nil, err
-	}
-	// exclud positions of type DEAL_TYPE_BALANCE
-	var filteredPositions []MetaApiPosition
-	for _, position := range positions {
-		if position.Type != "DEAL_TYPE_BALANCE" {
-			filteredPositions = append(filteredPositions, position)
-		}
-	}
-	return filteredPositions, nil
-}
-
 func extractMessageIdFromClientId(id string) int {
 	// client id example : channelTitle@ChannelID_MessageID_TP2 :  TGR@2054755865_4609_TP3
 	re := regexp.MustCompile(`[^@]+@\d+_(\d+)_TP\d+`)
@@ -2248,47 +1767,12 @@ func extractMessageIdFromClientId(id string) int {
 }
 
 // check if breakeven is setted for a position. it is set when stop is moved to entry price with a margin base on buy or sell
-func isBreakevenSetted(position *MetaApiPosition) bool {
-	if position.StopLoss == 0 {
-		return false
-	}
-	if position.Type == "POSITION_TYPE_BUY" {
-		// stop loss superior to entry price
-		if position.StopLoss >= position.OpenPrice {
-			return true
-		}
-		//
-		distance := position.OpenPrice - position.StopLoss
-		distance = math.Abs(distance)
-		symbole := position.Symbol
-		pointSize := getCurrencyPointSize(symbole)
-		margin := pointSize * 2
-		distancePoint := distance / pointSize
-		if distancePoint <= margin {
-			return true
-		}
-	} else if position.Type == "POSITION_TYPE_SELL" {
-		// stop loss inferior to entry price
-		if position.StopLoss <= position.OpenPrice {
-			return true
-		}
-		//
-		distance := position.StopLoss - position.OpenPrice
-		distance = math.Abs(distance)
-		symbole := position.Symbol
-		pointSize := getCurrencyPointSize(symbole)
-		margin := pointSize * 2
-		distancePoint := distance / pointSize
-		if distancePoint <= margin {
-			return true
-		}
-
-	}
-	return false
+func isBreakevenSetted(specifications *symbolSpecificationCache, position *MetaApiPosition) bool {
+	return position.isBreakevenSetted(specifications)
 }
 
 // is position breakeven
-func (position *MetaApiPosition) isBreakeven() bool {
+func (position *MetaApiPosition) isBreakeven(specifications *symbolSpecificationCache) bool {
 	if position.Profit == 0 {
 		return true
 	}
@@ -2301,12 +1785,12 @@ func (position *MetaApiPosition) isBreakeven() bool {
 			actionType = "POSITION_TYPE_SELL"
 		}
 	}
-	breakevenPrice := calculateNewStopLossPriceForBreakeven(position.OpenPrice, actionType, position.Symbol)
+	breakevenPrice := calculateNewStopLossPriceForBreakeven(specifications, position.OpenPrice, actionType, position.Symbol)
 	distance := breakevenPrice - position.StopLoss
 	//round
 	distance = math.Round(distance*100) / 100
 	distance = math.Abs(distance)
-	pointSize := getCurrencyPointSize(position.Symbol)
+	pointSize := specifications.pointSize(position.Symbol)
 	margin := pointSize * 2
 	if distance <= margin {
 		return true
@@ -2314,44 +1798,36 @@ func (position *MetaApiPosition) isBreakeven() bool {
 	return false
 }
 
-func (p *MetaApiPosition) GetMaxProfit() float64 {
+func (p *MetaApiPosition) GetMaxProfit(specifications *symbolSpecificationCache) float64 {
 	// get tp
 	tp := p.TakeProfit
 	if tp == 0 {
 		return 0
 	}
-	// get entry price
-	entryPrice := p.OpenPrice
-	// get symbol
-	symbol := p.Symbol
-	// get point size
-	pointSize := getCurrencyPointSize(symbol)
-	// get distance
-	distance := tp - entryPrice
-	// get distance in point
-	distancePoint := distance / pointSize
-	// get margin
-	// get max profit
-	maxProfit := distancePoint * pointSize * p.Volume
-	return math.Abs(maxProfit)
+	// max profit in account currency, the positions carry the exchange rate of the broker
+	profit, _ := specifications.priceMoveValue(p.Symbol, tp-p.OpenPrice, p.Volume, p.AccountCurrencyExchangeRate)
+	return profit
 }
 
-func (p *MetaApiPosition) CalculateMaxLoss() float64 {
+func (p *MetaApiPosition) CalculateMaxLoss(specifications *symbolSpecificationCache) float64 {
 	// get sl
 	sl := p.StopLoss
 	if sl == 0 {
 		return 0
 	}
-	// get entry price
-	entryPrice := p.OpenPrice
-	// get symbol
-	symbol := p.Symbol
-	// get point size
-	// get distance
-	distancePips := calculatePips(sl, entryPrice, symbol)
-	// get max loss
-	maxLoss := distancePips * p.Volume
-	return math.Abs(maxLoss)
+	// max loss in account currency
+	loss, _ := specifications.priceMoveValue(p.Symbol, sl-p.OpenPrice, p.Volume, p.AccountCurrencyExchangeRate)
+	return loss
+}
+
+// loss in account currency when the stop loss is hit, 0 when it secures the entry. without stop loss the whole
+// position is at risk
+func (p *MetaApiPosition) riskedLoss(specifications *symbolSpecificationCache) float64 {
+	if p.StopLoss > 0 && p.isBreakevenSetted(specifications) {
+		return 0
+	}
+	loss, _ := specifications.priceMoveValue(p.Symbol, p.OpenPrice-p.StopLoss, p.Volume, p.AccountCurrencyExchangeRate)
+	return loss
 }
 
 type MetaApiAccountInformation struct {
@@ -2374,124 +1850,11 @@ type MetaApiAccountInformation struct {
 	AccountCurrencyExchangeRate float64 `json:"accountCurrencyExchangeRate,omitempty"`
 }
 
-func (tgBot *TgBot) getAccountInformation() (MetaApiAccountInformation, error) {
-	url := fmt.Sprintf("%s/users/current/accounts/%s/account-information", tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return MetaApiAccountInformation{}, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return MetaApiAccountInformation{}, errors.New("failed to fetch account information")
-	}
-
-	var accountInformation MetaApiAccountInformation
-	err = json.NewDecoder(resp.Body).Decode(&accountInformation)
-	if err != nil {
-		return MetaApiAccountInformation{}, err
-	}
-
-	return accountInformation, nil
-}
-
-// curl --location --request POST 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/deploy?executeForAllReplicas=true' \
-// --header 'auth-token: <string>' \
-// --header 'Accept: */*'
-// deploy account
-func (tgBot *TgBot) deployAccount() error {
-	url := fmt.Sprintf("%s/users/current/accounts/%s/deploy?executeForAllReplicas=true", tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID)
-
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "*/*")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		return errors.New("failed to deploy account")
-	}
-
-	return nil
-}
-
-// undeploy
-// //curl --location --request POST 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>/deploy?executeForAllReplicas=true' \
-// //--header 'auth-token: <string>' \
-// //--header 'Accept: */*'
-func (tgBot *TgBot) undeployAccount() error {
-	url := fmt.Sprintf("%s/users/current/accounts/%s/undeploy?executeForAllReplicas=true", tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID)
-
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "*/*")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		return errors.New("failed to undeploy account")
-	}
-
-	return nil
-}
-
-type MetaApiAccount struct {
-	ID               string `json:"_id"`
-	State            string `json:"state"`
-	ConnectionStatus string `json:"connectionStatus"`
-}
-
-// curl --location 'https://mt-client-api-v1.london.agiliumtrade.ai/users/current/accounts/<string>' \
-// --header 'auth-token: <string>' \
-// --header 'Accept: */*'
-func (tgBot *TgBot) getAccount() (MetaApiAccount, error) {
-	url := fmt.Sprintf("%s/users/current/accounts/%s", tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("auth-token", tgBot.AppConfig.MetaApiToken)
-	req.Header.Add("Accept", "*/*")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return MetaApiAccount{}, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return MetaApiAccount{}, errors.New("failed to fetch account")
-	}
-
-	var account MetaApiAccount
-	err = json.NewDecoder(resp.Body).Decode(&account)
-	if err != nil {
-		return MetaApiAccount{}, err
-	}
-
-	return account, nil
-}
-
 // get the total possible loss of the day
 func (tgBot *TgBot) getOngoingLossRiskTotal(todayPositions []MetaApiPosition) float64 {
 	// get today positiions from metaapi
 	if todayPositions == nil {
-		pos, errP := tgBot.currentUserPositions(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken)
+		pos, errP := tgBot.Broker.Positions()
 		if errP != nil {
 			println("Error getting today positions: ", errP)
 		}
@@ -2502,9 +1865,8 @@ func (tgBot *TgBot) getOngoingLossRiskTotal(todayPositions []MetaApiPosition) fl
 
 	totalLoss := 0.0
 	for _, position := range todayPositions {
-		pipsLoss := calculatePips(position.OpenPrice, position.StopLoss, position.Symbol)
-		// loss in money
-		totalLoss += pipsLoss * position.Volume
+		// loss in account currency
+		totalLoss += position.riskedLoss(tgBot.specifications)
 	}
 
 	return totalLoss
@@ -34,6 +34,49 @@ type TradeRequest struct {
 	EntryZoneMin float64 `json:"entryZoneMin,omitempty"`
 	EntryZoneMax float64 `json:"entryZoneMax,omitempty"`
 	MessageId    *int    `json:"messageId,omitempty"`
+	// parser which read the signal : rules or llm
+	Parser string `json:"parser,omitempty"`
+	// MARKET (or empty), LIMIT or STOP
+	OrderKind string `json:"orderKind,omitempty"`
+	// price of a pending order
+	OpenPrice float64 `json:"openPrice,omitempty"`
+	// strategy used when the signal was placed
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// kind of order given by a signal
+const (
+	OrderKindMarket = "MARKET"
+	OrderKindLimit  = "LIMIT"
+	OrderKindStop   = "STOP"
+)
+
+// a limit or stop order
+func (tr *TradeRequest) IsPendingOrder() bool {
+	return tr.OrderKind == OrderKindLimit || tr.OrderKind == OrderKindStop
+}
+
+// price of the pending order, the side of the entry zone reached first. 0 when the signal has no entry
+func (tr *TradeRequest) PendingOpenPrice() float64 {
+	if tr.EntryZoneMin <= 0 {
+		return 0
+	}
+	if tr.EntryZoneMax <= 0 {
+		return tr.EntryZoneMin
+	}
+	// a buy limit is reached from above, a buy stop from below
+	if (tr.ActionType == "ORDER_TYPE_BUY") == (tr.OrderKind == OrderKindLimit) {
+		return tr.EntryZoneMax
+	}
+	return tr.EntryZoneMin
+}
+
+// metaapi order type of the trade request : ORDER_TYPE_BUY_LIMIT, ORDER_TYPE_SELL_STOP...
+func (tr *TradeRequest) MetaApiActionType() string {
+	if !tr.IsPendingOrder() {
+		return tr.ActionType
+	}
+	return tr.ActionType + "_" + tr.OrderKind
 }
 
 // generate a trade request unique identifier base on field values without volumes
@@ -51,9 +94,26 @@ func (tr *TradeRequest) GenerateTradeRequestKey() string {
 	return todayString + tr.ActionType + tr.Symbol + tp1String + tp2String + tp3String + slString + ezMinString + ezMaxString
 }
 
+// get the take profit value of a given tp number (1, 2 or 3)
+func (tr *TradeRequest) TakeProfit(tpNumber int) float64 {
+	switch tpNumber {
+	case 1:
+		return tr.TakeProfit1
+	case 2:
+		return tr.TakeProfit2
+	case 3:
+		return tr.TakeProfit3
+	}
+	return 0
+}
+
 type TradeUpdateRequest struct {
 	UpdateType string   `json:"updateType,omitempty"`
 	Value      *float64 `json:"value,omitempty"`
+	// PARTIAL_CLOSE : percentage of the volume to close
+	Percentage *float64 `json:"percentage,omitempty"`
+	// MODIFY_TAKEPROFIT : take profit to modify, all of them when absent
+	TpNumber *int `json:"tpNumber,omitempty"`
 }
 
 const (
@@ -0,0 +1,498 @@
+package tgbot
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// what is done with the open positions of a symbol before a news event of its currencies
+const (
+	NewsActionNone = "NONE"
+	// stop loss to the entry when in profit, halfway to the price otherwise
+	NewsActionTighten = "TIGHTEN"
+	NewsActionFlatten = "FLATTEN"
+)
+
+var NewsActions = []string{NewsActionNone, NewsActionTighten, NewsActionFlatten}
+
+// impact of the news events
+const (
+	NewsImpactLow = iota + 1
+	NewsImpactMedium
+	NewsImpactHigh
+)
+
+type newsEvent struct {
+	Time     time.Time
+	Currency string
+	Impact   int
+	Title    string
+}
+
+// key of the event, a position is protected once for each event
+func (e newsEvent) key() string {
+	return strconv.FormatInt(e.Time.Unix(), 10) + "_" + e.Currency + "_" + e.Title
+}
+
+func (e newsEvent) String() string {
+	return fmt.Sprintf("%s %s %s (%s)", e.Time.UTC().Format("Mon 02 Jan 15:04"), e.Currency, e.Title, impactName(e.Impact))
+}
+
+// impact from the usual notations of the calendars : high, 3, red...
+func parseImpact(value string) int {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	switch {
+	case strings.HasPrefix(value, "HIGH"), value == "3", value == "RED":
+		return NewsImpactHigh
+	case strings.HasPrefix(value, "MED"), strings.HasPrefix(value, "MODERATE"), value == "2", value == "ORANGE":
+		return NewsImpactMedium
+	case strings.HasPrefix(value, "LOW"), value == "1", value == "YELLOW":
+		return NewsImpactLow
+	}
+	return 0
+}
+
+func impactName(impact int) string {
+	switch impact {
+	case NewsImpactHigh:
+		return "HIGH"
+	case NewsImpactMedium:
+		return "MEDIUM"
+	case NewsImpactLow:
+		return "LOW"
+	}
+	return "UNKNOWN"
+}
+
+// newsCalendar keep the events of the news file, reloaded when the file changes
+type newsCalendar struct {
+	mu        sync.RWMutex
+	path      string
+	modTime   time.Time
+	events    []newsEvent
+	minImpact int
+	before    time.Duration
+	after     time.Duration
+}
+
+func loadNewsCalendar(path string, minImpact string, before time.Duration, after time.Duration) (*newsCalendar, error) {
+	calendar := &newsCalendar{path: path, minImpact: parseImpact(minImpact), before: before, after: after}
+	if calendar.minImpact == 0 {
+		return nil, fmt.Errorf("invalid news impact %s", minImpact)
+	}
+	if path == "" {
+		return calendar, nil
+	}
+	if err := calendar.reload(); err != nil {
+		return nil, err
+	}
+	return calendar, nil
+}
+
+// read the file again when it has been modified
+func (c *newsCalendar) reload() error {
+	if c.path == "" {
+		return nil
+	}
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("error reading news calendar: %w", err)
+	}
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	file, err := os.Open(c.path)
+	if err != nil {
+		return fmt.Errorf("error reading news calendar: %w", err)
+	}
+	defer file.Close()
+	var events []newsEvent
+	if strings.EqualFold(filepath.Ext(c.path), ".ics") {
+		events, err = parseNewsICS(file)
+	} else {
+		events, err = parseNewsCSV(file)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing news calendar: %w", err)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	c.mu.Lock()
+	c.events = events
+	c.modTime = info.ModTime()
+	c.mu.Unlock()
+	log.Printf("News calendar loaded: %d events", len(events))
+	return nil
+}
+
+func (tgBot *TgBot) reloadNewsCalendar() {
+	if err := tgBot.news.reload(); err != nil {
+		log.Printf("Error reloading news calendar: %v", err)
+	}
+}
+
+// csv with a header naming the columns time, currency, impact and title (event or name). times are RFC 3339 or
+// "2006-01-02 15:04" in UTC, or a date and a time of day in two columns (events without a time of day are skipped)
+func parseNewsCSV(reader io.Reader) ([]newsEvent, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := map[string]int{"time": 0, "currency": 1, "impact": 2, "title": 3}
+	header := false
+	// date and time of day in two columns ("Date,Time,Currency,Impact,Event" of ForexFactory)
+	dateColumn, timeColumn := -1, -1
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "date":
+			dateColumn, header = i, true
+		case "time":
+			timeColumn, header = i, true
+		case "datetime":
+			columns["time"], header = i, true
+		case "currency", "country":
+			columns["currency"], header = i, true
+		case "impact":
+			columns["impact"], header = i, true
+		case "title", "event", "name":
+			columns["title"], header = i, true
+		}
+	}
+	if header {
+		records = records[1:]
+	}
+	switch {
+	case dateColumn >= 0 && timeColumn >= 0:
+		columns["date"], columns["time"] = dateColumn, timeColumn
+	case dateColumn >= 0:
+		columns["time"] = dateColumn
+	case timeColumn >= 0:
+		columns["time"] = timeColumn
+	}
+	var events []newsEvent
+	for line, record := range records {
+		field := func(name string) string {
+			if column, ok := columns[name]; ok && column < len(record) {
+				return strings.TrimSpace(record[column])
+			}
+			return ""
+		}
+		value := field("time")
+		if _, ok := columns["date"]; ok {
+			if !newsTimeOfDayPattern.MatchString(value) {
+				// "All Day", "Tentative" : no time to protect the positions at
+				continue
+			}
+			value = field("date") + " " + strings.ToLower(value)
+		}
+		eventTime, err := parseNewsTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+1, err)
+		}
+		events = append(events, newsEvent{
+			Time:     eventTime,
+			Currency: strings.ToUpper(field("currency")),
+			Impact:   parseImpact(field("impact")),
+			Title:    field("title"),
+		})
+	}
+	return events, nil
+}
+
+// "8:30am", "14:00", "14:00:00"
+var newsTimeOfDayPattern = regexp.MustCompile(`(?i)^\d{1,2}:\d{2}(:\d{2})?\s*([ap]m)?$`)
+
+func parseNewsTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	// date and time of day joined from two columns, month first like the ForexFactory exports
+	for _, date := range []string{"2006-01-02", "01-02-2006", "01/02/2006", "2006/01/02"} {
+		for _, clock := range []string{"15:04", "15:04:05", "3:04pm", "3:04 pm"} {
+			if t, err := time.ParseInLocation(date+" "+clock, value, time.UTC); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s", value)
+}
+
+// VEVENTs of an ics file. the currency is taken from CATEGORIES or the first word of SUMMARY, the impact from
+// X-IMPACT, CATEGORIES, "Impact:" in DESCRIPTION or PRIORITY
+func parseNewsICS(reader io.Reader) ([]newsEvent, error) {
+	// unfold the lines continued on the next ones
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var events []newsEvent
+	var event *newsEvent
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// parameters keep their case, time zones are case sensitive
+		name, params, _ := strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &newsEvent{}
+		case event == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			if !event.Time.IsZero() {
+				events = append(events, *event)
+			}
+			event = nil
+		case name == "DTSTART":
+			eventTime, err := parseICSTime(value, params)
+			if err != nil {
+				return nil, err
+			}
+			event.Time = eventTime
+		case name == "SUMMARY":
+			event.Title = unescapeICS(value)
+			if word, _, _ := strings.Cut(event.Title, " "); event.Currency == "" && StringInSlice(word, newsCurrencies) {
+				event.Currency = word
+				event.Title = strings.TrimSpace(strings.TrimPrefix(event.Title, word))
+			}
+		case name == "CATEGORIES":
+			for _, category := range strings.Split(value, ",") {
+				category = strings.TrimSpace(category)
+				if impact := parseImpact(category); impact > 0 {
+					event.Impact = impact
+				} else if isCurrencyCode(category) {
+					event.Currency = category
+				}
+			}
+		case name == "X-IMPACT":
+			event.Impact = parseImpact(value)
+		case name == "DESCRIPTION" && event.Impact == 0:
+			if _, impact, found := strings.Cut(unescapeICS(value), "Impact:"); found {
+				impact, _, _ = strings.Cut(strings.TrimSpace(impact), "\n")
+				event.Impact = parseImpact(impact)
+			}
+		case name == "PRIORITY" && event.Impact == 0:
+			// 1 to 4 high, 5 medium, 6 to 9 low
+			if priority, err := strconv.Atoi(value); err == nil && priority > 0 {
+				event.Impact = NewsImpactLow
+				if priority <= 4 {
+					event.Impact = NewsImpactHigh
+				} else if priority == 5 {
+					event.Impact = NewsImpactMedium
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// DTSTART in UTC ("Z"), in the TZID time zone or in UTC without zone
+func parseICSTime(value string, params string) (time.Time, error) {
+	location := time.UTC
+	for _, param := range strings.Split(params, ";") {
+		if key, zone, ok := strings.Cut(param, "="); ok && strings.EqualFold(key, "TZID") {
+			if l, err := time.LoadLocation(zone); err == nil {
+				location = l
+			}
+		}
+	}
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid event time %s", value)
+}
+
+func unescapeICS(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// currencies of the economic calendars, a summary starting with another word ("CPI m/m") has no currency
+var newsCurrencies = []string{"USD", "EUR", "GBP", "JPY", "CHF", "AUD", "NZD", "CAD", "CNY"}
+
+func isCurrencyCode(value string) bool {
+	if len(value) != 3 {
+		return false
+	}
+	for _, r := range value {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// event of the currencies with the minimum impact whose blackout window contains the time, nil when none
+func (c *newsCalendar) blackout(currencies []string, t time.Time) *newsEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, event := range c.events {
+		if event.Impact < c.minImpact || !StringInSlice(event.Currency, currencies) {
+			continue
+		}
+		if !t.Before(event.Time.Add(-c.before)) && !t.After(event.Time.Add(c.after)) {
+			return &event
+		}
+	}
+	return nil
+}
+
+// event of the currencies with the minimum impact released within the before window of the time, nil when none
+func (c *newsCalendar) coming(currencies []string, t time.Time) *newsEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, event := range c.events {
+		if event.Impact < c.minImpact || !StringInSlice(event.Currency, currencies) {
+			continue
+		}
+		if !t.Before(event.Time.Add(-c.before)) && t.Before(event.Time) {
+			return &event
+		}
+	}
+	return nil
+}
+
+// events with the minimum impact between two times
+func (c *newsCalendar) upcoming(from time.Time, to time.Time) []newsEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var events []newsEvent
+	for _, event := range c.events {
+		if event.Impact >= c.minImpact && !event.Time.Before(from) && !event.Time.After(to) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// currencies the price of a symbol depends on : the ones of the specification, or the pair, or the country of the
+// index
+func symbolCurrencies(specifications *symbolSpecificationCache, symbol string) []string {
+	if specification := specifications.get(symbol); specification != nil && specification.BaseCurrency != "" {
+		currencies := []string{specification.BaseCurrency}
+		if specification.ProfitCurrency != "" && specification.ProfitCurrency != specification.BaseCurrency {
+			currencies = append(currencies, specification.ProfitCurrency)
+		}
+		return currencies
+	}
+	upper := strings.ToUpper(symbol)
+	indices := map[string]string{
+		"US30": "USD", "US100": "USD", "US500": "USD", "NAS100": "USD", "SPX500": "USD", "USTEC": "USD",
+		"GER40": "EUR", "DE40": "EUR", "GER30": "EUR", "FRA40": "EUR", "EU50": "EUR",
+		"UK100": "GBP", "JP225": "JPY", "JPN225": "JPY", "AUS200": "AUD", "HK50": "HKD",
+	}
+	for prefix, currency := range indices {
+		if strings.HasPrefix(upper, prefix) {
+			return []string{currency}
+		}
+	}
+	if len(upper) >= 6 && isCurrencyCode(upper[:3]) && isCurrencyCode(upper[3:6]) {
+		return []string{upper[:3], upper[3:6]}
+	}
+	// oil and the other symbols are quoted in USD
+	return []string{"USD"}
+}
+
+// news event blocking the entries on a symbol now, nil when none
+func (tgBot *TgBot) newsBlackout(symbol string) *newsEvent {
+	return tgBot.news.blackout(symbolCurrencies(tgBot.specifications, symbol), time.Now())
+}
+
+// manageNewsBlackout protect the open positions of the symbols with a news event coming : stop loss tightened or
+// position closed, once for each event. nothing is done after the release, the positions opened then are kept
+func (tgBot *TgBot) manageNewsBlackout(positions []MetaApiPosition) {
+	action := tgBot.RedisClient.GetNewsPositionAction()
+	if action == NewsActionNone {
+		return
+	}
+	now := time.Now()
+	for _, position := range positions {
+		event := tgBot.news.coming(symbolCurrencies(tgBot.specifications, position.Symbol), now)
+		if event == nil || tgBot.RedisClient.GetPositionNewsEvent(position.ID) == event.key() {
+			continue
+		}
+		// marked once done, a failed action is tried again on the next check
+		positionMessageId := int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+		if action == NewsActionFlatten {
+			if err := tgBot.doClosePosition(position); err != nil {
+				log.Printf("Error closing %s before news: %v", position.ID, err)
+				tgBot.sendMessage(fmt.Sprintf("❌ Failed closing trade before news\n📰 %s\n❌ Error: %s", event,
+					tradeErrorReason(err)), positionMessageId)
+				continue
+			}
+			tgBot.RedisClient.SetPositionNewsEvent(position.ID, event.key())
+			tgBot.sendMessage(fmt.Sprintf("📰 Position closed before news\n📰 %s\n➡️Position ID: %s", event, position.ID),
+				positionMessageId)
+			continue
+		}
+		newStopLoss := newsStopLoss(tgBot.specifications, position)
+		if newStopLoss == 0 {
+			continue
+		}
+		metaApiRequest := MetaApiTradeRequest{
+			ActionType: "POSITION_MODIFY",
+			StopLoss:   &newStopLoss,
+			PositionID: &position.ID,
+			TakeProfit: &position.TakeProfit,
+		}
+		if _, err := tgBot.Executor.Execute(metaApiRequest); err != nil {
+			log.Printf("Error tightening stop loss of %s before news: %v", position.ID, err)
+			tgBot.sendMessage(fmt.Sprintf("❌ Failed moving SL before news\n📰 %s\n❌ Error: %s", event,
+				tradeErrorReason(err)), positionMessageId)
+			continue
+		}
+		tgBot.RedisClient.SetPositionNewsEvent(position.ID, event.key())
+		tgBot.sendMessage(fmt.Sprintf("📰 SL tightened before news\n📰 %s\n➡️Position ID: %s\nSL: %.2f -> %.2f", event,
+			position.ID, position.StopLoss, newStopLoss), positionMessageId)
+	}
+}
+
+// tightened stop loss : the entry when the price is beyond it, halfway between the stop loss and the price otherwise.
+// 0 when the stop loss is not improved
+func newsStopLoss(specifications *symbolSpecificationCache, position MetaApiPosition) float64 {
+	newStopLoss := calculateNewStopLossPriceForBreakeven(specifications, position.OpenPrice, position.Type, position.Symbol)
+	if !priceReached(position, newStopLoss) {
+		if position.StopLoss == 0 || position.CurrentPrice == 0 {
+			return 0
+		}
+		newStopLoss = (position.StopLoss + position.CurrentPrice) / 2
+	}
+	if !isBetterStopLoss(position.Type, newStopLoss, position.StopLoss) {
+		return 0
+	}
+	return newStopLoss
+}
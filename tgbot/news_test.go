@@ -0,0 +1,119 @@
+package tgbot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNewsCSV(t *testing.T) {
+	cpi := newsEvent{Time: time.Date(2025, 10, 15, 12, 30, 0, 0, time.UTC), Currency: "USD", Impact: NewsImpactHigh, Title: "CPI m/m"}
+	tests := []struct {
+		name    string
+		csv     string
+		want    []newsEvent
+		wantErr bool
+	}{
+		{
+			name: "header with a datetime column",
+			csv:  "time,currency,impact,title\n2025-10-15T12:30:00Z,usd,High,CPI m/m\n",
+			want: []newsEvent{cpi},
+		},
+		{
+			name: "columns in another order",
+			csv:  "Event,Impact,Country,Date\nCPI m/m,3,USD,2025-10-15 12:30\n",
+			want: []newsEvent{cpi},
+		},
+		{
+			name: "no header",
+			csv:  "2025-10-15 12:30:00,USD,red,CPI m/m\n",
+			want: []newsEvent{cpi},
+		},
+		{
+			name: "forexfactory export with date and time columns",
+			csv: "Title,Country,Date,Time,Impact,Forecast,Previous\n" +
+				"CPI m/m,USD,10-15-2025,12:30pm,High,0.3%,0.4%\n" +
+				"Bank Holiday,EUR,10-15-2025,All Day,Holiday,,\n" +
+				"GDP q/q,GBP,10-16-2025,6:00am,Medium,,\n",
+			want: []newsEvent{cpi, {Time: time.Date(2025, 10, 16, 6, 0, 0, 0, time.UTC), Currency: "GBP",
+				Impact: NewsImpactMedium, Title: "GDP q/q"}},
+		},
+		{
+			name: "iso date and 24 hours time columns",
+			csv:  "Date,Time,Currency,Impact,Event\n2025-10-15,12:30,USD,High,CPI m/m\n2025-10-15,Tentative,USD,Low,Speech\n",
+			want: []newsEvent{cpi},
+		},
+		{
+			name:    "invalid time",
+			csv:     "time,currency,impact,title\nsoon,USD,High,CPI m/m\n",
+			wantErr: true,
+		},
+		{name: "empty", csv: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := parseNewsCSV(strings.NewReader(test.csv))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(events, test.want) {
+				t.Errorf("events %v, want %v", events, test.want)
+			}
+		})
+	}
+}
+
+func TestParseNewsICS(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	tests := []struct {
+		name string
+		ics  string
+		want []newsEvent
+	}{
+		{
+			name: "currency and impact in the categories",
+			ics: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20251015T123000Z\r\nSUMMARY:CPI m/m\r\n" +
+				"CATEGORIES:USD,High\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []newsEvent{{Time: time.Date(2025, 10, 15, 12, 30, 0, 0, time.UTC), Currency: "USD",
+				Impact: NewsImpactHigh, Title: "CPI m/m"}},
+		},
+		{
+			name: "currency in the summary and impact in the description",
+			ics: "BEGIN:VEVENT\nDTSTART;TZID=America/New_York:20251015T083000\nSUMMARY:USD Core CPI m/m\n" +
+				"DESCRIPTION:Forecast: 0.3%\\nImpact: Medium\\nPrevious: 0.4%\nEND:VEVENT\n",
+			want: []newsEvent{{Time: time.Date(2025, 10, 15, 8, 30, 0, 0, newYork), Currency: "USD",
+				Impact: NewsImpactMedium, Title: "Core CPI m/m"}},
+		},
+		{
+			name: "folded summary, escaped comma and priority",
+			ics:  "BEGIN:VEVENT\nDTSTART:20251016T060000\nSUMMARY:GBP GDP\n  q/q\\, prelim\nPRIORITY:7\nEND:VEVENT\n",
+			want: []newsEvent{{Time: time.Date(2025, 10, 16, 6, 0, 0, 0, time.UTC), Currency: "GBP",
+				Impact: NewsImpactLow, Title: "GDP q/q, prelim"}},
+		},
+		{
+			name: "event without start",
+			ics:  "BEGIN:VEVENT\nSUMMARY:USD Holiday\nEND:VEVENT\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := parseNewsICS(strings.NewReader(test.ics))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(test.want) {
+				t.Fatalf("events %v, want %v", events, test.want)
+			}
+			for i := range events {
+				if !events[i].Time.Equal(test.want[i].Time) || events[i].Currency != test.want[i].Currency ||
+					events[i].Impact != test.want[i].Impact || events[i].Title != test.want[i].Title {
+					t.Errorf("event %v, want %v", events[i], test.want[i])
+				}
+			}
+		})
+	}
+}
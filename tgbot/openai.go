@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"log"
@@ -11,35 +12,27 @@ import (
 	"strings"
 )
 
-func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []string) (*TradeRequest, error) {
+// ParseNewMessage parse a new signal with the llm
+func (p *llmSignalParser) ParseNewMessage(message string, symbols []string) (*TradeRequest, error) {
 	// Créer des exemples d'instructions avec actionType et zone d'entrée inclus
 	// Créer une requête ChatCompletion pour le message à analyser
-	clientOpenApi := openai.NewClient(apiKey)
-	f := fmt.Sprintf("Voici les symboles disponibles: %v", symbols)
-	if f == "" {
-
-	}
-	resp, err := clientOpenApi.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				// inform ai about available symbols
-				{
-					Role:    "user",
-					Content: fmt.Sprintf("Voici les symboles disponibles: %v", symbols),
-				},
-				{
-					Role:    "assistant",
-					Content: `D'accord je vais les prendre en compte`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: 🛑 JE VENDS BTCUSD \n\nZone d’entrée : 62 700 - 62 650\n\n⚠️ Adaptez le lot en fonction de votre capital, Appliquez la stratégie des 3TP\n\n🎯 TP1 : 62 500\n🎯 TP2 : 62 000\n🎯 TP3 : Ouvert\n\nSL : 63 700 🔒",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+	messages := []ChatMessage{
+		// inform ai about available symbols
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Voici les symboles disponibles: %v", symbols),
+		},
+		{
+			Role:    "assistant",
+			Content: `D'accord je vais les prendre en compte`,
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: 🛑 JE VENDS BTCUSD \n\nZone d’entrée : 62 700 - 62 650\n\n⚠️ Adaptez le lot en fonction de votre capital, Appliquez la stratégie des 3TP\n\n🎯 TP1 : 62 500\n🎯 TP2 : 62 000\n🎯 TP3 : Ouvert\n\nSL : 63 700 🔒",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "actionType": "ORDER_TYPE_SELL",
   "symbol": "BTCUSD",
   "stopLoss": 63700,
@@ -49,31 +42,31 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMin": 62650,
   "entryZoneMax": 62700
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "BUY BTCUSD \n\nEntry price 62300\n\n🔴 SL : 61300\n\n🟢 TP1 : 62500\n\n🟢 TP2 : 62800\n\n🟢 TP3 : 63300\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "BUY BTCUSD \n\nEntry price 62300\n\n🔴 SL : 61300\n\n🟢 TP1 : 62500\n\n🟢 TP2 : 62800\n\n🟢 TP3 : 63300\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "BTCUSD",
   "stopLoss": 61300,
   "takeProfit1": 62500,
   "takeProfit2": 62800,
-  "takeProfit3": 63300", 
+  "takeProfit3": 63300,
   "entryZoneMin": 62300,
   "entryZoneMax": -1 
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "BUY BTCUSD \n\nEntry price 62200\n\n🔴 SL : 61300\n\n🟢 TP1 : 62500\n\n🟢 TP2 : 62800\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "BUY BTCUSD \n\nEntry price 62200\n\n🔴 SL : 61300\n\n🟢 TP1 : 62500\n\n🟢 TP2 : 62800\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "BTCUSD",
   "stopLoss": 61300,
@@ -83,14 +76,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMin": 62200,
   "entryZoneMax": -1 
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "SELL BTCUSD\n\nEntry price 61340\n\n🔴 SL : 62340\n\n🟢 TP1 : 61100\n\n🟢 TP2 : OUVERT\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "SELL BTCUSD\n\nEntry price 61340\n\n🔴 SL : 62340\n\n🟢 TP1 : 61100\n\n🟢 TP2 : OUVERT\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "actionType": "ORDER_TYPE_SELL",
   "symbol": "BTCUSD",
   "stopLoss": 62340,
@@ -100,14 +93,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMin": 61340,
   "entryZoneMax": -1 
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "SELL BTCUSD\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "SELL BTCUSD\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "actionType": "ORDER_TYPE_SELL",
   "symbol": "BTCUSD",
   "stopLoss": 0,
@@ -117,14 +110,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMin": -1,
   "entryZoneMax": -1 
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "🔴 VENTE GOLD (2)🍯 \n\nZone d'entrée : 2667 - 2666.5",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "🔴 VENTE GOLD (2)🍯 \n\nZone d'entrée : 2667 - 2666.5",
+		},
+		{
+			Role: "assistant",
+			Content: `{
 				 "actionType": "ORDER_TYPE_SELL",
 				 "symbol": "XAUUSD",
 				 "stopLoss": 0,
@@ -134,14 +127,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
 				 "entryZoneMin": 2666.5,
 				 "entryZoneMax": 2667
 				}`,
-				},
-				{
-					Role:    "user",
-					Content: "🔴 VENTE GOLD (2)🍯 \n\nZone d'entrée : 2667 - 2666.5\n\n🚨 Lot à adapter selon votre capital \n\n🙉 TP1 : 2663\n🙊 TP2 : 2661\n🙈 TP3 : OUVERT\n\n🔴 SL : 2671",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "🔴 VENTE GOLD (2)🍯 \n\nZone d'entrée : 2667 - 2666.5\n\n🚨 Lot à adapter selon votre capital \n\n🙉 TP1 : 2663\n🙊 TP2 : 2661\n🙈 TP3 : OUVERT\n\n🔴 SL : 2671",
+		},
+		{
+			Role: "assistant",
+			Content: `{
 				 "actionType": "ORDER_TYPE_SELL",
 				 "symbol": "XAUUSD",
 				 "stopLoss": 2671,
@@ -151,14 +144,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
 				 "entryZoneMin": 2666.5,
 				 "entryZoneMax": 2667
 				}`,
-				},
-				{
-					Role:    "user",
-					Content: "USDJPY BUY Entry at 148.15\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = 149.33\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: ` {
+		},
+		{
+			Role:    "user",
+			Content: "USDJPY BUY Entry at 148.15\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = 149.33\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: ` {
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "USDJPY",
   "stopLoss": 147.60,
@@ -169,14 +162,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMax": -1
 }
 `,
-				},
-				{
-					Role:    "user",
-					Content: "USDJPY BUY Entry at 148.15\n DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: ` {
+		},
+		{
+			Role:    "user",
+			Content: "USDJPY BUY Entry at 148.15\n DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: ` {
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "USDJPY",
   "stopLoss": 0,
@@ -187,14 +180,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMax": -1
 }
 `,
-				},
-				{
-					Role:    "user",
-					Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = 149.33\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: ` {
+		},
+		{
+			Role:    "user",
+			Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = 149.33\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: ` {
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "USDJPY",
   "stopLoss": 147.60,
@@ -205,14 +198,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMax": -1 
 }
 `,
-				},
-				{
-					Role:    "user",
-					Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: ` {
+		},
+		{
+			Role:    "user",
+			Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: ` {
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "USDJPY",
   "stopLoss": 147.60,
@@ -223,14 +216,14 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMax": -1 
 }
 `,
-				},
-				{
-					Role:    "user",
-					Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = OPEN\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
-				},
-				{
-					Role: "assistant",
-					Content: ` {
+		},
+		{
+			Role:    "user",
+			Content: "USDJPY BUY Entry at 148.20\n\n🔴Stop loss :  147.60\n\n🟢Take profit 1 = 148.53\n🟢Take profit 2 = 148.83\n🟢Take profit 3 = OPEN\n\n⚠️ DISCLAIMER : Il ne s’agit en aucun cas d’un conseil en investissement, mais uniquement d’une alerte à titre éducatif",
+		},
+		{
+			Role: "assistant",
+			Content: ` {
   "actionType": "ORDER_TYPE_BUY",
   "symbol": "USDJPY",
   "stopLoss": 147.60,
@@ -241,33 +234,68 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
   "entryZoneMax": -1 
 }
 `,
-				},
-				{
-					Role:    "user",
-					Content: message, // Message reçu à analyser
-				},
-			},
 		},
-	)
-
-	if err != nil {
-		fmt.Printf("ChatCompletion error: %v\n", err)
-		return nil, err
-	} else {
-		// Afficher la réponse du modèle
-		fmt.Println("Réponse du modèle :", resp.Choices[0].Message.Content)
+		{
+			Role:    "user",
+			Content: "XAUUSD SELL LIMIT 2675\n\nSL 2685\nTP1 2665\nTP2 2655",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "actionType": "ORDER_TYPE_SELL",
+  "symbol": "XAUUSD",
+  "stopLoss": 2685,
+  "takeProfit1": 2665,
+  "takeProfit2": 2655,
+  "takeProfit3": 0,
+  "entryZoneMin": 2675,
+  "entryZoneMax": -1,
+  "orderKind": "LIMIT"
+}`,
+		},
+		{
+			Role:    "user",
+			Content: "EURUSD BUY STOP above 1.0920\n\nSL 1.0890\nTP 1.0960",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "actionType": "ORDER_TYPE_BUY",
+  "symbol": "EURUSD",
+  "stopLoss": 1.0890,
+  "takeProfit1": 1.0960,
+  "takeProfit2": 0,
+  "takeProfit3": 0,
+  "entryZoneMin": 1.0920,
+  "entryZoneMax": -1,
+  "orderKind": "STOP"
+}`,
+		},
+		{
+			Role:    "user",
+			Content: message, // Message reçu à analyser
+		},
 	}
 
-	// Extraction de la réponse
-	parsedContent := resp.Choices[0].Message.Content
-
 	// Initialiser un objet TradeRequest
 	var tradeRequest TradeRequest
-
-	// Parser la réponse JSON dans l'objet TradeRequest
-	errJson := json.Unmarshal([]byte(parsedContent), &tradeRequest)
-	if errJson != nil {
-		return nil, errJson
+	err := completeJSON(p.llm, LLMTaskSignal, messages, tradeRequestSchema, &tradeRequest, func() error {
+		if tradeRequest.ActionType != "ORDER_TYPE_BUY" && tradeRequest.ActionType != "ORDER_TYPE_SELL" {
+			return fmt.Errorf("actionType %q must be ORDER_TYPE_BUY or ORDER_TYPE_SELL", tradeRequest.ActionType)
+		}
+		if tradeRequest.Symbol == "" {
+			return errors.New("symbol is required")
+		}
+		if tradeRequest.OrderKind == "" {
+			tradeRequest.OrderKind = OrderKindMarket
+		}
+		if tradeRequest.OrderKind != OrderKindMarket && !tradeRequest.IsPendingOrder() {
+			return fmt.Errorf("orderKind %q must be MARKET, LIMIT or STOP", tradeRequest.OrderKind)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// if generated symbol is not in list of symbol take the symbole that contain the full symbol name in the list
@@ -281,10 +309,11 @@ func (tgBot *TgBot) GptParseNewMessage(message string, apiKey string, symbols []
 
 		}
 	}
+	tradeRequest.Parser = ParserLLM
 	/// display trade log in perfect json readable
-	log.Println("TradeRequest struct: %+v\n", tradeRequest)
+	log.Printf("TradeRequest struct: %+v\n", tradeRequest)
 
-	return &tradeRequest, errJson
+	return &tradeRequest, nil
 }
 
 func StringInSlice(symbol string, symbols []string) bool {
@@ -296,350 +325,390 @@ func StringInSlice(symbol string, symbols []string) bool {
 	return false
 }
 
-func GptParseUpdateMessage(message string, apiKey string) (*TradeUpdateRequest, error) {
+// ParseUpdateMessage parse an update of an ongoing signal with the llm
+func (p *llmSignalParser) ParseUpdateMessage(message string) (*TradeUpdateRequest, error) {
 	// here we parse message made for an update on a current position to modify or close trade
-	clientOpenApi := openai.NewClient(apiKey)
-	resp, err := clientOpenApi.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role: "user",
-					Content: "Voici les different update types qui existe : TP1_HIT , TP2_HIT, TP3_HIT, TP4_HIT ," +
-						" STOPLOSS_HIT, CLOSE_TRADE, MODIFY_STOPLOSS , SL_TO_ENTRY_PRICE , SECURE_PROFIT",
-				},
-				{
-					Role:    "assistant",
-					Content: `D'accord je ne mettrais que ces updates types dans les json que je vais generer'`,
-				},
-				{
-					Role:    "user",
-					Content: "J'attend une reponse en JSON avec les exemple que je vais te proposer",
-				},
-				{
-					Role:    "assistant",
-					Content: `Ok je vais repondre en json`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: TP1 TOUCHÉ 💸\n\nSL AU PRIX D'ENTRÉE",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+	messages := []ChatMessage{
+		{
+			Role: "user",
+			Content: "Voici les different update types qui existe : TP1_HIT , TP2_HIT, TP3_HIT, TP4_HIT ," +
+				" STOPLOSS_HIT, CLOSE_TRADE, MODIFY_STOPLOSS , SL_TO_ENTRY_PRICE , SECURE_PROFIT , PARTIAL_CLOSE ," +
+				" MODIFY_TAKEPROFIT. PARTIAL_CLOSE met le pourcentage à fermer dans percentage, MODIFY_TAKEPROFIT met" +
+				" le nouveau take profit dans value et le numero du TP dans tpNumber (absent si tous les TP)",
+		},
+		{
+			Role:    "assistant",
+			Content: `D'accord je ne mettrais que ces updates types dans les json que je vais generer'`,
+		},
+		{
+			Role:    "user",
+			Content: "J'attend une reponse en JSON avec les exemple que je vais te proposer",
+		},
+		{
+			Role:    "assistant",
+			Content: `Ok je vais repondre en json`,
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: TP1 TOUCHÉ 💸\n\nSL AU PRIX D'ENTRÉE",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: TP2 TOUCHÉ 💸",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: TP2 TOUCHÉ 💸",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP2_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: BTCUSD - TP1 HIT ✅",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: BTCUSD - TP1 HIT ✅",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: BTCUSD - TP2 HIT ✅",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: BTCUSD - TP2 HIT ✅",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP2_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: BTCUSD - TP3 HIT ✅",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: BTCUSD - TP3 HIT ✅",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP3_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: SL HIT✖️ ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: SL HIT✖️ ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "STOPLOSS_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: SL TOUCHE✖️ ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: SL TOUCHE✖️ ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "STOPLOSS_HIT"
 }`,
-				},
+		},
 
-				{
-					Role:    "user",
-					Content: "Exemple: Fermez le trade \nmaintenant au prix d'entrée ✅",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		{
+			Role:    "user",
+			Content: "Exemple: Fermez le trade \nmaintenant au prix d'entrée ✅",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "CLOSE_TRADE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: PRENEZ LE TP1 MAINTENANT À 2660.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: PRENEZ LE TP1 MAINTENANT À 2660.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				}, {
-					Role:    "user",
-					Content: "Exemple: PRENEZ LE TP3 MAINTENANT À 2669.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		}, {
+			Role:    "user",
+			Content: "Exemple: PRENEZ LE TP3 MAINTENANT À 2669.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP3_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: PRENEZ LE TP2 MAINTENANT À 2665.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: PRENEZ LE TP2 MAINTENANT À 2665.5$ +25 PIPS ✔️\n\nSL AU PRIX D’ENTRÉE.",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP2_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: EURAUD - TP1 HIT✅",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: EURAUD - TP1 HIT✅",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: Fermez le trade \nmaintenant à 60220$",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: Fermez le trade \nmaintenant à 60220$",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "CLOSE_TRADE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: 🎯 TP1 +90PIPS",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: 🎯 TP1 +90PIPS",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: ⚠️ SL : 61700",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: ⚠️ SL : 61700",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "MODIFY_STOPLOSS",
   "value" : 61700
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: ⚠️ SL* 148",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: ⚠️ SL* 148",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "MODIFY_STOPLOSS",
   "value" : 148
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: ⚠️ Decaler le stop loss à  67500",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: ⚠️ Decaler le stop loss à  67500",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "MODIFY_STOPLOSS",
   "value" : 67500
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: ⚠️ Deplacer le SL à  149",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: ⚠️ Deplacer le SL à  149",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "MODIFY_STOPLOSS",
   "value" : 149
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Round 3 SNIPER ENTRY TP1//30pips✅\n\nLet’s CLOSE our profit now and set breakeven if you wish to hold now‼\n\nNonstop smashing TP with me ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Round 3 SNIPER ENTRY TP1//30pips✅\n\nLet’s CLOSE our profit now and set breakeven if you wish to hold now‼\n\nNonstop smashing TP with me ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT",
   "value" : 149
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: ⚠️ Securisez le trade",
-				},
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: ⚠️ Securisez le trade",
+		},
 
-				{
-					Role: "assistant",
-					Content: `{
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: +30pips securisez",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: +30pips securisez",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: Let’s move our SL to 2719.7 temporarily traders! ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: Let’s move our SL to 2719.7 temporarily traders! ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "MODIFY_STOPLOSS",
 	"value" : 2719.7
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: Boom 50 Pips Instant Recover 🔥\n\nSecure Half Now And Set Breakeven Don't be Greedy ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: Boom 50 Pips Instant Recover 🔥\n\nSecure Half Now And Set Breakeven Don't be Greedy ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: 30PIPS LET’S GOOOOO✅\n\nCLOSE our profit now‼\n\nLet's be smart. If you plan to keep chasing, secure your gains and trail your SL to the entry price.🙌 ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: 30PIPS LET’S GOOOOO✅\n\nCLOSE our profit now‼\n\nLet's be smart. If you plan to keep chasing, secure your gains and trail your SL to the entry price.🙌 ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple:Bangggg🔫🔫\n\nInstant money +20pips bro⚡  ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple:Bangggg🔫🔫\n\nInstant money +20pips bro⚡  ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: So easy! Non stop profit bro, our sell trade instant hit our 1st tp again 50pips+🤣🎊\n\n ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: So easy! Non stop profit bro, our sell trade instant hit our 1st tp again 50pips+🤣🎊\n\n ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SL_TO_ENTRY_PRICE"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Let’s close some profit!",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Let’s close some profit!",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "SECURE_PROFIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: "Exemple: 🤴 CHRIS GOLD FATHER 💰\nSee how accurate my mapping is? Even when it goes outside my zone, I don’t panic or tell you to close the entry I hold until it hits TP1 guys😎🔥\n\nxauusd buy : 66pips ($1,825usd ) \n\nThis is how you execute a true high-quality trade setup, aiming for exactly 1% daily not more, not less☝🏻\n\nLessgo secure highest entry now and only hold 1/2 lowest with breakeven📢  ",
-				},
-				{
-					Role: "assistant",
-					Content: `{
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: 🤴 CHRIS GOLD FATHER 💰\nSee how accurate my mapping is? Even when it goes outside my zone, I don’t panic or tell you to close the entry I hold until it hits TP1 guys😎🔥\n\nxauusd buy : 66pips ($1,825usd ) \n\nThis is how you execute a true high-quality trade setup, aiming for exactly 1% daily not more, not less☝🏻\n\nLessgo secure highest entry now and only hold 1/2 lowest with breakeven📢  ",
+		},
+		{
+			Role: "assistant",
+			Content: `{
   "updateType": "TP1_HIT"
 }`,
-				},
-				{
-					Role:    "user",
-					Content: message,
-				},
-			},
 		},
-	)
-
-	if err != nil {
-		fmt.Printf("ChatCompletion error: %v\n", err)
-		return nil, err
-	} else {
-		// Afficher la réponse du modèle
-		fmt.Println("Réponse du modèle :", resp.Choices[0].Message.Content)
+		{
+			Role:    "user",
+			Content: "Exemple: Close 50% now and let the rest run",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "updateType": "PARTIAL_CLOSE",
+  "percentage" : 50
+}`,
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: Fermez la moitié de vos positions",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "updateType": "PARTIAL_CLOSE",
+  "percentage" : 50
+}`,
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: Modifiez le TP2 à 2685",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "updateType": "MODIFY_TAKEPROFIT",
+  "value" : 2685,
+  "tpNumber" : 2
+}`,
+		},
+		{
+			Role:    "user",
+			Content: "Exemple: New TP 1.0920",
+		},
+		{
+			Role: "assistant",
+			Content: `{
+  "updateType": "MODIFY_TAKEPROFIT",
+  "value" : 1.0920
+}`,
+		},
+		{
+			Role:    "user",
+			Content: message,
+		},
 	}
 
-	// Extraction de la réponse
-	parsedContent := resp.Choices[0].Message.Content
-
 	// Initialiser un objet TradeRequest
 	var tradeRequest TradeUpdateRequest
-
-	// Parser la réponse JSON dans l'objet TradeRequest
-	errJson := json.Unmarshal([]byte(parsedContent), &tradeRequest)
-	if errJson != nil {
-		return nil, errJson
+	err := completeJSON(p.llm, LLMTaskUpdate, messages, tradeUpdateRequestSchema, &tradeRequest, func() error {
+		if !StringInSlice(tradeRequest.UpdateType, llmUpdateTypes) {
+			return fmt.Errorf("updateType %q is not one of %v", tradeRequest.UpdateType, llmUpdateTypes)
+		}
+		if tradeRequest.UpdateType == "PARTIAL_CLOSE" && (tradeRequest.Percentage == nil || *tradeRequest.Percentage <= 0 || *tradeRequest.Percentage > 100) {
+			return errors.New("PARTIAL_CLOSE needs a percentage between 0 and 100")
+		}
+		if tradeRequest.UpdateType == "MODIFY_TAKEPROFIT" && (tradeRequest.Value == nil || *tradeRequest.Value <= 0) {
+			return errors.New("MODIFY_TAKEPROFIT needs the new take profit in value")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Afficher l'objet TradeRequest
-	fmt.Printf("TradeRequest struct: %+v\n", tradeRequest)
-	return &tradeRequest, errJson
+	log.Printf("TradeRequest struct: %+v", tradeRequest)
+	return &tradeRequest, nil
 }
+
 func extractText(fichier string) (string, error) {
 	// Ouvre le fichier
 	file, err := os.Open(fichier)
@@ -669,7 +738,6 @@ type Trend struct {
 }
 
 func (tgBot *TgBot) GetSymbolTrend(symbol string) (*Trend, error) {
-	clientOpenApi := openai.NewClient(tgBot.AppConfig.OpenAiToken)
 	prompt := `
 	Analyse les informations actuelles du marché en ligne (comme les sites d’actualités financières et les analyses techniques) pour déterminer si la tendance pour la journée et les 3 derniers jours est principalement à la hausse ou à la baisse. 
 	Prends en compte les indicateurs techniques communs (comme la moyenne mobile, le RSI, MACD) et toute tendance notable observée dans les actualités récentes, ou les annonces économiques significatives pouvant influencer le marché. 
@@ -677,41 +745,40 @@ func (tgBot *TgBot) GetSymbolTrend(symbol string) (*Trend, error) {
 	Entrée : { "currency_pair": "` + symbol + `" }
 	Sortie attendue : { "trend": "upward" } ou { "trend": "downward" }
 	`
-	resp, err := clientOpenApi.CreateChatCompletion(
+	content, err := tgBot.LLM.Complete(
 		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT4Turbo20240409,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "Vous êtes un analyste de marché financier, fournissant des informations et analyses précises sur les tendances du marché.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			}})
+		LLMTaskTrend,
+		[]ChatMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: "Vous êtes un analyste de marché financier, fournissant des informations et analyses précises sur les tendances du marché.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		})
 	if err != nil {
-		fmt.Printf("ChatCompletion error: %v\n", err)
+		log.Printf("ChatCompletion error: %v", err)
 		return nil, err
 	} else {
 		// Afficher la réponse du modèle
-		fmt.Println("Réponse du modèle :", resp.Choices[0].Message.Content)
+		log.Printf("Réponse du modèle : %s", content)
 	}
 
 	// Extraction de la réponse
-	parsedContent := resp.Choices[0].Message.Content
+	parsedContent := content
 
 	// Initialiser un objet Trend
 	var trend Trend
 
 	// Parser la réponse JSON dans l'objet Trend
-	errJson := json.Unmarshal([]byte(parsedContent), &trend)
+	errJson := json.Unmarshal([]byte(extractJSON(parsedContent)), &trend)
 	if errJson != nil {
 		return nil, errJson
 	}
 
 	// Afficher l'objet Trend
-	fmt.Printf("Trend struct: %+v\n", trend)
+	log.Printf("Trend struct: %+v", trend)
 	return &trend, errJson
 }
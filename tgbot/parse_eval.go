@@ -0,0 +1,308 @@
+package tgbot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// parseEvalCase is a line of the labelled corpus. kind is "new" for a new signal (expected is a TradeRequest) or
+// "update" for an update of a signal (expected is a TradeUpdateRequest). llmResponses are the recorded answers of
+// the llm for this message, in order (a second answer is used when the first one is re-asked)
+type parseEvalCase struct {
+	Channel      string          `json:"channel"`
+	Kind         string          `json:"kind"`
+	Message      string          `json:"message"`
+	Symbols      []string        `json:"symbols,omitempty"`
+	Expected     json.RawMessage `json:"expected"`
+	LLMResponses []string        `json:"llmResponses,omitempty"`
+}
+
+type parseEvalFailure struct {
+	line    int
+	channel string
+	message string
+	diffs   []string
+}
+
+type parseEvalStats struct {
+	total   int
+	exact   int
+	fields  map[string]int
+	checked map[string]int
+}
+
+func newParseEvalStats() *parseEvalStats {
+	return &parseEvalStats{fields: make(map[string]int), checked: make(map[string]int)}
+}
+
+// recordedLLMClient answer with the responses recorded in the corpus, keyed by the message to parse
+type recordedLLMClient struct {
+	responses map[string][]string
+}
+
+func (c *recordedLLMClient) Complete(ctx context.Context, task string, messages []ChatMessage) (string, error) {
+	return c.next(messages)
+}
+
+func (c *recordedLLMClient) CompleteJSON(ctx context.Context, task string, messages []ChatMessage, schema LLMSchema) (string, error) {
+	return c.next(messages)
+}
+
+func (c *recordedLLMClient) next(messages []ChatMessage) (string, error) {
+	// the parsed message is the last user message before any re-ask
+	var key string
+	for _, message := range messages {
+		if message.Role == "user" && !strings.HasPrefix(message.Content, "Réponse invalide") {
+			key = message.Content
+		}
+	}
+	responses := c.responses[key]
+	if len(responses) == 0 {
+		return "", errors.New("no recorded llm response for this message")
+	}
+	c.responses[key] = responses[1:]
+	return responses[0], nil
+}
+
+// RunParseEval run the parse-eval command : parse a labelled corpus and print field level accuracy, failures and
+// per channel breakdown. returns the exit code
+func RunParseEval(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("parse-eval", flag.ContinueOnError)
+	flags.SetOutput(out)
+	corpusPath := flags.String("corpus", "", "JSONL corpus of labelled messages")
+	parserName := flags.String("parser", "auto", "parser to evaluate : rules, llm or auto (rules with llm fallback)")
+	minConfidence := flags.Float64("min-confidence", 0.8, "rules confidence below which auto falls back to the llm")
+	symbolsFlag := flags.String("symbols", "XAUUSD,XAGUSD,BTCUSD,ETHUSD,EURUSD,GBPUSD,USDJPY,US30,NAS100", "broker symbols when a case has none")
+	maxFailures := flags.Int("max-failures", 20, "number of failures to print")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *corpusPath == "" {
+		fmt.Fprintln(out, "-corpus is required")
+		return 2
+	}
+	cases, err := readParseEvalCorpus(*corpusPath)
+	if err != nil {
+		fmt.Fprintf(out, "Error reading corpus: %v\n", err)
+		return 1
+	}
+
+	llm := &recordedLLMClient{responses: make(map[string][]string)}
+	for _, c := range cases {
+		llm.responses[c.Message] = append(llm.responses[c.Message], c.LLMResponses...)
+	}
+	var parser SignalParser
+	switch *parserName {
+	case "rules":
+		parser = NewRuleSignalParser(NewLLMSignalParser(llm), 0)
+	case "llm":
+		parser = NewLLMSignalParser(llm)
+	case "auto":
+		parser = NewRuleSignalParser(NewLLMSignalParser(llm), *minConfidence)
+	default:
+		fmt.Fprintf(out, "unknown parser %s\n", *parserName)
+		return 2
+	}
+	defaultSymbols := strings.Split(*symbolsFlag, ",")
+
+	overall := newParseEvalStats()
+	channels := make(map[string]*parseEvalStats)
+	parsers := make(map[string]int)
+	var failures []parseEvalFailure
+	for i, c := range cases {
+		symbols := c.Symbols
+		if len(symbols) == 0 {
+			symbols = defaultSymbols
+		}
+		diffs, fields, usedParser := evalParseCase(parser, *parserName, c, symbols)
+		if usedParser != "" {
+			parsers[usedParser]++
+		}
+		channelStats, ok := channels[c.Channel]
+		if !ok {
+			channelStats = newParseEvalStats()
+			channels[c.Channel] = channelStats
+		}
+		for _, stats := range []*parseEvalStats{overall, channelStats} {
+			stats.total++
+			if len(diffs) == 0 {
+				stats.exact++
+			}
+			for field, correct := range fields {
+				stats.checked[field]++
+				if correct {
+					stats.fields[field]++
+				}
+			}
+		}
+		if len(diffs) > 0 {
+			failures = append(failures, parseEvalFailure{line: i + 1, channel: c.Channel, message: c.Message, diffs: diffs})
+		}
+	}
+
+	fmt.Fprintf(out, "Cases: %d, exact: %d (%.1f%%)\n", overall.total, overall.exact, percent(overall.exact, overall.total))
+	for _, name := range sortedKeys(parsers) {
+		fmt.Fprintf(out, "Parsed with %s: %d\n", name, parsers[name])
+	}
+	fmt.Fprintln(out, "\nField accuracy:")
+	for _, field := range sortedKeys(overall.checked) {
+		fmt.Fprintf(out, "  %-14s %4d/%-4d %.1f%%\n", field, overall.fields[field], overall.checked[field],
+			percent(overall.fields[field], overall.checked[field]))
+	}
+	fmt.Fprintln(out, "\nChannels:")
+	for _, channel := range sortedKeys(channels) {
+		stats := channels[channel]
+		fmt.Fprintf(out, "  %-30s %4d/%-4d %.1f%%\n", channel, stats.exact, stats.total, percent(stats.exact, stats.total))
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(out, "\nFailures (%d):\n", len(failures))
+		for i, failure := range failures {
+			if i >= *maxFailures {
+				fmt.Fprintf(out, "  ... %d more\n", len(failures)-i)
+				break
+			}
+			fmt.Fprintf(out, "  #%d [%s] %q\n", failure.line, failure.channel, truncate(failure.message, 80))
+			for _, diff := range failure.diffs {
+				fmt.Fprintf(out, "      %s\n", diff)
+			}
+		}
+	}
+	return 0
+}
+
+// parse a case and compare the result with the expected output field by field
+func evalParseCase(parser SignalParser, parserName string, c parseEvalCase, symbols []string) ([]string, map[string]bool, string) {
+	fields := make(map[string]bool)
+	var diffs []string
+	compare := func(field string, expected, got interface{}) {
+		correct := fmt.Sprint(expected) == fmt.Sprint(got)
+		if e, ok := expected.(float64); ok {
+			correct = math.Abs(e-got.(float64)) < 1e-9
+		}
+		fields[field] = correct
+		if !correct {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %v, got %v", field, expected, got))
+		}
+	}
+
+	if c.Kind == "update" {
+		var expected TradeUpdateRequest
+		if err := json.Unmarshal(c.Expected, &expected); err != nil {
+			return []string{fmt.Sprintf("invalid expected value: %v", err)}, fields, ""
+		}
+		got, err := parser.ParseUpdateMessage(c.Message)
+		if err != nil {
+			got = &TradeUpdateRequest{}
+			diffs = append(diffs, fmt.Sprintf("error: %v", err))
+		}
+		compare("updateType", expected.UpdateType, got.UpdateType)
+		compare("value", floatValue(expected.Value), floatValue(got.Value))
+		if expected.Percentage != nil {
+			compare("percentage", *expected.Percentage, floatValue(got.Percentage))
+		}
+		if expected.TpNumber != nil {
+			gotTpNumber := 0
+			if got.TpNumber != nil {
+				gotTpNumber = *got.TpNumber
+			}
+			compare("tpNumber", *expected.TpNumber, gotTpNumber)
+		}
+		return diffs, fields, ParserLLM
+	}
+
+	var expected TradeRequest
+	if err := json.Unmarshal(c.Expected, &expected); err != nil {
+		return []string{fmt.Sprintf("invalid expected value: %v", err)}, fields, ""
+	}
+	got, err := parser.ParseNewMessage(c.Message, symbols)
+	if err != nil {
+		got = &TradeRequest{}
+		diffs = append(diffs, fmt.Sprintf("error: %v", err))
+	}
+	if parserName == "rules" && got.Parser == ParserLLM {
+		// rules only : the fallback must not be used
+		got = &TradeRequest{}
+		diffs = append(diffs, "rules could not parse the message")
+	}
+	compare("actionType", expected.ActionType, got.ActionType)
+	compare("symbol", expected.Symbol, got.Symbol)
+	compare("stopLoss", expected.StopLoss, got.StopLoss)
+	compare("takeProfit1", expected.TakeProfit1, got.TakeProfit1)
+	compare("takeProfit2", expected.TakeProfit2, got.TakeProfit2)
+	compare("takeProfit3", expected.TakeProfit3, got.TakeProfit3)
+	compare("entryZoneMin", expected.EntryZoneMin, got.EntryZoneMin)
+	compare("entryZoneMax", expected.EntryZoneMax, got.EntryZoneMax)
+	if expected.OrderKind != "" {
+		compare("orderKind", expected.OrderKind, got.OrderKind)
+	}
+	return diffs, fields, got.Parser
+}
+
+func readParseEvalCorpus(path string) ([]parseEvalCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var cases []parseEvalCase
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var c parseEvalCase
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if c.Kind == "" {
+			c.Kind = "new"
+		}
+		cases = append(cases, c)
+	}
+	return cases, scanner.Err()
+}
+
+func floatValue(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func percent(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(total)
+}
+
+func truncate(text string, length int) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length]) + "..."
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,22 +1,50 @@
 package tgbot
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"math"
 	"strconv"
 )
 
-// calculate profit real price in dollar price or loss price on tradeRequest
-func calculateProfitPriceInDollar(openPrice float64, closeProfit float64, takeProfit float64, volume float64, symbole string) float64 {
-	currencyPointSize := getCurrencyPointSize(symbole)
-
-	profit := (closeProfit - openPrice) / currencyPointSize * volume
+// calculate profit real price in account currency, negative on loss. valued at the rate 1 when the exchange rate is
+// unknown
+func calculateProfitPriceInDollar(specifications *symbolSpecificationCache, openPrice float64, closeProfit float64, takeProfit float64, volume float64, symbole string) float64 {
+	profit, _ := specifications.priceMoveValue(symbole, closeProfit-openPrice, volume, 0)
+	if closeProfit < openPrice {
+		return -profit
+	}
 	return profit
+}
 
+var errNoExchangeRate = errors.New("no exchange rate to the account currency")
+
+// priceMoveValue is the value in account currency of a price move on a volume. the tick value given by the broker
+// is already in account currency, without it the move is valued with the contract size and the exchange rate from
+// the quote currency, the given one (of a position) or the one of the broker. when no rate is known the value at the
+// rate 1 is returned with errNoExchangeRate
+func (c *symbolSpecificationCache) priceMoveValue(symbol string, priceMove float64, volume float64, exchangeRate float64) (float64, error) {
+	priceMove = math.Abs(priceMove)
+	specification := c.get(symbol)
+	if specification != nil && specification.TickSize > 0 && specification.TickValue > 0 {
+		return priceMove / specification.TickSize * specification.TickValue * volume, nil
+	}
+	contractSize := defaultContractSize(symbol)
+	if specification != nil && specification.ContractSize > 0 {
+		contractSize = specification.ContractSize
+	}
+	if exchangeRate <= 0 {
+		exchangeRate = c.exchangeRate(symbol)
+	}
+	if exchangeRate <= 0 {
+		return priceMove * contractSize * volume, fmt.Errorf("%s: %w", symbol, errNoExchangeRate)
+	}
+	return priceMove * contractSize * volume * exchangeRate, nil
 }
 
-func calculatePips(openPrice float64, closePrice float64, symbol string) float64 {
-	currencyPointSize := getCurrencyPointSize(symbol)
+func calculatePips(specifications *symbolSpecificationCache, openPrice float64, closePrice float64, symbol string) float64 {
+	currencyPointSize := specifications.pointSize(symbol)
 	pips := (closePrice - openPrice) / currencyPointSize
 	// use absolute value
 	if pips < 0 {
@@ -25,51 +53,19 @@ func calculatePips(openPrice float64, closePrice float64, symbol string) float64
 	return pips
 }
 
-// caculate volume size for trade request, minimum volume is 0.01
-func (tgBot *TgBot) calculateVolumeSizeForTradeRequest(stopLossDistancePips float64, riskPercentage float64, accountBalance float64) float64 {
-	// Calcul du risque en dollar
+// caculate volume size for trade request from the loss of one lot at the stop loss. rounded down to the volume step,
+// the loss never goes over the risk
+func (tgBot *TgBot) calculateVolumeSizeForTradeRequest(stopLossValuePerLot float64, riskPercentage float64, accountBalance float64, symbol string) float64 {
+	// Calcul du risque dans la devise du compte
 	riskInDollar := accountBalance * (riskPercentage / 100)
-	// Calcul du volume en fonction du risque en dollar
-	volume := riskInDollar / stopLossDistancePips
-	return math.Round(volume*100) / 100
+	// Calcul du volume en fonction du risque
+	volume := riskInDollar / stopLossValuePerLot
+	return tgBot.specifications.floorVolumeStep(volume, symbol)
 }
-func (tgBot *TgBot) calculateVolumeSizeForTradeRequestByProfit(stopLossDistancePips float64, accountBalance float64, riskInDollar float64) float64 {
-	// Calcul du volume en fonction du risque en dollar
-	volume := riskInDollar / stopLossDistancePips
-	return math.Round(volume*100) / 100
-}
-
-func getCurrencyPointSize(symbol string) float64 {
-	currencyPointSizes := map[string]float64{
-		"EURUSD":   0.0001,
-		"USDJPY":   0.01,
-		"GBPUSD":   0.0001,
-		"USDCHF":   0.0001,
-		"USDCAD":   0.0001,
-		"AUDUSD":   0.0001,
-		"NZDUSD":   0.0001,
-		"EURJPY":   0.01,
-		"GBPJPY":   0.01,
-		"EURGBP":   0.0001,
-		"EURCHF":   0.0001,
-		"XAUUSD":   0.01,  // GOLD
-		"XAGUSD":   0.001, // SILVER
-		"BTCUSD":   1,     // Bitcoin
-		"ETHUSD":   0.01,  // Ethereum
-		"USOUSD":   0.01,  // WTI Crude Oil
-		"BrentUSD": 0.01,  // Brent Crude Oil
-
-	}
-	// in case symbole contains suffix like XAUUSD-STD or XAUUSD-ECN
-	if currencyPointSizes[symbol] == 0 {
-		for key, value := range currencyPointSizes {
-			if key == symbol[:len(key)] {
-				return value
-			}
-		}
-
-	}
-	return currencyPointSizes[symbol]
+func (tgBot *TgBot) calculateVolumeSizeForTradeRequestByProfit(stopLossValuePerLot float64, accountBalance float64, riskInDollar float64, symbol string) float64 {
+	// Calcul du volume en fonction du risque
+	volume := riskInDollar / stopLossValuePerLot
+	return tgBot.specifications.floorVolumeStep(volume, symbol)
 }
 
 func isTradeValidWith3TP(entryPrice, stopLoss, tp1, tp2, tp3, minRiskRewardRatio float64) bool {
@@ -121,22 +117,26 @@ func isTradeValidWith3TP(entryPrice, stopLoss, tp1, tp2, tp3, minRiskRewardRatio
 // get trading dynamic volume
 func (tgBot *TgBot) GetTradingDynamicVolume(request *TradeRequest, price float64, accountBalance float64, channelId int, maxRiskableProfit float64) float64 {
 	stopLoss := request.StopLoss
-	riskPerTradePercentage := tgBot.RedisClient.GetRiskPercentage()
+	riskPerTradePercentage := tgBot.riskPercentage()
 	entryPrice := price
-	pipsToStopLoss := calculatePips(entryPrice, stopLoss, request.Symbol)
+	// loss of one lot at the stop loss, in account currency. not sized when it can not be valued
+	stopLossValuePerLot, err := tgBot.specifications.priceMoveValue(request.Symbol, entryPrice-stopLoss, 1, 0)
+	if err != nil {
+		log.Printf("Error valuing the stop loss: %v", err)
+		return 0
+	}
 	// here we will evaluate the risk management of the trade request
 	maxVolume := tgBot.RedisClient.GetTradingVolume(channelId)
 	if maxRiskableProfit == -1 {
-		// stopLoss distance in pips
 		// dynamic maxVolume calculation
-		dynamicVolume := tgBot.calculateVolumeSizeForTradeRequest(pipsToStopLoss, riskPerTradePercentage, accountBalance)
+		dynamicVolume := tgBot.calculateVolumeSizeForTradeRequest(stopLossValuePerLot, riskPerTradePercentage, accountBalance, request.Symbol)
 		if dynamicVolume <= maxVolume {
 			// recorrection of maxVolume
 			maxVolume = dynamicVolume
 		}
 	} else if maxVolume >= 0 {
 		// calculate volume based on maxRiskableProfit
-		dynammcVolume := tgBot.calculateVolumeSizeForTradeRequestByProfit(pipsToStopLoss, accountBalance, maxRiskableProfit)
+		dynammcVolume := tgBot.calculateVolumeSizeForTradeRequestByProfit(stopLossValuePerLot, accountBalance, maxRiskableProfit, request.Symbol)
 		if dynammcVolume <= maxVolume {
 			// recorrection of maxVolume
 			maxVolume = dynammcVolume
@@ -164,27 +164,16 @@ func (tgBot *TgBot) calculateAllocatedVolume(channelID int) float64 {
 	return allocatedVolume
 }
 
-// get traderequest possible loss in usd
-func (tgBot *TgBot) GetTradeRequestPossibleLoss(request *TradeRequest, price float64) float64 {
+// get traderequest possible loss in account currency
+func (tgBot *TgBot) GetTradeRequestPossibleLoss(request *TradeRequest, price float64) (float64, error) {
 	// here we will evaluate the risk management of the trade request
 	entryPrice := price
 	volume := request.Volume
-	strategy := tgBot.RedisClient.GetStrategy()
-	// stopLoss distance in pips
-	pipsToStopLoss := 0.0
-	// stack stoploss distance base on TPs if tp positive
-	if request.TakeProfit1 > 0 {
-		pipsToStopLoss = pipsToStopLoss + calculatePips(entryPrice, request.StopLoss, request.Symbol)
-	}
-	if strategy == "3TP" || strategy == "TP2" {
-		if request.TakeProfit2 > 0 {
-			pipsToStopLoss = pipsToStopLoss + calculatePips(entryPrice, request.StopLoss, request.Symbol)
-		}
-		if request.TakeProfit3 > 0 && strategy == "3TP" {
-			pipsToStopLoss = pipsToStopLoss + calculatePips(entryPrice, request.StopLoss, request.Symbol)
-		}
+	strategy := tgBot.strategy(tgBot.strategyName())
+	// the volume is split between the legs of the strategy, all of them stop at the same stop loss
+	if len(strategy.legsFor(request)) == 0 {
+		return 0, nil
 	}
 	// loss calculation
-	possibleLoss := pipsToStopLoss * volume
-	return possibleLoss
+	return tgBot.specifications.priceMoveValue(request.Symbol, entryPrice-request.StopLoss, volume, 0)
 }
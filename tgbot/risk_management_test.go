@@ -0,0 +1,133 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+// broker of an account in USD : EURUSD and XAUUSD with their tick value, USDJPY and GER40 without it
+func newRiskTestSpecifications() *symbolSpecificationCache {
+	return newSymbolSpecificationCache(&stubBroker{
+		currency: "USD",
+		specifications: map[string]MetaApiSymbolSpecification{
+			"EURUSD": {Symbol: "EURUSD", TickSize: 0.00001, Digits: 5, ContractSize: 100000, VolumeStep: 0.01, TickValue: 1},
+			"XAUUSD": {Symbol: "XAUUSD", TickSize: 0.01, Digits: 2, ContractSize: 100, VolumeStep: 0.01, TickValue: 1},
+			"USDJPY": {Symbol: "USDJPY", TickSize: 0.001, Digits: 3, ContractSize: 100000, VolumeStep: 0.01},
+			"GER40":  {Symbol: "GER40", TickSize: 0.1, Digits: 1, ContractSize: 1, VolumeStep: 0.1},
+		},
+		prices: map[string]MetaApiPriceResponse{
+			"USDJPY": {Symbol: "USDJPY", Bid: 149.9, Ask: 150},
+			"GER40":  {Symbol: "GER40", Bid: 19000, Ask: 19001, AccountCurrencyExchangeRate: 1.08},
+			"EURJPY": {Symbol: "EURJPY", Bid: 162, Ask: 162.1},
+		},
+	})
+}
+
+func TestPriceMoveValue(t *testing.T) {
+	specifications := newRiskTestSpecifications()
+	tests := []struct {
+		name         string
+		symbol       string
+		move         float64
+		volume       float64
+		exchangeRate float64
+		want         float64
+		wantErr      error
+	}{
+		{name: "forex tick value", symbol: "EURUSD", move: 0.005, volume: 1, want: 500},
+		{name: "metal tick value", symbol: "XAUUSD", move: -10, volume: 0.5, want: 500},
+		{name: "yen pair through the pair price", symbol: "USDJPY", move: 0.5, volume: 1, want: 0.5 * 100000 / 150},
+		{name: "yen cross through the usd pair", symbol: "EURJPY", move: 1, volume: 0.1, want: 0.1 * 100000 / 150},
+		{name: "index rate of the price", symbol: "GER40", move: 50, volume: 2, want: 50 * 2 * 1.08},
+		{name: "crypto in the account currency", symbol: "BTCUSD", move: 1000, volume: 0.1, want: 100},
+		{name: "rate of the position", symbol: "USDJPY", move: 0.5, volume: 1, exchangeRate: 0.0066, want: 0.5 * 100000 * 0.0066},
+		{name: "no rate", symbol: "UK100", move: 10, volume: 1, want: 10, wantErr: errNoExchangeRate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := specifications.priceMoveValue(test.symbol, test.move, test.volume, test.exchangeRate)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error %v, want %v", err, test.wantErr)
+			}
+			if math.Abs(got-test.want) > 1e-6 {
+				t.Errorf("value %.6f, want %.6f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPriceMoveValueWithoutBroker(t *testing.T) {
+	var specifications *symbolSpecificationCache
+	if _, err := specifications.priceMoveValue("EURUSD", 0.005, 1, 0); !errors.Is(err, errNoExchangeRate) {
+		t.Errorf("error %v, want %v", err, errNoExchangeRate)
+	}
+	got, err := specifications.priceMoveValue("EURUSD", 0.005, 1, 1)
+	if err != nil || math.Abs(got-500) > 1e-6 {
+		t.Errorf("value %.6f %v, want 500", got, err)
+	}
+}
+
+func TestGetTradingDynamicVolume(t *testing.T) {
+	redisClient := newFakeRedis(t)
+	if err := redisClient.Rdb.Set(context.Background(), "trading_volume", "10", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisClient.Rdb.HSet(context.Background(), "channel_scores", "1", "5").Err(); err != nil {
+		t.Fatal(err)
+	}
+	tgBot := &TgBot{
+		RedisClient:    redisClient,
+		specifications: newRiskTestSpecifications(),
+		Account:        &AccountProfile{Name: "test", RiskPercentage: 1},
+	}
+	tests := []struct {
+		name              string
+		request           TradeRequest
+		price             float64
+		maxRiskableProfit float64
+		want              float64
+	}{
+		{name: "forex", request: TradeRequest{Symbol: "EURUSD", StopLoss: 1.095}, price: 1.1, maxRiskableProfit: -1, want: 0.2},
+		{name: "metal", request: TradeRequest{Symbol: "XAUUSD", StopLoss: 2640}, price: 2650, maxRiskableProfit: -1, want: 0.1},
+		{name: "yen pair", request: TradeRequest{Symbol: "USDJPY", StopLoss: 149.5}, price: 150, maxRiskableProfit: -1, want: 0.3},
+		{name: "index", request: TradeRequest{Symbol: "GER40", StopLoss: 18950}, price: 19000, maxRiskableProfit: -1, want: 1.8},
+		{name: "rounded down to the step", request: TradeRequest{Symbol: "EURUSD", StopLoss: 1.04}, price: 1.1, maxRiskableProfit: -1, want: 0.01},
+		{name: "under one step", request: TradeRequest{Symbol: "XAUUSD", StopLoss: 2450}, price: 2650, maxRiskableProfit: -1, want: 0},
+		{name: "crypto", request: TradeRequest{Symbol: "BTCUSD", StopLoss: 61000}, price: 62000, maxRiskableProfit: -1, want: 0.1},
+		{name: "riskable profit", request: TradeRequest{Symbol: "EURUSD", StopLoss: 1.095}, price: 1.1, maxRiskableProfit: 50, want: 0.1},
+		{name: "no rate", request: TradeRequest{Symbol: "UK100", StopLoss: 8000}, price: 8100, maxRiskableProfit: -1, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tgBot.GetTradingDynamicVolume(&test.request, test.price, 10000, 1, test.maxRiskableProfit)
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("volume %.4f, want %.4f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRiskedLoss(t *testing.T) {
+	specifications := newRiskTestSpecifications()
+	tests := []struct {
+		name     string
+		position MetaApiPosition
+		want     float64
+	}{
+		{name: "stop loss", position: MetaApiPosition{Symbol: "EURUSD", Type: "POSITION_TYPE_BUY", OpenPrice: 1.1, StopLoss: 1.095, Volume: 1}, want: 500},
+		{name: "sell stop loss", position: MetaApiPosition{Symbol: "XAUUSD", Type: "POSITION_TYPE_SELL", OpenPrice: 2650, StopLoss: 2660, Volume: 0.2}, want: 200},
+		{name: "breakeven", position: MetaApiPosition{Symbol: "EURUSD", Type: "POSITION_TYPE_BUY", OpenPrice: 1.1, StopLoss: 1.1001, Volume: 1}, want: 0},
+		{name: "no stop loss", position: MetaApiPosition{Symbol: "XAUUSD", Type: "POSITION_TYPE_BUY", OpenPrice: 2650, Volume: 0.01}, want: 2650},
+		{name: "rate of the position", position: MetaApiPosition{Symbol: "USDJPY", Type: "POSITION_TYPE_BUY", OpenPrice: 150, StopLoss: 149.5, Volume: 1, AccountCurrencyExchangeRate: 1.0 / 150}, want: 0.5 * 100000 / 150},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.position.riskedLoss(specifications)
+			if math.Abs(got-test.want) > 1e-6 {
+				t.Errorf("loss %.6f, want %.6f", got, test.want)
+			}
+		})
+	}
+}
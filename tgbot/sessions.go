@@ -0,0 +1,250 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// market sessions a channel can be restricted to, hours in UTC. summer time is not followed
+const (
+	SessionSydney  = "SYDNEY"
+	SessionTokyo   = "TOKYO"
+	SessionLondon  = "LONDON"
+	SessionNewYork = "NEW_YORK"
+)
+
+var TradingSessions = []string{SessionSydney, SessionTokyo, SessionLondon, SessionNewYork}
+
+var tradingSessionHours = map[string]dailySession{
+	SessionSydney:  {From: 21 * time.Hour, To: 6 * time.Hour},
+	SessionTokyo:   {From: 0, To: 9 * time.Hour},
+	SessionLondon:  {From: 7 * time.Hour, To: 16 * time.Hour},
+	SessionNewYork: {From: 12 * time.Hour, To: 21 * time.Hour},
+}
+
+// what to do with a signal received when its market or the sessions of its channel are closed
+const (
+	ClosedMarketQueue  = "QUEUE"
+	ClosedMarketReject = "REJECT"
+)
+
+// session of a day given by MetaApi or the market hours file, "HH:MM" or "HH:MM:SS.mmm"
+type MetaApiSession struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// hours of a day from midnight. a session ending before it starts goes on after midnight
+type dailySession struct {
+	From time.Duration
+	To   time.Duration
+}
+
+func (s dailySession) contains(offset time.Duration) bool {
+	if s.To <= s.From {
+		return offset >= s.From || offset < s.To
+	}
+	return offset >= s.From && offset < s.To
+}
+
+// trading sessions of each day of the week
+type weekSchedule map[time.Weekday][]dailySession
+
+var weekdays = map[string]time.Weekday{
+	"SUNDAY":    time.Sunday,
+	"MONDAY":    time.Monday,
+	"TUESDAY":   time.Tuesday,
+	"WEDNESDAY": time.Wednesday,
+	"THURSDAY":  time.Thursday,
+	"FRIDAY":    time.Friday,
+	"SATURDAY":  time.Saturday,
+}
+
+func parseWeekSchedule(sessions map[string][]MetaApiSession) (weekSchedule, error) {
+	schedule := make(weekSchedule)
+	for day, daySessions := range sessions {
+		weekday, ok := weekdays[strings.ToUpper(day)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %s", day)
+		}
+		for _, session := range daySessions {
+			from, err := parseSessionTime(session.From)
+			if err != nil {
+				return nil, err
+			}
+			to, err := parseSessionTime(session.To)
+			if err != nil {
+				return nil, err
+			}
+			// sessions of a day end at midnight at the latest
+			if to == 0 {
+				to = 24 * time.Hour
+			}
+			schedule[weekday] = append(schedule[weekday], dailySession{From: from, To: to})
+		}
+	}
+	return schedule, nil
+}
+
+func parseSessionTime(value string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	if ok && len(minutes) > 2 {
+		minutes = minutes[:2]
+	}
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || h < 0 || h > 24 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid session time %s", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// market open at a time given in the time zone of the schedule
+func (w weekSchedule) isOpen(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	for _, session := range w[t.Weekday()] {
+		if session.contains(offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// marketCalendar tells when the symbols can be traded
+type marketCalendar struct {
+	// time zone of the broker sessions and of the file
+	location *time.Location
+	// sessions of the market hours file by symbol, "*" for the symbols not in the file
+	schedules map[string]weekSchedule
+}
+
+func loadMarketCalendar(timeZone string, path string) (*marketCalendar, error) {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker time zone: %w", err)
+	}
+	calendar := &marketCalendar{location: location, schedules: make(map[string]weekSchedule)}
+	if path == "" {
+		return calendar, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading market hours file: %w", err)
+	}
+	var symbols map[string]map[string][]MetaApiSession
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		return nil, fmt.Errorf("error parsing market hours file: %w", err)
+	}
+	for symbol, sessions := range symbols {
+		schedule, err := parseWeekSchedule(sessions)
+		if err != nil {
+			return nil, fmt.Errorf("market hours of %s: %w", symbol, err)
+		}
+		calendar.schedules[symbol] = schedule
+	}
+	return calendar, nil
+}
+
+// sessions of a symbol : market hours file, trade sessions of the broker, nil when always open
+func (c *marketCalendar) schedule(symbol string, specifications *symbolSpecificationCache) weekSchedule {
+	if schedule, ok := c.schedules[symbol]; ok {
+		return schedule
+	}
+	// in case symbole contains suffix like XAUUSD-STD or XAUUSD-ECN
+	for key, schedule := range c.schedules {
+		if key != "*" && strings.HasPrefix(symbol, key) {
+			return schedule
+		}
+	}
+	if specification := specifications.get(symbol); specification != nil && len(specification.TradeSessions) > 0 {
+		schedule, err := parseWeekSchedule(specification.TradeSessions)
+		if err == nil {
+			return schedule
+		}
+		log.Printf("Invalid %s trade sessions: %v", symbol, err)
+	}
+	return c.schedules["*"]
+}
+
+// tradingHours tells why a signal of a channel cannot be traded at a time, empty when it can : market of the symbol
+// closed or none of the sessions chosen for the channel (all of them when none is chosen) open
+func (tgBot *TgBot) tradingHours(channelID int, symbol string) func(t time.Time) string {
+	schedule := tgBot.calendar.schedule(symbol, tgBot.specifications)
+	sessions := tgBot.RedisClient.GetChannelSessions(channelID)
+	return func(t time.Time) string {
+		if schedule != nil && !schedule.isOpen(t.In(tgBot.calendar.location)) {
+			return fmt.Sprintf("%s market closed", symbol)
+		}
+		if len(sessions) == 0 {
+			return ""
+		}
+		utc := t.UTC()
+		offset := time.Duration(utc.Hour())*time.Hour + time.Duration(utc.Minute())*time.Minute
+		for _, session := range sessions {
+			if hours, ok := tradingSessionHours[session]; ok && hours.contains(offset) {
+				return ""
+			}
+		}
+		return "outside the sessions of the channel (" + strings.Join(sessions, ", ") + ")"
+	}
+}
+
+// first minute a signal can be traded within the queue delay, zero when it cannot
+func (tgBot *TgBot) nextTradingTime(channelID int, symbol string, now time.Time) time.Time {
+	closedReason := tgBot.tradingHours(channelID, symbol)
+	limit := now.Add(tgBot.AppConfig.SessionQueueMaxDelay)
+	for t := now.Truncate(time.Minute).Add(time.Minute); !t.After(limit); t = t.Add(time.Minute) {
+		if closedReason(t) == "" {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// hold a signal received while it cannot be traded : queued until it can, or rejected by the channel policy
+func (tgBot *TgBot) holdSignal(input HandleRequestInput, tradeRequest *TradeRequest, reason string) error {
+	channelID := int(input.ChannelID)
+	if tgBot.RedisClient.GetChannelClosedMarketAction(channelID) == ClosedMarketQueue {
+		next := tgBot.nextTradingTime(channelID, tradeRequest.Symbol, time.Now())
+		if !next.IsZero() {
+			// released to this account only, the others handled the signal already
+			input.Account = tgBot.accountName()
+			payload, _ := json.Marshal(input)
+			if err := tgBot.RedisClient.QueueSignal(payload, next); err != nil {
+				log.Printf("Error queuing signal: %v", err)
+				return err
+			}
+			log.Printf("Signal %d queued until %s: %s", input.MessageId, next.UTC().Format(time.RFC3339), reason)
+			tgBot.sendMessage(fmt.Sprintf("⏸ Signal queued\n🏀 Channel : %s\n📈 %s %s\n⚠️ Reason : %s\n⏰ Until : %s UTC",
+				input.ChannelName, tradeRequest.ActionType, tradeRequest.Symbol, reason, next.UTC().Format("Mon 02 Jan 15:04")), 0)
+			return fmt.Errorf("signal queued: %s", reason)
+		}
+		reason = reason + ", not open within " + tgBot.AppConfig.SessionQueueMaxDelay.String()
+	}
+	log.Printf("Signal %d rejected: %s", input.MessageId, reason)
+	tgBot.sendMessage(fmt.Sprintf("❌ Signal rejected\n🏀 Channel : %s\n📈 %s %s\n⚠️ Reason : %s",
+		input.ChannelName, tradeRequest.ActionType, tradeRequest.Symbol, reason), 0)
+	return fmt.Errorf("signal rejected: %s", reason)
+}
+
+// push back to the trading signals the queued signals whose market is open
+func (tgBot *TgBot) releaseQueuedSignals() {
+	for _, payload := range tgBot.RedisClient.PopDueSignals(time.Now()) {
+		var input HandleRequestInput
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			log.Printf("Error unmarshalling queued signal: %v", err)
+			continue
+		}
+		log.Printf("Releasing queued signal %d of %s for account %s", input.MessageId, input.ChannelName, input.Account)
+		if _, err := tgBot.RedisClient.AddSignal([]byte(payload)); err != nil {
+			log.Printf("Error releasing queued signal: %v", err)
+			// tried again on the next run
+			_ = tgBot.RedisClient.QueueSignal([]byte(payload), time.Now())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package tgbot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	stopLossPattern   = regexp.MustCompile(`(?i)\b(sl|stop\s*loss|stoploss|stop)\b`)
+	takeProfitPattern = regexp.MustCompile(`(?i)\b(tp\d?|take\s*profit\d?|takeprofit\d?|target\d?)\b`)
+	directionPattern  = regexp.MustCompile(`(?i)\b(buy|sell|long|short|achat|achete|vente|vend)`)
+	// "XAUUSD", "EUR/USD", "gbp usd"
+	currencyPairPattern = regexp.MustCompile(`(?i)\b(xau|xag|eur|gbp|usd|jpy|chf|aud|nzd|cad|btc|eth)\s*/?\s*(usd|eur|gbp|jpy|chf|aud|nzd|cad)\b`)
+)
+
+// signalAssembler merge consecutive non-reply messages of a source posted during its assembly window into one
+// signal ("GOLD BUY NOW" then "SL 2300 TP 2320" a few seconds later). the messages waiting for their window are only
+// in memory, they are lost on a crash of the listener before being pushed to the signal stream
+type signalAssembler struct {
+	mu      sync.Mutex
+	pending map[string]*assemblyBuffer
+	// last signal pushed by each source, a late SL/TP message amends it
+	last map[string]*assemblyBuffer
+	// the signals of a source are pushed in order, outside of mu
+	sources map[string]*sync.Mutex
+}
+
+type assemblyBuffer struct {
+	input    HandleRequestInput
+	messages []string
+	timer    *time.Timer
+	pushedAt time.Time
+}
+
+func newSignalAssembler() *signalAssembler {
+	return &signalAssembler{
+		pending: make(map[string]*assemblyBuffer),
+		last:    make(map[string]*assemblyBuffer),
+		sources: make(map[string]*sync.Mutex),
+	}
+}
+
+func (b *assemblyBuffer) text() string {
+	return strings.Join(b.messages, "\n")
+}
+
+// a message is complete when it gives its stop loss and take profit
+func messageHasStopLossAndTakeProfit(message string) bool {
+	return stopLossPattern.MatchString(message) && takeProfitPattern.MatchString(message)
+}
+
+// a message only giving levels of a previous signal (no direction)
+func messageIsLevelsOnly(message string) bool {
+	return (stopLossPattern.MatchString(message) || takeProfitPattern.MatchString(message)) &&
+		!directionPattern.MatchString(message)
+}
+
+// symbol named in a message, by currency pair or by alias, empty when there is none
+func messageSymbol(message string) string {
+	if pair := currencyPairPattern.FindStringSubmatch(message); pair != nil {
+		return strings.ToUpper(pair[1] + pair[2])
+	}
+	for _, word := range signalWordPattern.FindAllString(strings.ToUpper(message), -1) {
+		if alias, ok := signalSymbolAliases[word]; ok {
+			return alias
+		}
+	}
+	return ""
+}
+
+// a message opening a new signal instead of completing the previous one : it gives a direction or another symbol
+func messageOpensSignal(message string, previous string) bool {
+	if directionPattern.MatchString(message) {
+		return true
+	}
+	symbol := messageSymbol(message)
+	return symbol != "" && symbol != messageSymbol(previous)
+}
+
+// add a non-reply message of a source. the signal is pushed when the window ends or as soon as it has
+// its stop loss and take profit. a late levels message amends the last bare signal of the source
+func (a *signalAssembler) add(input HandleRequestInput, window time.Duration, push func(input HandleRequestInput)) {
+	key := fmt.Sprintf("%d:%d", input.ChannelID, input.TopicId)
+	source := a.source(key)
+	source.Lock()
+	defer source.Unlock()
+	for _, signal := range a.assemble(key, input, window, push) {
+		push(signal)
+	}
+}
+
+// lock of the pushes of a source
+func (a *signalAssembler) source(key string) *sync.Mutex {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	source, ok := a.sources[key]
+	if !ok {
+		source = &sync.Mutex{}
+		a.sources[key] = source
+	}
+	return source
+}
+
+// signals to push for a new message
+func (a *signalAssembler) assemble(key string, input HandleRequestInput, window time.Duration, push func(input HandleRequestInput)) []HandleRequestInput {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var signals []HandleRequestInput
+	if buffer, ok := a.pending[key]; ok {
+		if !messageOpensSignal(input.Message, buffer.text()) {
+			buffer.messages = append(buffer.messages, input.Message)
+			if messageHasStopLossAndTakeProfit(buffer.text()) && buffer.timer.Stop() {
+				signals = append(signals, a.flush(key, buffer))
+			}
+			return signals
+		}
+		// another signal, the pending one is pushed as it is. its timer finds it flushed
+		buffer.timer.Stop()
+		signals = append(signals, a.flush(key, buffer))
+	}
+
+	// late stop loss / take profit for the last signal which had none. the consumer handles it as an edit of the
+	// trade of the signal, or as a new signal when the bare one opened no trade
+	if last, ok := a.last[key]; ok && time.Since(last.pushedAt) <= window && messageIsLevelsOnly(input.Message) &&
+		!messageOpensSignal(input.Message, last.text()) && !messageHasStopLossAndTakeProfit(last.text()) {
+		last.messages = append(last.messages, input.Message)
+		amend := last.input
+		amend.Message = last.text()
+		amend.Edited = true
+		amend.Assembled = true
+		amend.EditDate = int(time.Now().Unix())
+		return append(signals, amend)
+	}
+
+	buffer := &assemblyBuffer{input: input, messages: []string{input.Message}}
+	if messageHasStopLossAndTakeProfit(input.Message) {
+		return append(signals, a.flush(key, buffer))
+	}
+	a.pending[key] = buffer
+	buffer.timer = time.AfterFunc(window, func() {
+		source := a.source(key)
+		source.Lock()
+		defer source.Unlock()
+		a.mu.Lock()
+		if a.pending[key] != buffer {
+			a.mu.Unlock()
+			return
+		}
+		signal := a.flush(key, buffer)
+		a.mu.Unlock()
+		push(signal)
+	})
+	return signals
+}
+
+// signal of a buffer, must be called with the lock held
+func (a *signalAssembler) flush(key string, buffer *assemblyBuffer) HandleRequestInput {
+	delete(a.pending, key)
+	buffer.input.Message = buffer.text()
+	buffer.pushedAt = time.Now()
+	a.last[key] = buffer
+	return buffer.input
+}
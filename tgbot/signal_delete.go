@@ -0,0 +1,131 @@
+package tgbot
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// delete policies of a channel
+const (
+	// cancel pending orders, opened positions are kept
+	DeletePolicyCancel = "CANCEL"
+	// cancel pending orders and close positions still near their entry price
+	DeletePolicyCloseNearEntry = "CLOSE_NEAR_ENTRY"
+	// only inform the user
+	DeletePolicyAlert = "ALERT"
+)
+
+// a position is near entry while the price moved less than this part of the stop loss distance
+const nearEntryStopLossRatio = 0.2
+
+var DeletePolicies = []string{DeletePolicyCancel, DeletePolicyCloseNearEntry, DeletePolicyAlert}
+
+// HandleDeletedTradeRequest apply the delete policy of the channel on the orders and positions opened
+// from the deleted messages
+func (tgBot *TgBot) HandleDeletedTradeRequest(input HandleRequestInput) error {
+	policy := tgBot.RedisClient.GetChannelDeletePolicy(int(input.ChannelID))
+	positions, err := tgBot.Broker.Positions()
+	if err != nil {
+		return err
+	}
+	orders, err := tgBot.Broker.Orders()
+	if err != nil {
+		return err
+	}
+	positions = filterPositionsByChannel(positions, input.ChannelID)
+	orders = filterPositionsByChannel(orders, input.ChannelID)
+
+	for _, deletedId := range input.DeletedIds {
+		// a follow up message (same trade posted again) does not cancel the first one
+		firstMessageId := tgBot.RedisClient.GetTradeFirstMessageId(int64(deletedId))
+		if firstMessageId != 0 && firstMessageId != int64(deletedId) {
+			log.Printf("Deleted message %d is a follow up of message %d", deletedId, firstMessageId)
+			continue
+		}
+		if tgBot.RedisClient.GetTradeRequest(int64(deletedId)) == nil {
+			continue
+		}
+		messagePositions := getPositionsByMessageId(positions, deletedId)
+		messageOrders := getPositionsByMessageId(orders, deletedId)
+		if len(messagePositions) == 0 && len(messageOrders) == 0 {
+			continue
+		}
+		tgBot.applyDeletePolicy(policy, input.ChannelName, messagePositions, messageOrders)
+	}
+	return nil
+}
+
+func (tgBot *TgBot) applyDeletePolicy(policy string, channelName string, positions []MetaApiPosition, orders []MetaApiPosition) {
+	botMessage := fmt.Sprintf("🗑 Signal deleted\n🏀 Channel : %s\n📜 Policy : %s", channelName, policy)
+	replyToMessageId := 0
+	for _, position := range positions {
+		if replyToMessageId == 0 {
+			replyToMessageId = int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+		}
+	}
+
+	if policy == DeletePolicyCancel || policy == DeletePolicyCloseNearEntry {
+		for _, order := range orders {
+			errCancel := tgBot.doCancelOrder(order)
+			if errCancel != nil {
+				botMessage = fmt.Sprintf("%s\n❌ Order ID: %s not cancelled: %v", botMessage, order.ID, errCancel)
+				continue
+			}
+			botMessage = fmt.Sprintf("%s\n➡️Cancelled order ID: %s", botMessage, order.ID)
+		}
+	} else {
+		for _, order := range orders {
+			botMessage = fmt.Sprintf("%s\n⚠️ Pending order ID: %s %s", botMessage, order.ID, order.Symbol)
+		}
+	}
+
+	for _, position := range positions {
+		tpNumber := extractTPFromClientId(position.ClientID)
+		if policy == DeletePolicyCloseNearEntry && isPositionNearEntry(position) {
+			errClose := tgBot.doClosePosition(position)
+			if errClose != nil {
+				botMessage = fmt.Sprintf("%s\n❌ TP%d Position ID: %s not closed: %v", botMessage, tpNumber, position.ID, errClose)
+				continue
+			}
+			botMessage = fmt.Sprintf("%s\n➡️Closed TP%d Position ID: %s (%.2f)", botMessage, tpNumber, position.ID, position.Profit)
+			continue
+		}
+		botMessage = fmt.Sprintf("%s\n⚠️ TP%d Position ID: %s still open (%.2f). Please check it manually", botMessage,
+			tpNumber, position.ID, position.Profit)
+	}
+
+	_, errM := tgBot.sendMessage(botMessage, replyToMessageId)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+}
+
+// the price did not move away from the entry more than a part of the stop loss distance
+func isPositionNearEntry(position MetaApiPosition) bool {
+	if position.StopLoss == 0 || position.CurrentPrice == 0 {
+		return false
+	}
+	stopLossDistance := math.Abs(position.OpenPrice - position.StopLoss)
+	return math.Abs(position.CurrentPrice-position.OpenPrice) <= stopLossDistance*nearEntryStopLossRatio
+}
+
+// cancel a pending order
+func (tgBot *TgBot) doCancelOrder(order MetaApiPosition) error {
+	metaApiRequest := MetaApiTradeRequest{
+		ActionType: "ORDER_CANCEL",
+		OrderID:    &order.ID,
+	}
+	_, err := tgBot.Executor.Execute(metaApiRequest)
+	return err
+}
+
+// close a single position
+func (tgBot *TgBot) doClosePosition(position MetaApiPosition) error {
+	metaApiRequest := MetaApiTradeRequest{
+		ActionType: "POSITION_CLOSE_ID",
+		PositionID: &position.ID,
+	}
+	_, err := tgBot.Executor.Execute(metaApiRequest)
+	return err
+}
@@ -0,0 +1,89 @@
+package tgbot
+
+import (
+	"sync"
+	"time"
+)
+
+// size of the queue of each channel before the stream reader waits
+const signalQueueSize = 100
+
+// a channel queue without signals for this long is stopped, the next signal of the channel starts it again
+const signalQueueIdle = time.Minute
+
+// signalDispatcher run the signals of a channel one after the other (a signal and its follow up update are
+// applied in sequence) while different channels run in parallel on a bounded number of workers
+type signalDispatcher struct {
+	mu       sync.Mutex
+	queues   map[int64]*signalQueue
+	inFlight map[string]bool
+	workers  chan struct{}
+}
+
+type signalQueue struct {
+	jobs chan func()
+	// jobs queued and not run yet, under the lock of the dispatcher
+	pending int
+}
+
+func newSignalDispatcher(workers int) *signalDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &signalDispatcher{
+		queues:   make(map[int64]*signalQueue),
+		inFlight: make(map[string]bool),
+		workers:  make(chan struct{}, workers),
+	}
+}
+
+// queue a job on its channel. a signal already queued or running is ignored
+func (d *signalDispatcher) dispatch(channelID int64, id string, job func()) {
+	d.mu.Lock()
+	if d.inFlight[id] {
+		d.mu.Unlock()
+		return
+	}
+	d.inFlight[id] = true
+	queue, ok := d.queues[channelID]
+	if !ok {
+		queue = &signalQueue{jobs: make(chan func(), signalQueueSize)}
+		d.queues[channelID] = queue
+		go d.runQueue(channelID, queue)
+	}
+	queue.pending++
+	d.mu.Unlock()
+
+	queue.jobs <- func() {
+		defer d.done(id)
+		job()
+	}
+}
+
+func (d *signalDispatcher) runQueue(channelID int64, queue *signalQueue) {
+	for {
+		select {
+		case job := <-queue.jobs:
+			d.workers <- struct{}{}
+			job()
+			<-d.workers
+			d.mu.Lock()
+			queue.pending--
+			d.mu.Unlock()
+		case <-time.After(signalQueueIdle):
+			d.mu.Lock()
+			if queue.pending == 0 {
+				delete(d.queues, channelID)
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+func (d *signalDispatcher) done(id string) {
+	d.mu.Lock()
+	delete(d.inFlight, id)
+	d.mu.Unlock()
+}
@@ -0,0 +1,173 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// HandleEditedTradeRequest re-parse an edited signal message, diff it against the trade request
+// stored for this message and re-sync the positions opened from it
+func (tgBot *TgBot) HandleEditedTradeRequest(input HandleRequestInput) (*TradeRequest, error) {
+	storedRequest := tgBot.RedisClient.GetTradeRequest(int64(input.MessageId))
+	if storedRequest == nil {
+		log.Printf("No trade found for edited message %d", input.MessageId)
+		return nil, errors.New("no trade found for edited message")
+	}
+	var previousRequest TradeRequest
+	errJ := json.Unmarshal(storedRequest, &previousRequest)
+	if errJ != nil {
+		return nil, errJ
+	}
+	if previousRequest.MessageId == nil {
+		previousRequest.MessageId = &input.MessageId
+	}
+
+	symbols, err := tgBot.Broker.Symbols()
+	if err != nil {
+		log.Printf("Error fetching symbols: %v", err)
+		tgBot.sendMessage(fmt.Sprintf("❌ Error fetching symbols from MetaApi : %v", err), 0)
+		return nil, err
+	}
+	editedRequest, err := tgBot.SignalParser.ParseNewMessage(input.Message, symbols)
+	if err != nil {
+		log.Printf("Error parsing edited trade request: %v", err)
+		tgBot.sendMessage(fmt.Sprintf("❌ Error parsing edited trade request: %v", err), 0)
+		return nil, err
+	}
+
+	changes := diffTradeRequests(&previousRequest, editedRequest)
+	if len(changes) == 0 {
+		log.Printf("Edited message %d does not change the trade", input.MessageId)
+		return &previousRequest, nil
+	}
+
+	botMessage := fmt.Sprintf("✏️ Signal edited\n🏀 Channel : %s\n📈 %s %s", input.ChannelName,
+		previousRequest.ActionType, previousRequest.Symbol)
+	for _, change := range changes {
+		botMessage = fmt.Sprintf("%s\n%s", botMessage, change)
+	}
+
+	// a different symbol or direction can not be applied on opened positions
+	if editedRequest.Symbol != previousRequest.Symbol || editedRequest.ActionType != previousRequest.ActionType {
+		botMessage = fmt.Sprintf("%s\n⚠️ Symbol or direction changed, positions left untouched. Please check them manually", botMessage)
+		tgBot.sendMessage(botMessage, 0)
+		return &previousRequest, errors.New("symbol or direction changed on edited signal")
+	}
+
+	positions, err := tgBot.Broker.Positions()
+	if err != nil {
+		return nil, err
+	}
+	messagePositions := getPositionsByMessageId(filterPositionsByChannel(positions, input.ChannelID), *previousRequest.MessageId)
+	replyToMessageId := 0
+	for _, position := range messagePositions {
+		if replyToMessageId == 0 {
+			replyToMessageId = int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+		}
+		tpNumber := extractTPFromClientId(position.ClientID)
+		newStopLoss := position.StopLoss
+		// only follow the new stop loss while the position still has the stop loss of the signal
+		// (breakeven or a manual move must not be overwritten), within a point for the broker rounding
+		if editedRequest.StopLoss > 0 && editedRequest.StopLoss != previousRequest.StopLoss {
+			if math.Abs(position.StopLoss-previousRequest.StopLoss) <= tgBot.specifications.pointSize(position.Symbol) {
+				newStopLoss = editedRequest.StopLoss
+			} else {
+				botMessage = fmt.Sprintf("%s\n⚠️ TP%d Position ID: %s SL %.2f moved since the signal, not changed", botMessage,
+					tpNumber, position.ID, position.StopLoss)
+			}
+		}
+		newTakeProfit := position.TakeProfit
+		if editedRequest.TakeProfit(tpNumber) > 0 {
+			newTakeProfit = editedRequest.TakeProfit(tpNumber)
+		}
+		if newStopLoss == position.StopLoss && newTakeProfit == position.TakeProfit {
+			continue
+		}
+		errModify := tgBot.doModifyPosition(position, newStopLoss, newTakeProfit)
+		if errModify != nil {
+			botMessage = fmt.Sprintf("%s\n❌ TP%d Position ID: %s not modified: %v", botMessage, tpNumber, position.ID, errModify)
+			continue
+		}
+		botMessage = fmt.Sprintf("%s\n➡️TP%d Position ID: %s\nSL: %.2f -> %.2f\nTP: %.2f -> %.2f", botMessage, tpNumber,
+			position.ID, position.StopLoss, newStopLoss, position.TakeProfit, newTakeProfit)
+	}
+	// legs that were not opened from the original signal can not be added afterwards
+	for tpNumber := 1; tpNumber <= 3; tpNumber++ {
+		if previousRequest.TakeProfit(tpNumber) <= 0 && editedRequest.TakeProfit(tpNumber) > 0 &&
+			getPositionByMessageIdAndTP(messagePositions, *previousRequest.MessageId, tpNumber) == nil {
+			botMessage = fmt.Sprintf("%s\n⚠️ TP%d added but no position was opened for it", botMessage, tpNumber)
+		}
+	}
+
+	// save the edited values on the stored trade request
+	updatedRequest := previousRequest
+	if editedRequest.StopLoss > 0 {
+		updatedRequest.StopLoss = editedRequest.StopLoss
+	}
+	updatedRequest.TakeProfit1 = editedRequest.TakeProfit1
+	updatedRequest.TakeProfit2 = editedRequest.TakeProfit2
+	updatedRequest.TakeProfit3 = editedRequest.TakeProfit3
+	tradeRbytes, errJ := json.Marshal(updatedRequest)
+	if errJ == nil {
+		tgBot.RedisClient.SetTradeRequest(int64(*updatedRequest.MessageId), tradeRbytes)
+		tradeKey := updatedRequest.GenerateTradeRequestKey()
+		tgBot.RedisClient.AddTradeKey(tradeKey)
+		tgBot.RedisClient.SetTradeKeyMessageId(tradeKey, int64(*updatedRequest.MessageId))
+	}
+
+	_, errM := tgBot.sendMessage(botMessage, replyToMessageId)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+	return &updatedRequest, nil
+}
+
+// list human readable changes between the stored trade request and the edited one
+func diffTradeRequests(previous *TradeRequest, edited *TradeRequest) []string {
+	var changes []string
+	if previous.Symbol != edited.Symbol {
+		changes = append(changes, fmt.Sprintf("Symbol: %s -> %s", previous.Symbol, edited.Symbol))
+	}
+	if previous.ActionType != edited.ActionType {
+		changes = append(changes, fmt.Sprintf("Action: %s -> %s", previous.ActionType, edited.ActionType))
+	}
+	if edited.StopLoss > 0 && previous.StopLoss != edited.StopLoss {
+		changes = append(changes, fmt.Sprintf("🔴 SL: %.2f -> %.2f", previous.StopLoss, edited.StopLoss))
+	}
+	for tpNumber := 1; tpNumber <= 3; tpNumber++ {
+		if previous.TakeProfit(tpNumber) != edited.TakeProfit(tpNumber) {
+			changes = append(changes, fmt.Sprintf("🟢 TP%d: %s -> %s", tpNumber,
+				formatTakeProfit(previous.TakeProfit(tpNumber)), formatTakeProfit(edited.TakeProfit(tpNumber))))
+		}
+	}
+	return changes
+}
+
+func formatTakeProfit(tp float64) string {
+	if tp == -1 {
+		return "OPEN"
+	}
+	if tp == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", tp)
+}
+
+// modify stop loss and take profit of a single position
+func (tgBot *TgBot) doModifyPosition(position MetaApiPosition, stopLoss float64, takeProfit float64) error {
+	metaApiRequest := MetaApiTradeRequest{
+		ActionType: "POSITION_MODIFY",
+		PositionID: &position.ID,
+	}
+	if stopLoss > 0 {
+		metaApiRequest.StopLoss = &stopLoss
+	}
+	if takeProfit > 0 {
+		metaApiRequest.TakeProfit = &takeProfit
+	}
+	_, err := tgBot.Executor.Execute(metaApiRequest)
+	return err
+}
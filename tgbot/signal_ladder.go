@@ -0,0 +1,174 @@
+package tgbot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ladder modes of a channel : the volume of each leg is split into limit orders spread across the entry zone
+const (
+	LadderModeOff = "OFF"
+	// same volume on each step
+	LadderModeLinear = "LINEAR"
+	// more volume on the steps closer to the better price
+	LadderModeWeighted = "WEIGHTED"
+)
+
+var LadderModes = []string{LadderModeOff, LadderModeLinear, LadderModeWeighted}
+
+type ladderStep struct {
+	Price  float64
+	Volume float64
+	// the price is already reached, the step is a market order
+	Market bool
+}
+
+// split a volume into steps from the edge of the zone reached first to the better price. a buy is better at the
+// bottom of the zone, a sell at the top. the steps are lots the broker accepts, fewer steps when the volume is too
+// small for all of them, the total never above the volume
+func computeLadderSteps(actionType string, zoneMin, zoneMax, volume, currentPrice float64, steps int, mode string,
+	minVolume, maxVolume, volumeStep float64) []ladderStep {
+	if steps < 1 {
+		steps = 1
+	}
+	volumes := splitVolume(volume, ladderWeights(steps, mode), minVolume, maxVolume, volumeStep)
+	for steps > 1 && hasEmptyStep(volumes) {
+		steps--
+		volumes = splitVolume(volume, ladderWeights(steps, mode), minVolume, maxVolume, volumeStep)
+	}
+	near, far := zoneMax, zoneMin
+	if actionType == "ORDER_TYPE_SELL" {
+		near, far = zoneMin, zoneMax
+	}
+
+	var ladder []ladderStep
+	for i := 0; i < steps; i++ {
+		if volumes[i] == 0 {
+			continue
+		}
+		price := near
+		if steps > 1 {
+			price = near + (far-near)*float64(i)/float64(steps-1)
+		}
+		// a limit order must be under the ask for a buy, above the bid for a sell
+		market := (actionType == "ORDER_TYPE_BUY" && price >= currentPrice) ||
+			(actionType == "ORDER_TYPE_SELL" && price <= currentPrice)
+		ladder = append(ladder, ladderStep{Price: price, Volume: volumes[i], Market: market})
+	}
+	return ladder
+}
+
+func hasEmptyStep(volumes []float64) bool {
+	for _, volume := range volumes {
+		if volume == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func ladderWeights(steps int, mode string) []float64 {
+	weights := make([]float64, steps)
+	for i := range weights {
+		weights[i] = ladderStepWeight(i, mode)
+	}
+	return weights
+}
+
+func ladderStepWeight(i int, mode string) float64 {
+	if mode == LadderModeWeighted {
+		return float64(i + 1)
+	}
+	return 1
+}
+
+// place a leg of a signal as a ladder of limit orders. returns the number of orders placed
+func (tgBot *TgBot) placeLadderLeg(channelTitle string, tradeRequest *TradeRequest, leg MetaApiTradeRequest, clientId string,
+	zoneMin, zoneMax, currentPrice float64, tpNumber int, mode string) int {
+	minVolume, maxVolume, volumeStep := 0.01, 0.0, 0.01
+	if specification := tgBot.specifications.get(tradeRequest.Symbol); specification != nil {
+		minVolume, maxVolume, volumeStep = specification.MinVolume, specification.MaxVolume, specification.VolumeStep
+	}
+	ladder := computeLadderSteps(tradeRequest.ActionType, zoneMin, zoneMax, *leg.Volume, currentPrice,
+		tgBot.AppConfig.LadderSteps, mode, minVolume, maxVolume, volumeStep)
+	expiration := &Expiration{
+		Type: "ORDER_TIME_SPECIFIED",
+		Time: time.Now().Add(tgBot.AppConfig.LadderOrderTimeout).UTC().Format(time.RFC3339),
+	}
+	botMessage := fmt.Sprintf("🪜 Ladder placed\n🏀 Channel : %s\n📈 %s %s\n🔴 SL: %.2f\n🟢 TP%d: %.2f", channelTitle,
+		tradeRequest.ActionType, tradeRequest.Symbol, tradeRequest.StopLoss, tpNumber, tradeRequest.TakeProfit(tpNumber))
+	placed := 0
+	var placedIds []string
+	for i, step := range ladder {
+		stepRequest := leg
+		volume := step.Volume
+		stepRequest.Volume = &volume
+		stepClientId, err := ladderStepClientId(clientId, i+1)
+		if err != nil {
+			log.Printf("Error placing ladder step %d: %v", i+1, err)
+			botMessage = fmt.Sprintf("%s\n❌ Step %d %.2f lot at %.2f: %v", botMessage, i+1, step.Volume, step.Price, err)
+			continue
+		}
+		stepRequest.ClientID = &stepClientId
+		if step.Market {
+			stepRequest.ActionType = tradeRequest.ActionType
+			stepRequest.OpenPrice = nil
+			stepRequest.Expiration = nil
+		} else {
+			price := step.Price
+			stepRequest.ActionType = tradeRequest.ActionType + "_" + OrderKindLimit
+			stepRequest.OpenPrice = &price
+			stepRequest.Expiration = expiration
+		}
+		trade, err := tgBot.Executor.Execute(stepRequest)
+		if err != nil {
+			log.Printf("Error placing ladder step %s: %v", stepClientId, err)
+			botMessage = fmt.Sprintf("%s\n❌ Step %d %.2f lot at %.2f: %s", botMessage, i+1, step.Volume, step.Price,
+				tradeErrorReason(err))
+			continue
+		}
+		placed++
+		if trade.PositionId != nil {
+			placedIds = append(placedIds, *trade.PositionId)
+		} else if trade.OrderId != nil {
+			placedIds = append(placedIds, *trade.OrderId)
+		}
+		if step.Market {
+			botMessage = fmt.Sprintf("%s\n➡️Step %d %.2f lot at market", botMessage, i+1, step.Volume)
+		} else {
+			botMessage = fmt.Sprintf("%s\n⏳ Step %d %.2f lot at %.2f", botMessage, i+1, step.Volume, step.Price)
+		}
+	}
+	m, errM := tgBot.sendMessage(botMessage, 0)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+	if m != nil {
+		for _, id := range placedIds {
+			tgBot.RedisClient.SetPositionMessageId(id, m.MessageId)
+		}
+	}
+	return placed
+}
+
+// MetaApi refuses the client ids longer than 26 characters
+const clientIdMaxLength = 26
+
+// client id of a ladder step : the one of the leg with the step number, the initials of the channel shortened when
+// it is too long. the channel, message and TP parts are kept, the positions are found with them
+func ladderStepClientId(clientId string, step int) (string, error) {
+	suffix := "L" + strconv.Itoa(step)
+	initials, rest, ok := strings.Cut(clientId, "@")
+	runes := []rune(initials)
+	for len(string(runes))+1+len(rest)+len(suffix) > clientIdMaxLength && ok && len(runes) > 1 {
+		runes = runes[:len(runes)-1]
+	}
+	stepClientId := string(runes) + "@" + rest + suffix
+	if !ok || len(stepClientId) > clientIdMaxLength {
+		return "", fmt.Errorf("client id %s%s longer than %d characters", clientId, suffix, clientIdMaxLength)
+	}
+	return stepClientId, nil
+}
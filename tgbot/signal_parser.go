@@ -0,0 +1,301 @@
+package tgbot
+
+import (
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parser used to read a signal, saved on the trade request
+const (
+	ParserRules = "rules"
+	ParserLLM   = "llm"
+)
+
+var (
+	// "62 700", "2660.5$", "1,0850"
+	signalNumberPattern = regexp.MustCompile(`\d{1,3}(?:[ \x{00a0}\x{202f}]\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?`)
+	signalBuyPattern    = regexp.MustCompile(`(?i)\b(buy|long|achat|achete|achetez)\b`)
+	signalSellPattern   = regexp.MustCompile(`(?i)\b(sell|short|vente|vends|vendez)\b`)
+	signalOpenTpPattern = regexp.MustCompile(`(?i)\b(open|ouvert|ouverte)\b`)
+	// "SELL LIMIT 2675", "BUY STOP above 1.0920", "stop loss" excluded by the caller
+	signalOrderKindPattern = regexp.MustCompile(`(?i)\b(?:buy|sell|achat|vente)\s+(limit|stop)\b(\s*-?\s*loss)?`)
+	// keywords splitting a signal in parts, the numbers following a keyword belong to it. "TP 1 : 2660" numbered
+	// with a separator, "TP 2660" is not
+	signalKeywordPattern = regexp.MustCompile(`(?i)(?P<tp>\btp\s*\d\s*[:=)]|\b(?:tp\d?|(?:take\s*profit|takeprofit|target|objectif)\s*\d?)\b)|` +
+		`(?P<sl>\b(?:sl|stop\s*-?\s*loss|stoploss)\b)|` +
+		`(?P<entry>\b(?:entry|entree|zone|price|prix|at)\b|@)|` +
+		`(?P<direction>\b(?:buy|long|achat|achete|achetez|sell|short|vente|vends|vendez)\b)`)
+	signalSymbolDigitsPattern = regexp.MustCompile(`(?i)\b[a-z]+\d+[a-z]*\b`)
+	signalParenthesisPattern  = regexp.MustCompile(`\([^)]*\)`)
+	signalWordPattern         = regexp.MustCompile(`[A-Za-z0-9]+`)
+	signalAccentReplacer      = strings.NewReplacer("é", "e", "è", "e", "ê", "e", "É", "E", "È", "E", "à", "a")
+	signalNumberReplacer      = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", ",", ".")
+)
+
+// common names used by channels for broker symbols
+var signalSymbolAliases = map[string]string{
+	"GOLD":    "XAUUSD",
+	"SILVER":  "XAGUSD",
+	"ARGENT":  "XAGUSD",
+	"BITCOIN": "BTCUSD",
+	"BTC":     "BTCUSD",
+	"ETH":     "ETHUSD",
+	"US30":    "US30",
+	"DOW":     "US30",
+	"NASDAQ":  "NAS100",
+	"NAS100":  "NAS100",
+	"US100":   "NAS100",
+	"SP500":   "US500",
+	"US500":   "US500",
+	"DAX":     "GER40",
+	"GER40":   "GER40",
+	"OIL":     "USOIL",
+	"WTI":     "USOIL",
+}
+
+// ruleSignalParser parse signals with the rule based parser and fall back to another parser (the llm) when the
+// rules are not confident enough
+type ruleSignalParser struct {
+	fallback      SignalParser
+	minConfidence float64
+}
+
+func NewRuleSignalParser(fallback SignalParser, minConfidence float64) SignalParser {
+	return &ruleSignalParser{fallback: fallback, minConfidence: minConfidence}
+}
+
+func (p *ruleSignalParser) ParseNewMessage(message string, symbols []string) (*TradeRequest, error) {
+	tradeRequest, confidence := ParseSignalMessage(message, symbols)
+	// the volume is sized on the stop loss and the legs closed at the take profits, a signal without them is left
+	// to the llm
+	if tradeRequest != nil && tradeRequest.StopLoss > 0 && tradeRequest.TakeProfit1 > 0 && confidence >= p.minConfidence {
+		log.Printf("Signal parsed with rules (confidence %.2f): %+v", confidence, *tradeRequest)
+		return tradeRequest, nil
+	}
+	log.Printf("Rules confidence too low (%.2f) or no stop loss or take profit, parsing with the llm", confidence)
+	tradeRequest, err := p.fallback.ParseNewMessage(message, symbols)
+	if err != nil {
+		return nil, err
+	}
+	return tradeRequest, nil
+}
+
+// updates are always parsed by the fallback parser
+func (p *ruleSignalParser) ParseUpdateMessage(message string) (*TradeUpdateRequest, error) {
+	return p.fallback.ParseUpdateMessage(message)
+}
+
+// ParseSignalMessage read a signal written in a rigid format ("BUY XAUUSD @ 2650 SL 2640 TP1 2660") in french or
+// english. it returns the trade request and a confidence between 0 and 1
+func ParseSignalMessage(message string, symbols []string) (*TradeRequest, float64) {
+	tradeRequest := &TradeRequest{
+		EntryZoneMin: -1,
+		EntryZoneMax: -1,
+		Parser:       ParserRules,
+	}
+	confidence := 0.0
+
+	text := signalAccentReplacer.Replace(message)
+	buy := signalBuyPattern.MatchString(text)
+	sell := signalSellPattern.MatchString(text)
+	if buy == sell {
+		// no direction or both
+		return nil, 0
+	}
+	if buy {
+		tradeRequest.ActionType = "ORDER_TYPE_BUY"
+	} else {
+		tradeRequest.ActionType = "ORDER_TYPE_SELL"
+	}
+	confidence += 0.3
+	tradeRequest.OrderKind = findSignalOrderKind(text)
+
+	tradeRequest.Symbol = findSignalSymbol(message, symbols)
+	if tradeRequest.Symbol == "" {
+		return nil, 0
+	}
+	confidence += 0.3
+
+	var takeProfits []float64
+	keywords := signalKeywords(text)
+	for i, keyword := range keywords {
+		end := len(text)
+		if i+1 < len(keywords) {
+			end = keywords[i+1][0]
+		}
+		part := text[keyword[1]:end]
+		switch {
+		case keyword[signalKeywordPattern.SubexpIndex("tp")*2] >= 0:
+			// "TP1 : 2660", "TP : 2660 / 2670", "TP3 : OUVERT"
+			values := parseSignalNumbers(part)
+			if len(values) == 0 && signalOpenTpPattern.MatchString(part) {
+				takeProfits = append(takeProfits, -1)
+				continue
+			}
+			takeProfits = append(takeProfits, values...)
+		case keyword[signalKeywordPattern.SubexpIndex("sl")*2] >= 0:
+			if values := parseSignalNumbers(part); len(values) > 0 && tradeRequest.StopLoss == 0 {
+				tradeRequest.StopLoss = values[0]
+			}
+		default:
+			// "Zone d'entree : 62 700 - 62 650", "BUY XAUUSD @ 2650"
+			values := parseSignalNumbers(signalSymbolDigitsPattern.ReplaceAllString(part, " "))
+			if len(values) >= 2 {
+				tradeRequest.EntryZoneMin = math.Min(values[0], values[1])
+				tradeRequest.EntryZoneMax = math.Max(values[0], values[1])
+			} else if len(values) == 1 && tradeRequest.EntryZoneMin == -1 {
+				tradeRequest.EntryZoneMin = values[0]
+			}
+		}
+	}
+
+	if tradeRequest.StopLoss > 0 {
+		confidence += 0.2
+	}
+	if len(takeProfits) == 0 {
+		tradeRequest.TakeProfit1 = -1
+	} else {
+		confidence += 0.2
+	}
+	for i, tp := range takeProfits {
+		switch i {
+		case 0:
+			tradeRequest.TakeProfit1 = tp
+		case 1:
+			tradeRequest.TakeProfit2 = tp
+		case 2:
+			tradeRequest.TakeProfit3 = tp
+		}
+	}
+
+	if !signalLevelsAreCoherent(tradeRequest) {
+		confidence -= 0.5
+	}
+	return tradeRequest, math.Max(confidence, 0)
+}
+
+// keywords of a signal, "at" and "@" right after a TP or SL keyword ("TP @ 2660") belong to it and start no entry
+func signalKeywords(text string) [][]int {
+	var keywords [][]int
+	entry := signalKeywordPattern.SubexpIndex("entry") * 2
+	for _, keyword := range signalKeywordPattern.FindAllStringSubmatchIndex(text, -1) {
+		if len(keywords) > 0 && keyword[entry] >= 0 {
+			word := strings.ToLower(text[keyword[0]:keyword[1]])
+			previous := keywords[len(keywords)-1]
+			level := previous[signalKeywordPattern.SubexpIndex("tp")*2] >= 0 || previous[signalKeywordPattern.SubexpIndex("sl")*2] >= 0
+			if (word == "at" || word == "@") && level && strings.Trim(text[previous[1]:keyword[0]], " \t:") == "" {
+				continue
+			}
+		}
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// parse numbers of a line, thousands separated by spaces and decimal commas included
+func parseSignalNumbers(line string) []float64 {
+	var numbers []float64
+	line = signalParenthesisPattern.ReplaceAllString(line, " ")
+	for _, match := range signalNumberPattern.FindAllString(line, -1) {
+		normalized := signalNumberReplacer.Replace(match)
+		value, err := strconv.ParseFloat(normalized, 64)
+		if err != nil || value == 0 {
+			continue
+		}
+		numbers = append(numbers, value)
+	}
+	return numbers
+}
+
+// order kind written after the direction, market by default
+func findSignalOrderKind(text string) string {
+	for _, match := range signalOrderKindPattern.FindAllStringSubmatch(text, -1) {
+		if match[2] != "" {
+			// "SELL STOP LOSS"
+			continue
+		}
+		return strings.ToUpper(match[1])
+	}
+	return OrderKindMarket
+}
+
+// find the broker symbol of a message, by name or by alias
+func findSignalSymbol(message string, symbols []string) string {
+	words := signalWordPattern.FindAllString(strings.ToUpper(message), -1)
+	for i, word := range words {
+		candidates := []string{word}
+		if alias, ok := signalSymbolAliases[word]; ok {
+			candidates = append(candidates, alias)
+		}
+		// "EUR/USD", "EUR USD"
+		if i+1 < len(words) && len(word) == 3 && len(words[i+1]) == 3 {
+			candidates = append(candidates, word+words[i+1])
+		}
+		for _, candidate := range candidates {
+			if len(candidate) < 3 {
+				continue
+			}
+			if symbol := matchBrokerSymbol(candidate, symbols); symbol != "" {
+				return symbol
+			}
+		}
+	}
+	return ""
+}
+
+// broker symbols may carry a suffix ("XAUUSDm")
+func matchBrokerSymbol(candidate string, symbols []string) string {
+	for _, symbol := range symbols {
+		if strings.ToUpper(symbol) == candidate {
+			return symbol
+		}
+	}
+	for _, symbol := range symbols {
+		if strings.HasPrefix(strings.ToUpper(symbol), candidate) && len(symbol)-len(candidate) <= 2 {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// stop loss and take profits must be on the right side of the entry
+func signalLevelsAreCoherent(r *TradeRequest) bool {
+	entry := r.EntryZoneMin
+	if entry <= 0 {
+		entry = r.EntryZoneMax
+	}
+	if entry <= 0 {
+		// market order, compare stop loss and first take profit
+		if r.StopLoss <= 0 || r.TakeProfit1 <= 0 {
+			return true
+		}
+		if r.ActionType == "ORDER_TYPE_BUY" {
+			return r.StopLoss < r.TakeProfit1
+		}
+		return r.StopLoss > r.TakeProfit1
+	}
+	if r.StopLoss > 0 {
+		if r.ActionType == "ORDER_TYPE_BUY" && r.StopLoss >= entry {
+			return false
+		}
+		if r.ActionType == "ORDER_TYPE_SELL" && r.StopLoss <= entry {
+			return false
+		}
+	}
+	for tpNumber := 1; tpNumber <= 3; tpNumber++ {
+		tp := r.TakeProfit(tpNumber)
+		if tp <= 0 {
+			continue
+		}
+		if r.ActionType == "ORDER_TYPE_BUY" && tp <= entry {
+			return false
+		}
+		if r.ActionType == "ORDER_TYPE_SELL" && tp >= entry {
+			return false
+		}
+	}
+	return true
+}
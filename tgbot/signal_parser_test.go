@@ -0,0 +1,147 @@
+package tgbot
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseSignalMessage(t *testing.T) {
+	symbols := []string{"XAUUSD", "EURUSD", "GBPUSD", "BTCUSD", "US30"}
+	tests := []struct {
+		name          string
+		message       string
+		want          *TradeRequest
+		minConfidence float64
+		maxConfidence float64
+	}{
+		{
+			name:          "complete signal",
+			message:       "BUY XAUUSD @ 2650\nSL 2640\nTP1 2660\nTP2 2670",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", StopLoss: 2640, TakeProfit1: 2660, TakeProfit2: 2670, EntryZoneMin: 2650, EntryZoneMax: -1},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "french signal with an entry zone",
+			message:       "GOLD VENTE\nZone d'entrée : 2 655 - 2 650\nStop loss : 2 665\nObjectif 1 : 2 640\nTP3 : OUVERT",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_SELL", Symbol: "XAUUSD", StopLoss: 2665, TakeProfit1: 2640, TakeProfit2: -1, EntryZoneMin: 2650, EntryZoneMax: 2655},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "numbered take profits with a separator",
+			message:       "XAUUSD BUY 2650\nSL 2640\nTP 1 : 2660\nTP 2 : 2670",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", StopLoss: 2640, TakeProfit1: 2660, TakeProfit2: 2670, EntryZoneMin: 2650, EntryZoneMax: -1},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "decimal take profit",
+			message:       "EUR/USD SELL 1.0900\nSL 1.0950\nTP 1.0850",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_SELL", Symbol: "EURUSD", StopLoss: 1.095, TakeProfit1: 1.085, EntryZoneMin: 1.09, EntryZoneMax: -1},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "levels at",
+			message:       "BUY XAUUSD at 2650\nSL at 2640\nTP @ 2660",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", StopLoss: 2640, TakeProfit1: 2660, EntryZoneMin: 2650, EntryZoneMax: -1},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "pending order",
+			message:       "SELL LIMIT GBPUSD 1.2750\nSTOP LOSS 1.2800\nTP 1.2700",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_SELL", Symbol: "GBPUSD", StopLoss: 1.28, TakeProfit1: 1.27, EntryZoneMin: 1.275, EntryZoneMax: -1, OrderKind: OrderKindLimit},
+			minConfidence: 1,
+			maxConfidence: 1,
+		},
+		{
+			name:          "no stop loss",
+			message:       "BUY XAUUSD 2650 TP 2660",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", TakeProfit1: 2660, EntryZoneMin: 2650, EntryZoneMax: -1},
+			minConfidence: 0.8,
+			maxConfidence: 0.8,
+		},
+		{
+			name:          "no take profit",
+			message:       "BUY XAUUSD 2650 SL 2640",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", StopLoss: 2640, TakeProfit1: -1, EntryZoneMin: 2650, EntryZoneMax: -1},
+			minConfidence: 0.8,
+			maxConfidence: 0.8,
+		},
+		{
+			name:          "stop loss on the wrong side",
+			message:       "BUY XAUUSD 2650 SL 2660 TP 2670",
+			want:          &TradeRequest{ActionType: "ORDER_TYPE_BUY", Symbol: "XAUUSD", StopLoss: 2660, TakeProfit1: 2670, EntryZoneMin: 2650, EntryZoneMax: -1},
+			maxConfidence: 0.5,
+		},
+		{name: "no direction", message: "XAUUSD 2650 SL 2640 TP 2660"},
+		{name: "both directions", message: "BUY or SELL XAUUSD SL 2640 TP 2660"},
+		{name: "unknown symbol", message: "BUY USDCHF 0.9000 SL 0.8950 TP 0.9050"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, confidence := ParseSignalMessage(test.message, symbols)
+			if test.want == nil {
+				if got != nil || confidence != 0 {
+					t.Fatalf("got %+v (confidence %.2f), want nothing", got, confidence)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("got nothing")
+			}
+			want := *test.want
+			want.Parser = ParserRules
+			if want.OrderKind == "" {
+				want.OrderKind = OrderKindMarket
+			}
+			if *got != want {
+				t.Errorf("got %+v, want %+v", *got, want)
+			}
+			if confidence < test.minConfidence-1e-9 || confidence > test.maxConfidence+1e-9 {
+				t.Errorf("confidence %.2f, want between %.2f and %.2f", confidence, test.minConfidence, test.maxConfidence)
+			}
+		})
+	}
+}
+
+// fallbackParser counts the messages left by the rules
+type fallbackParser struct {
+	SignalParser
+	calls int
+}
+
+func (p *fallbackParser) ParseNewMessage(message string, symbols []string) (*TradeRequest, error) {
+	p.calls++
+	return nil, errors.New("llm")
+}
+
+func TestRuleSignalParserFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		fallback bool
+	}{
+		{name: "complete signal", message: "BUY XAUUSD 2650 SL 2640 TP 2660"},
+		{name: "no stop loss", message: "BUY XAUUSD 2650 TP 2660", fallback: true},
+		{name: "no take profit", message: "BUY XAUUSD 2650 SL 2640", fallback: true},
+		{name: "open take profit only", message: "BUY XAUUSD 2650 SL 2640 TP OPEN", fallback: true},
+		{name: "no signal", message: "Good morning traders", fallback: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fallback := &fallbackParser{}
+			parser := NewRuleSignalParser(fallback, 0.8)
+			request, err := parser.ParseNewMessage(test.message, []string{"XAUUSD"})
+			if test.fallback != (fallback.calls == 1) {
+				t.Fatalf("fallback called %d times", fallback.calls)
+			}
+			if !test.fallback && (err != nil || request == nil || math.Abs(request.StopLoss-2640) > 1e-9) {
+				t.Errorf("got %+v, %v", request, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package tgbot
+
+import (
+	"fmt"
+	"log"
+)
+
+// a buy limit must be under the ask, a buy stop above it. the other way around for sell orders with the bid
+func isPendingOrderPriceValid(r *TradeRequest, currentPrice float64) bool {
+	below := r.OpenPrice < currentPrice
+	if r.ActionType == "ORDER_TYPE_BUY" {
+		return below == (r.OrderKind == OrderKindLimit)
+	}
+	return below == (r.OrderKind == OrderKindStop)
+}
+
+// pending orders placed from a signal message
+func (tgBot *TgBot) messageOrders(channelID int64, messageId int) ([]MetaApiPosition, error) {
+	orders, err := tgBot.Broker.Orders()
+	if err != nil {
+		return nil, err
+	}
+	return getPositionsByMessageId(filterPositionsByChannel(orders, channelID), messageId), nil
+}
+
+// cancel the pending orders of a signal which is over (tp or sl hit, closed by the channel)
+func (tgBot *TgBot) doCancelOrders(orders []MetaApiPosition, reason string) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	botMessage := fmt.Sprintf("🚫 Cancel pending orders (%s)", reason)
+	replyToMessageId := 0
+	var lastErr error
+	for _, order := range orders {
+		if replyToMessageId == 0 {
+			replyToMessageId = int(tgBot.RedisClient.GetPositionMessageId(order.ID))
+		}
+		err := tgBot.doCancelOrder(order)
+		if err != nil {
+			log.Printf("Error cancelling order %s: %v", order.ID, err)
+			botMessage = fmt.Sprintf("%s\n❌ Order ID: %s not cancelled: %v", botMessage, order.ID, err)
+			lastErr = err
+			continue
+		}
+		botMessage = fmt.Sprintf("%s\n➡️Cancelled TP%d order ID: %s", botMessage, extractTPFromClientId(order.ClientID), order.ID)
+	}
+	_, errM := tgBot.sendMessage(botMessage, replyToMessageId)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+	return lastErr
+}
+
+// modify stop loss or take profit of pending orders, 0 keeps the current value. tpNumber 0 modifies every order
+func (tgBot *TgBot) doModifyOrders(orders []MetaApiPosition, stopLoss float64, takeProfit float64, tpNumber int) error {
+	var lastErr error
+	for _, order := range orders {
+		if tpNumber > 0 && extractTPFromClientId(order.ClientID) != tpNumber {
+			continue
+		}
+		metaApiRequest := MetaApiTradeRequest{
+			ActionType: "ORDER_MODIFY",
+			OrderID:    &order.ID,
+			OpenPrice:  &order.OpenPrice,
+			StopLoss:   &order.StopLoss,
+			TakeProfit: &order.TakeProfit,
+		}
+		if stopLoss > 0 {
+			metaApiRequest.StopLoss = &stopLoss
+		}
+		if takeProfit > 0 {
+			metaApiRequest.TakeProfit = &takeProfit
+		}
+		_, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error modifying order %s: %v", order.ID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// cancel the pending orders left (ladder steps, limits of the other legs) of the signals whose TP1 leg the broker
+// closed at its take profit, they would open new positions after the trade is done
+func (tgBot *TgBot) cancelOrdersAfterTP1() {
+	orders, err := tgBot.Broker.Orders()
+	if err != nil {
+		log.Printf("Error fetching orders: %v", err)
+		return
+	}
+	type signalKey struct {
+		channelID int64
+		messageId int
+	}
+	pending := make(map[signalKey]bool)
+	for _, order := range orders {
+		if messageId := extractMessageIdFromClientId(order.ClientID); messageId > 0 {
+			pending[signalKey{int64(extractChannelIDFromClientId(order.ClientID)), messageId}] = true
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	deals, err := tgBot.getTodayPositions()
+	if err != nil {
+		log.Printf("Error fetching today deals: %v", err)
+		return
+	}
+	for _, deal := range deals {
+		if deal.Reason != "DEAL_REASON_TP" || extractTPFromClientId(deal.ClientID) != 1 {
+			continue
+		}
+		key := signalKey{int64(extractChannelIDFromClientId(deal.ClientID)), extractMessageIdFromClientId(deal.ClientID)}
+		if !pending[key] {
+			continue
+		}
+		delete(pending, key)
+		messageOrders := getPositionsByMessageId(filterPositionsByChannel(orders, key.channelID), key.messageId)
+		if err := tgBot.doCancelOrders(messageOrders, "TP1 hit"); err != nil {
+			log.Printf("Error cancelling the orders of message %d after TP1: %v", key.messageId, err)
+		}
+	}
+}
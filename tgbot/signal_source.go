@@ -0,0 +1,90 @@
+package tgbot
+
+import (
+	"github.com/gotd/td/tg"
+)
+
+// general topic of a forum, messages posted there have no topic in their reply header
+const forumGeneralTopicId = 1
+
+// channel, supergroup or basic group a message comes from
+type messageSource struct {
+	ID         int64
+	Title      string
+	AccessHash int64
+	Forum      bool
+}
+
+// resolve the source of a message from its peer. nil for private messages or unknown peers
+func resolveMessageSource(e tg.Entities, m *tg.Message) *messageSource {
+	switch peer := m.PeerID.(type) {
+	case *tg.PeerChannel:
+		channel, ok := e.Channels[peer.ChannelID]
+		if !ok {
+			return &messageSource{ID: peer.ChannelID}
+		}
+		return &messageSource{ID: channel.ID, Title: channel.Title, AccessHash: channel.AccessHash, Forum: channel.Forum}
+	case *tg.PeerChat:
+		chat, ok := e.Chats[peer.ChatID]
+		if !ok {
+			return &messageSource{ID: peer.ChatID}
+		}
+		return &messageSource{ID: chat.ID, Title: chat.Title}
+	}
+	return nil
+}
+
+// topic of a message posted in a forum, 0 if the source is not a forum
+func messageTopicId(source *messageSource, m *tg.Message) int {
+	if !source.Forum {
+		return 0
+	}
+	header, ok := m.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || !header.ForumTopic {
+		return forumGeneralTopicId
+	}
+	// reply inside a topic : the topic is the top message, else the replied message is the topic itself
+	if topId, ok := header.GetReplyToTopID(); ok {
+		return topId
+	}
+	if replyToMsgId, ok := header.GetReplyToMsgID(); ok {
+		return replyToMsgId
+	}
+	return forumGeneralTopicId
+}
+
+// id of the message replied to, 0 if the message is not a reply (a message posted in a topic is not a reply)
+func messageReplyToId(m *tg.Message) int {
+	header, ok := m.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok {
+		return 0
+	}
+	replyToMsgId, ok := header.GetReplyToMsgID()
+	if !ok {
+		return 0
+	}
+	if header.ForumTopic {
+		if _, hasTop := header.GetReplyToTopID(); !hasTop {
+			return 0
+		}
+	}
+	return replyToMsgId
+}
+
+// a source is allowed when it is in the working channels and, if some of its topics are whitelisted, the
+// message comes from one of them
+func (tgBot *TgBot) isSourceAllowed(source *messageSource, topicId int) bool {
+	if !tgBot.RedisClient.IsChannelExist(source.ID) {
+		return false
+	}
+	topics := tgBot.RedisClient.GetChannelTopics(source.ID)
+	if len(topics) == 0 {
+		return true
+	}
+	for _, topic := range topics {
+		if topic == topicId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package tgbot
+
+import (
+	"fmt"
+	"math"
+)
+
+// what to do with a signal received after its entry
+const (
+	StaleActionSkip = "SKIP"
+	// park a limit order at the edge of the entry zone
+	StaleActionLimit = "LIMIT"
+)
+
+// staleSignalReason tells why a signal can not be taken at the current price, empty when it still can.
+// beyondStopLoss is true when the signal is lost whatever the action
+func staleSignalReason(r *TradeRequest, zoneMin, zoneMax, currentPrice, minRewardRisk float64) (reason string, beyondStopLoss bool) {
+	buy := r.ActionType == "ORDER_TYPE_BUY"
+	if r.StopLoss > 0 && ((buy && currentPrice <= r.StopLoss) || (!buy && currentPrice >= r.StopLoss)) {
+		return fmt.Sprintf("price %.5f already beyond the stop loss %.5f", currentPrice, r.StopLoss), true
+	}
+	if r.TakeProfit1 <= 0 {
+		// TP1 open, nothing to compare with
+		return "", false
+	}
+	if (buy && currentPrice >= r.TakeProfit1) || (!buy && currentPrice <= r.TakeProfit1) {
+		return fmt.Sprintf("price %.5f already beyond TP1 %.5f", currentPrice, r.TakeProfit1), false
+	}
+	if minRewardRisk <= 0 || r.StopLoss <= 0 {
+		return "", false
+	}
+	rewardRisk := math.Abs(r.TakeProfit1-currentPrice) / math.Abs(currentPrice-r.StopLoss)
+	if rewardRisk >= minRewardRisk {
+		return "", false
+	}
+	reason = fmt.Sprintf("reward to risk %.2f at %.5f under %.2f", rewardRisk, currentPrice, minRewardRisk)
+	if entry := staleLimitPrice(r, zoneMin, zoneMax, currentPrice, minRewardRisk); entry > 0 {
+		entryRewardRisk := math.Abs(r.TakeProfit1-entry) / math.Abs(entry-r.StopLoss)
+		reason = fmt.Sprintf("%s (%.2f at entry %.5f)", reason, entryRewardRisk, entry)
+	}
+	return reason, false
+}
+
+// price of the limit order parked for a stale signal, 0 when there is none : the edge of the entry zone reached first
+// when the price comes back (the top of the zone for a buy), moved into the zone until the reward to risk is met. the
+// order is on the side of the quote a limit order needs, below the ask for a buy
+func staleLimitPrice(r *TradeRequest, zoneMin, zoneMax, currentPrice, minRewardRisk float64) float64 {
+	if zoneMin <= 0 {
+		return 0
+	}
+	if zoneMax <= 0 {
+		zoneMax = zoneMin
+	}
+	low, high := math.Min(zoneMin, zoneMax), math.Max(zoneMin, zoneMax)
+	buy := r.ActionType == "ORDER_TYPE_BUY"
+	entry := low
+	if buy {
+		entry = high
+	}
+	if minRewardRisk > 0 && r.StopLoss > 0 && r.TakeProfit1 > 0 {
+		// price where the reward to risk is exactly the minimum, better for a buy below it
+		rewardRiskPrice := (r.TakeProfit1 + minRewardRisk*r.StopLoss) / (1 + minRewardRisk)
+		if buy {
+			entry = math.Min(entry, rewardRiskPrice)
+		} else {
+			entry = math.Max(entry, rewardRiskPrice)
+		}
+	}
+	if entry < low || entry > high {
+		return 0
+	}
+	if buy && (entry >= currentPrice || (r.StopLoss > 0 && entry <= r.StopLoss) || (r.TakeProfit1 > 0 && entry >= r.TakeProfit1)) {
+		return 0
+	}
+	if !buy && (entry <= currentPrice || (r.StopLoss > 0 && entry >= r.StopLoss) || (r.TakeProfit1 > 0 && entry <= r.TakeProfit1)) {
+		return 0
+	}
+	return entry
+}
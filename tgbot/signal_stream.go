@@ -0,0 +1,171 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"time"
+)
+
+// signals pending on a stopped consumer are claimed after this delay, longer than the retries of a signal
+const signalClaimMinIdle = time.Minute
+
+// a failed signal is retried in its channel queue after this delay, doubled up to signalRetryMaxDelay
+const (
+	signalRetryDelay    = time.Second
+	signalRetryMaxDelay = 10 * time.Second
+)
+
+// consume trading signals from the redis stream. a signal is acknowledged once handled, a failed one is retried
+// at once in its channel queue (the following signals of the channel wait) and moved to the dead letter stream
+// after too many attempts. signals left pending by a crash are delivered again on restart or claimed from the
+// stopped consumer. signals are handled in order per channel and in parallel between channels
+func (tgBot *TgBot) consumeSignals(ctx context.Context, log *zap.Logger) error {
+	err := tgBot.RedisClient.CreateSignalConsumerGroup()
+	if err != nil {
+		return err
+	}
+	consumer := tgBot.AppConfig.SignalConsumerName
+	dispatcher := newSignalDispatcher(tgBot.AppConfig.SignalWorkers)
+
+	// signals delivered to this consumer before a restart but never acknowledged
+	messages, err := tgBot.RedisClient.ReadSignals(consumer, "0", -1)
+	if err != nil {
+		return err
+	}
+	tgBot.dispatchSignals(ctx, log, dispatcher, messages)
+
+	lastClaim := time.Now()
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) > signalClaimMinIdle {
+			// signals left pending by a stopped consumer
+			lastClaim = time.Now()
+			messages, err = tgBot.RedisClient.ClaimIdleSignals(consumer, signalClaimMinIdle)
+			if err != nil {
+				log.Error("Error claiming idle trading signals", zap.Error(err))
+			}
+			tgBot.dispatchSignals(ctx, log, dispatcher, messages)
+		}
+		messages, err = tgBot.RedisClient.ReadSignals(consumer, ">", 5*time.Second)
+		if err != nil {
+			log.Error("Error reading trading signals", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		tgBot.dispatchSignals(ctx, log, dispatcher, messages)
+	}
+	return ctx.Err()
+}
+
+// claimed signals go through the same queues, after the signals of their channel already queued
+func (tgBot *TgBot) dispatchSignals(ctx context.Context, log *zap.Logger, dispatcher *signalDispatcher, messages []redis.XMessage) {
+	for _, message := range messages {
+		message := message
+		dispatcher.dispatch(signalChannelID(message), message.ID, func() {
+			tgBot.consumeSignal(ctx, log, message)
+		})
+	}
+}
+
+// channel of a stream entry, 0 when it can not be read (the entry is then handled on its own queue)
+func signalChannelID(message redis.XMessage) int64 {
+	payload, ok := message.Values["payload"].(string)
+	if !ok {
+		return 0
+	}
+	var input HandleRequestInput
+	if json.Unmarshal([]byte(payload), &input) != nil {
+		return 0
+	}
+	return input.ChannelID
+}
+
+func (tgBot *TgBot) consumeSignal(ctx context.Context, log *zap.Logger, message redis.XMessage) {
+	payload, ok := message.Values["payload"].(string)
+	if !ok {
+		// entry trimmed from the stream, nothing to handle
+		_ = tgBot.RedisClient.AckSignal(message.ID)
+		return
+	}
+	// deliveries before this one failed (crash of the consumer)
+	attempts := tgBot.RedisClient.GetSignalDeliveryCount(message.ID)
+	if attempts > tgBot.AppConfig.SignalMaxDeliveries {
+		tgBot.deadLetterSignal(log, message, attempts-1)
+		return
+	}
+	log.Info("Received message", zap.String("id", message.ID), zap.String("payload", payload))
+	var tradeRequest HandleRequestInput
+	err := json.Unmarshal([]byte(payload), &tradeRequest)
+	if err != nil {
+		log.Error("Error unmarshalling trade request", zap.Error(err))
+		_ = tgBot.RedisClient.DeadLetterSignal(message, err.Error())
+		return
+	}
+	delay := signalRetryDelay
+	for !tgBot.handleSignal(log, tradeRequest) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		if attempts >= tgBot.AppConfig.SignalMaxDeliveries {
+			tgBot.deadLetterSignal(log, message, attempts)
+			return
+		}
+		attempts++
+		log.Warn("Trading signal failed, retrying", zap.String("id", message.ID), zap.Duration("delay", delay))
+		select {
+		case <-ctx.Done():
+			// left pending, it will be delivered again on restart
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, signalRetryMaxDelay)
+	}
+	err = tgBot.RedisClient.AckSignal(message.ID)
+	if err != nil {
+		log.Error("Error acknowledging trading signal", zap.Error(err))
+	}
+}
+
+func (tgBot *TgBot) deadLetterSignal(log *zap.Logger, message redis.XMessage, failures int64) {
+	log.Error("Trading signal failed too many times", zap.String("id", message.ID), zap.Int64("failures", failures))
+	err := tgBot.RedisClient.DeadLetterSignal(message, fmt.Sprintf("failed %d times", failures))
+	if err != nil {
+		log.Error("Error moving trading signal to dead letter", zap.Error(err))
+		return
+	}
+	tgBot.sendMessage(fmt.Sprintf("☠️ Trading signal %s failed %d times and has been dropped", message.ID, failures), 0)
+}
+
+// handle a trading signal. returns false when the signal could not be handled till the end (crash) and
+// must be delivered again
+func (tgBot *TgBot) handleSignal(log *zap.Logger, tradeRequest HandleRequestInput) (handled bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Panic handling trade request", zap.Any("panic", r))
+			handled = false
+		}
+	}()
+	if tradeRequest.Deleted {
+		// nothing to show, the message is gone
+		tgBot.fanOutSignal(tradeRequest)
+		return true
+	}
+	// get chat id
+	chatId := tgBot.RedisClient.GetChatId()
+	// send message to chat
+	headerMessage := "Trading signal from " + tradeRequest.ChannelName
+	if tradeRequest.Edited {
+		headerMessage = "Signal edited in " + tradeRequest.ChannelName
+	}
+	botM := headerMessage + "\n" + tradeRequest.Message
+	_, errSend := tgBot.Bot.SendMessage(chatId, botM, nil)
+	if errSend != nil {
+		log.Error("Error sending message to chat", zap.Error(errSend))
+		return false
+	}
+	// handle request, on each account
+	tgBot.fanOutSignal(tradeRequest)
+	return true
+}
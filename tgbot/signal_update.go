@@ -0,0 +1,168 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// take profit hit on a signal : close the leg left open by the channel (TP "OPEN") then breakeven the others
+func (tgBot *TgBot) doTakeProfitHit(channelID int64, parentRequest *TradeRequest, positions []MetaApiPosition, tpNumber int) ([]MetaApiPosition, error) {
+	if parentRequest.TakeProfit(tpNumber) == -1 {
+		// manual close of the tp
+		position := getPositionByMessageIdAndTP(positions, *parentRequest.MessageId, tpNumber)
+		if position != nil && position.TakeProfit == 0 {
+			_ = tgBot.doCloseTrade([]MetaApiPosition{*position})
+			var err error
+			positions, err = tgBot.messagePositions(channelID, *parentRequest.MessageId)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tpNumber > 3 {
+		// there is no leg for the tp4, the legs still running without take profit are closed
+		var openLegs []MetaApiPosition
+		for _, position := range positions {
+			if position.TakeProfit == 0 {
+				openLegs = append(openLegs, position)
+			}
+		}
+		if len(openLegs) > 0 {
+			_ = tgBot.doCloseTrade(openLegs)
+			var err error
+			positions, err = tgBot.messagePositions(channelID, *parentRequest.MessageId)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tgBot.RedisClient.IsBreakevenEnabled(int(channelID)) {
+		tgBot.doBreakeven(positions, tpNumber)
+	}
+	return positions, nil
+}
+
+// secure profit : close the configured percentage of every leg then move the rest to breakeven
+func (tgBot *TgBot) doSecureProfit(channelID int64, messageId int, positions []MetaApiPosition) error {
+	percent := float64(tgBot.RedisClient.GetChannelSecureProfitPercent(int(channelID)))
+	if percent >= 100 {
+		return tgBot.doCloseTrade(positions)
+	}
+	var partialErr error
+	if percent > 0 {
+		// the legs are moved to breakeven even when the partial close failed
+		partialErr = tgBot.doPartialClose(positions, percent)
+		var err error
+		positions, err = tgBot.messagePositions(channelID, messageId)
+		if err != nil {
+			return errors.Join(partialErr, err)
+		}
+	}
+	return errors.Join(partialErr, tgBot.doSlToEntryPrice(positions))
+}
+
+// stop loss hit announced by the channel : the legs still opened (other stop loss, manual move) are closed
+func (tgBot *TgBot) doStopLossHit(positions []MetaApiPosition) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	tgBot.sendMessage(fmt.Sprintf("🔴 Stop loss hit, closing %d remaining position(s)", len(positions)),
+		int(tgBot.RedisClient.GetPositionMessageId(positions[0].ID)))
+	return tgBot.doCloseTrade(positions)
+}
+
+// close a percentage of the volume of each position, the whole position when the rest would be under the minimum volume
+func (tgBot *TgBot) doPartialClose(positions []MetaApiPosition, percent float64) error {
+	if percent <= 0 || percent > 100 {
+		return errors.New("invalid partial close percentage")
+	}
+	botMessage := fmt.Sprintf("✅ Close %.0f%% of the trade 🎉", percent)
+	replyToMessageId := 0
+	var lastErr error
+	for _, position := range positions {
+		if replyToMessageId == 0 {
+			replyToMessageId = int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+		}
+		// lots the broker accepts on the symbol
+		volume := tgBot.specifications.floorVolumeStep(position.Volume*percent/100, position.Symbol)
+		minVolume := tgBot.specifications.minVolume(position.Symbol)
+		if volume < minVolume {
+			botMessage = fmt.Sprintf("%s\n⚠️ Position ID: %s volume %.2f too low to close %.0f%%", botMessage, position.ID,
+				position.Volume, percent)
+			continue
+		}
+		metaApiRequest := MetaApiTradeRequest{
+			ActionType: "POSITION_PARTIAL",
+			PositionID: &position.ID,
+			Volume:     &volume,
+		}
+		// a remainder under the minimum could not be closed later
+		if position.Volume-volume < minVolume-1e-9 {
+			metaApiRequest = MetaApiTradeRequest{
+				ActionType: "POSITION_CLOSE_ID",
+				PositionID: &position.ID,
+			}
+			volume = position.Volume
+		}
+		_, err := tgBot.Executor.Execute(metaApiRequest)
+		if err != nil {
+			log.Printf("Error closing position %s partially: %v", position.ID, err)
+			botMessage = fmt.Sprintf("%s\n❌ Position ID: %s not closed: %v", botMessage, position.ID, err)
+			lastErr = err
+			continue
+		}
+		botMessage = fmt.Sprintf("%s\n➡️Position ID: %s\nVolume: %.2f -> %.2f", botMessage, position.ID, position.Volume,
+			position.Volume-volume)
+	}
+	_, errM := tgBot.sendMessage(botMessage, replyToMessageId)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+	return lastErr
+}
+
+// modify the take profit of the legs of a signal, only the leg of update.TpNumber when given
+func (tgBot *TgBot) doModifyTakeProfit(update *TradeUpdateRequest, positions []MetaApiPosition) error {
+	if update.Value == nil || *update.Value <= 0 {
+		return errors.New("no take profit given")
+	}
+	botMessage := fmt.Sprintf("✅ Modify take profit 🎉")
+	replyToMessageId := 0
+	var lastErr error
+	for _, position := range positions {
+		tpNumber := extractTPFromClientId(position.ClientID)
+		if update.TpNumber != nil && *update.TpNumber != tpNumber {
+			continue
+		}
+		if replyToMessageId == 0 {
+			replyToMessageId = int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+		}
+		err := tgBot.doModifyPosition(position, position.StopLoss, *update.Value)
+		if err != nil {
+			log.Printf("Error modifying take profit of position %s: %v", position.ID, err)
+			botMessage = fmt.Sprintf("%s\n❌ TP%d Position ID: %s not modified: %v", botMessage, tpNumber, position.ID, err)
+			lastErr = err
+			continue
+		}
+		botMessage = fmt.Sprintf("%s\n➡️TP%d Position ID: %s\nTP: %.2f -> %.2f", botMessage, tpNumber, position.ID,
+			position.TakeProfit, *update.Value)
+	}
+	if replyToMessageId == 0 {
+		return errors.New("no position found for the take profit to modify")
+	}
+	_, errM := tgBot.sendMessage(botMessage, replyToMessageId)
+	if errM != nil {
+		log.Printf("Error sending message: %v", errM)
+	}
+	return lastErr
+}
+
+// current positions opened from a signal message of a channel
+func (tgBot *TgBot) messagePositions(channelID int64, messageId int) ([]MetaApiPosition, error) {
+	positions, err := tgBot.Broker.Positions()
+	if err != nil {
+		return nil, err
+	}
+	return getPositionsByMessageId(filterPositionsByChannel(positions, channelID), messageId), nil
+}
@@ -0,0 +1,237 @@
+package tgbot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Strategy tells which TP legs of a signal are placed, how the volume is split between them and what is done
+// with the TPs of the signal that have no leg
+type Strategy struct {
+	Name string `json:"name"`
+	// tp numbers of the legs placed, 1 for TP1
+	Legs []int `json:"legs"`
+	// share of the volume of each leg, the allocation profile of the channel or strategy when empty
+	Weights []float64 `json:"weights,omitempty"`
+	// the TPs without leg before the last one move the stop loss when reached : entry at TP1, previous TP after
+	TrailRemaining bool `json:"trailRemaining,omitempty"`
+}
+
+const DefaultStrategy = "3TP"
+
+// strategies of the bot, user defined ones are added in redis
+var builtinStrategies = map[string]Strategy{
+	"3TP":      {Name: "3TP", Legs: []int{1, 2, 3}},
+	"TP1":      {Name: "TP1", Legs: []int{1}},
+	"TP2":      {Name: "TP2", Legs: []int{1, 2}},
+	"TP1_ONLY": {Name: "TP1_ONLY", Legs: []int{1}, Weights: []float64{1}},
+	"TP2_ONLY": {Name: "TP2_ONLY", Legs: []int{2}, Weights: []float64{1}, TrailRemaining: true},
+	"TP3_ONLY": {Name: "TP3_ONLY", Legs: []int{3}, Weights: []float64{1}, TrailRemaining: true},
+}
+
+// strategy by name, the default one when unknown
+func (tgBot *TgBot) strategy(name string) Strategy {
+	if strategy, ok := builtinStrategies[name]; ok {
+		return strategy
+	}
+	if strategyJson := tgBot.RedisClient.GetCustomStrategy(name); strategyJson != "" {
+		var strategy Strategy
+		if err := json.Unmarshal([]byte(strategyJson), &strategy); err == nil && len(strategy.Legs) > 0 {
+			strategy.Name = name
+			return strategy
+		}
+		log.Printf("Invalid strategy %s: %s", name, strategyJson)
+	}
+	return builtinStrategies[DefaultStrategy]
+}
+
+// built-in strategies then the user defined ones
+func (tgBot *TgBot) strategyNames() []string {
+	names := append([]string(nil), Strategies...)
+	var custom []string
+	for name := range tgBot.RedisClient.GetCustomStrategies() {
+		if !StringInSlice(name, names) {
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+	return append(names, custom...)
+}
+
+// strategy of a placed signal, the current one for signals placed before it was saved
+func (tgBot *TgBot) requestStrategy(request *TradeRequest) Strategy {
+	if request != nil && request.Strategy != "" {
+		return tgBot.strategy(request.Strategy)
+	}
+	return tgBot.strategy(tgBot.strategyName())
+}
+
+// tp numbers of the legs placed for a signal. when the signal has none of the TPs of the strategy, the furthest TP
+// before them is used (TP3_ONLY on a signal with 2 TPs is placed on TP2)
+func (s Strategy) legsFor(r *TradeRequest) []int {
+	var legs []int
+	lastLeg := 0
+	for _, tpNumber := range s.Legs {
+		if hasTakeProfit(r, tpNumber) {
+			legs = append(legs, tpNumber)
+		}
+		if tpNumber > lastLeg {
+			lastLeg = tpNumber
+		}
+	}
+	if len(legs) > 0 {
+		return legs
+	}
+	for tpNumber := lastLeg - 1; tpNumber > 0; tpNumber-- {
+		if hasTakeProfit(r, tpNumber) {
+			return []int{tpNumber}
+		}
+	}
+	return nil
+}
+
+// a TP given by the signal, -1 is a TP closed by hand
+func hasTakeProfit(r *TradeRequest, tpNumber int) bool {
+	tp := r.TakeProfit(tpNumber)
+	return tp > 0 || tp == -1
+}
+
+func (s Strategy) hasLeg(tpNumber int) bool {
+	for _, leg := range s.Legs {
+		if leg == tpNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// volume share of the legs placed
+func (s Strategy) legWeights(legs []int, allocationProfile string) []float64 {
+	if len(s.Weights) != len(s.Legs) {
+		return allocationProfileWeights(allocationProfile, len(legs))
+	}
+	weights := make([]float64, len(legs))
+	for i, tpNumber := range legs {
+		weights[i] = 1
+		for j, leg := range s.Legs {
+			if leg == tpNumber {
+				weights[i] = s.Weights[j]
+			}
+		}
+	}
+	return weights
+}
+
+// TPs of the signal without leg reached before the TP of a leg, they move its stop loss
+func (s Strategy) trailTargets(r *TradeRequest, legTp int) []int {
+	if !s.TrailRemaining {
+		return nil
+	}
+	var targets []int
+	for tpNumber := 1; tpNumber < legTp; tpNumber++ {
+		if r.TakeProfit(tpNumber) > 0 && !s.hasLeg(tpNumber) {
+			targets = append(targets, tpNumber)
+		}
+	}
+	return targets
+}
+
+func (s Strategy) String() string {
+	var legs []string
+	for i, tpNumber := range s.Legs {
+		leg := "TP" + strconv.Itoa(tpNumber)
+		if len(s.Weights) == len(s.Legs) {
+			leg = fmt.Sprintf("%s %.0f%%", leg, s.Weights[i]*100)
+		}
+		legs = append(legs, leg)
+	}
+	text := strings.Join(legs, " + ")
+	if s.TrailRemaining {
+		text += " (other TPs trail the SL)"
+	}
+	return text
+}
+
+// parse "NAME 1,3 60/40 trail" : name, tp numbers of the legs, optional volume split in percent and trailing
+func parseStrategy(args []string) (Strategy, error) {
+	if len(args) < 2 {
+		return Strategy{}, errors.New("usage: /add_strategy NAME 1,3 [60/40] [trail]")
+	}
+	strategy := Strategy{Name: strings.ToUpper(args[0])}
+	if len(strategy.Name) > 20 {
+		return Strategy{}, errors.New("the name is limited to 20 characters")
+	}
+	if _, ok := builtinStrategies[strategy.Name]; ok {
+		return Strategy{}, fmt.Errorf("%s is a built-in strategy", strategy.Name)
+	}
+	for _, leg := range strings.Split(args[1], ",") {
+		tpNumber, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(leg)), "TP"))
+		if err != nil || tpNumber < 1 || tpNumber > 3 {
+			return Strategy{}, fmt.Errorf("invalid leg %s, TP1 to TP3", leg)
+		}
+		if strategy.hasLeg(tpNumber) {
+			return Strategy{}, fmt.Errorf("leg TP%d given twice", tpNumber)
+		}
+		strategy.Legs = append(strategy.Legs, tpNumber)
+	}
+	for _, arg := range args[2:] {
+		if strings.EqualFold(arg, "trail") {
+			strategy.TrailRemaining = true
+			continue
+		}
+		parts := strings.Split(arg, "/")
+		if len(parts) != len(strategy.Legs) {
+			return Strategy{}, fmt.Errorf("volume split %s must have %d parts", arg, len(strategy.Legs))
+		}
+		total := 0.0
+		strategy.Weights = nil
+		for _, part := range parts {
+			percent, err := strconv.ParseFloat(part, 64)
+			if err != nil || percent <= 0 {
+				return Strategy{}, fmt.Errorf("invalid volume split %s", arg)
+			}
+			total += percent
+			strategy.Weights = append(strategy.Weights, percent)
+		}
+		for i := range strategy.Weights {
+			strategy.Weights[i] = strategy.Weights[i] / total
+		}
+	}
+	// legs in TP order, each keeping the part of the volume typed for it
+	order := make([]int, len(strategy.Legs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return strategy.Legs[order[i]] < strategy.Legs[order[j]] })
+	legs := make([]int, len(order))
+	weights := make([]float64, len(strategy.Weights))
+	for i, typed := range order {
+		legs[i] = strategy.Legs[typed]
+		if len(weights) > 0 {
+			weights[i] = strategy.Weights[typed]
+		}
+	}
+	strategy.Legs = legs
+	if len(weights) > 0 {
+		strategy.Weights = weights
+	}
+	return strategy, nil
+}
+
+// trade request saved when the signal was placed
+func (tgBot *TgBot) storedTradeRequest(messageId int) *TradeRequest {
+	requestBytes := tgBot.RedisClient.GetTradeRequest(int64(messageId))
+	if requestBytes == nil {
+		return nil
+	}
+	var request TradeRequest
+	if err := json.Unmarshal(requestBytes, &request); err != nil || request.Symbol == "" {
+		return nil
+	}
+	return &request
+}
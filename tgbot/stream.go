@@ -0,0 +1,315 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// events of the account synchronization
+const (
+	// full list of the positions, replace the known ones
+	StreamEventPositions = "positions"
+	// full list of the pending orders
+	StreamEventOrders = "orders"
+	// deals of the history synchronization
+	StreamEventDeals = "deals"
+	// orders of the history synchronization
+	StreamEventHistoryOrders = "historyOrders"
+	// positions or orders updated or removed, new deals
+	StreamEventUpdate = "update"
+	StreamEventPrices = "prices"
+	// positions and orders are synchronized, the state can be used
+	StreamEventSynchronized = "synchronized"
+	// deals and history orders are synchronized, the history can be used
+	StreamEventHistorySynchronized = "historySynchronized"
+	// the state is not up to date anymore until the next synchronization
+	StreamEventDisconnected = "disconnected"
+)
+
+type StreamEvent struct {
+	Type               string
+	Positions          []MetaApiPosition
+	Orders             []MetaApiPosition
+	RemovedPositionIds []string
+	CompletedOrderIds  []string
+	Deals              []MetaApiPosition
+	HistoryOrders      []MetaApiPosition
+	Prices             []MetaApiPriceResponse
+	// deals and history orders are synchronized from this time
+	DealsFrom time.Time
+}
+
+// PositionStream push the changes of the account until the context is done
+type PositionStream interface {
+	Run(ctx context.Context, handler func(StreamEvent)) error
+}
+
+// StreamConn is a text message connection, a websocket in production
+type StreamConn interface {
+	ReadMessage(ctx context.Context) ([]byte, error)
+	WriteMessage(ctx context.Context, message []byte) error
+	Close() error
+}
+
+type StreamDialer func(ctx context.Context, url string) (StreamConn, error)
+
+type websocketConn struct {
+	conn *websocket.Conn
+}
+
+func DialWebsocket(ctx context.Context, url string) (StreamConn, error) {
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// positions and history packets are bigger than the default limit
+	conn.SetReadLimit(16 << 20)
+	return &websocketConn{conn: conn}, nil
+}
+
+func (c *websocketConn) ReadMessage(ctx context.Context) ([]byte, error) {
+	_, data, err := c.conn.Read(ctx)
+	return data, err
+}
+
+func (c *websocketConn) WriteMessage(ctx context.Context, message []byte) error {
+	return c.conn.Write(ctx, websocket.MessageText, message)
+}
+
+func (c *websocketConn) Close() error {
+	return c.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// metaApiStream speak the MetaApi synchronization protocol (socket.io v2 over a websocket)
+type metaApiStream struct {
+	url       string
+	accountId string
+	token     string
+	dial      StreamDialer
+	requestId int64
+	// symbols with a market data subscription on the current connection
+	subscribed map[string]bool
+	writeMu    sync.Mutex
+}
+
+func NewMetaApiStream(streamURL string, accountId string, token string, dial StreamDialer) PositionStream {
+	return &metaApiStream{url: streamURL, accountId: accountId, token: token, dial: dial}
+}
+
+// websocket url of the MetaApi client api : https://host becomes wss://host/ws/?auth-token=...
+func metaApiStreamURL(endpoint string, token string) string {
+	streamURL := strings.TrimSuffix(endpoint, "/")
+	streamURL = strings.Replace(streamURL, "https://", "wss://", 1)
+	streamURL = strings.Replace(streamURL, "http://", "ws://", 1)
+	return fmt.Sprintf("%s/ws/?auth-token=%s&clientId=%d&protocol=3&EIO=3&transport=websocket", streamURL,
+		url.QueryEscape(token), time.Now().UnixNano())
+}
+
+// reconnect with a growing delay until the context is done
+func (s *metaApiStream) Run(ctx context.Context, handler func(StreamEvent)) error {
+	delay := time.Second
+	for {
+		startTime := time.Now()
+		err := s.session(ctx, handler)
+		handler(StreamEvent{Type: StreamEventDisconnected})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("MetaApi stream disconnected: %v", err)
+		if time.Since(startTime) > time.Minute {
+			delay = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// one connection : subscribe to the account, synchronize it and read the packets
+func (s *metaApiStream) session(ctx context.Context, handler func(StreamEvent)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn, err := s.dial(ctx, s.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s.subscribed = make(map[string]bool)
+
+	for {
+		message, err := conn.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		packet := string(message)
+		switch {
+		case strings.HasPrefix(packet, "0"):
+			// engine.io open, the client must ping the server
+			var open struct {
+				PingInterval int `json:"pingInterval"`
+			}
+			if err := json.Unmarshal([]byte(packet[1:]), &open); err == nil && open.PingInterval > 0 {
+				go s.ping(ctx, conn, time.Duration(open.PingInterval)*time.Millisecond)
+			}
+		case packet == "40":
+			// socket.io connected
+			err = s.request(ctx, conn, map[string]interface{}{"type": "subscribe", "application": "MetaApi"})
+		case strings.HasPrefix(packet, "41"):
+			return errors.New("disconnected by the server")
+		case strings.HasPrefix(packet, "42"):
+			err = s.handleEvent(ctx, conn, []byte(packet[2:]), handler)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *metaApiStream) ping(ctx context.Context, conn StreamConn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.write(ctx, conn, "2"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *metaApiStream) write(ctx context.Context, conn StreamConn, message string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return conn.WriteMessage(ctx, []byte(message))
+}
+
+// emit a request event for the account
+func (s *metaApiStream) request(ctx context.Context, conn StreamConn, request map[string]interface{}) error {
+	s.requestId++
+	request["accountId"] = s.accountId
+	request["requestId"] = strconv.FormatInt(s.requestId, 10)
+	request["instanceIndex"] = 0
+	payload, err := json.Marshal([]interface{}{"request", request})
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, conn, "42"+string(payload))
+}
+
+type metaApiSynchronizationPacket struct {
+	Type               string                 `json:"type"`
+	Host               string                 `json:"host"`
+	Positions          []MetaApiPosition      `json:"positions"`
+	Orders             []MetaApiPosition      `json:"orders"`
+	Deals              []MetaApiPosition      `json:"deals"`
+	HistoryOrders      []MetaApiPosition      `json:"historyOrders"`
+	UpdatedPositions   []MetaApiPosition      `json:"updatedPositions"`
+	RemovedPositionIds []string               `json:"removedPositionIds"`
+	UpdatedOrders      []MetaApiPosition      `json:"updatedOrders"`
+	CompletedOrderIds  []string               `json:"completedOrderIds"`
+	Prices             []MetaApiPriceResponse `json:"prices"`
+}
+
+func (s *metaApiStream) handleEvent(ctx context.Context, conn StreamConn, payload []byte, handler func(StreamEvent)) error {
+	var event []json.RawMessage
+	if err := json.Unmarshal(payload, &event); err != nil || len(event) < 2 {
+		return nil
+	}
+	var name string
+	json.Unmarshal(event[0], &name)
+	switch name {
+	case "processingError":
+		log.Printf("MetaApi stream processing error: %s", string(event[1]))
+		return nil
+	case "synchronization":
+	default:
+		return nil
+	}
+	var packet metaApiSynchronizationPacket
+	if err := json.Unmarshal(event[1], &packet); err != nil {
+		log.Printf("Error decoding MetaApi synchronization packet: %v", err)
+		return nil
+	}
+	switch packet.Type {
+	case "authenticated":
+		// history deals of the day are enough for the daily checks
+		dealsFrom := startOfDay(time.Now())
+		handler(StreamEvent{Type: StreamEventDeals, DealsFrom: dealsFrom})
+		return s.request(ctx, conn, map[string]interface{}{
+			"type":                     "synchronize",
+			"host":                     packet.Host,
+			"startingDealTime":         dealsFrom.UTC().Format(time.RFC3339),
+			"startingHistoryOrderTime": dealsFrom.UTC().Format(time.RFC3339),
+		})
+	case "positions":
+		handler(StreamEvent{Type: StreamEventPositions, Positions: packet.Positions})
+		return s.subscribeSymbols(ctx, conn, packet.Positions)
+	case "orders":
+		handler(StreamEvent{Type: StreamEventOrders, Orders: packet.Orders})
+		return s.subscribeSymbols(ctx, conn, packet.Orders)
+	case "deals":
+		handler(StreamEvent{Type: StreamEventDeals, Deals: packet.Deals})
+	case "historyOrders":
+		handler(StreamEvent{Type: StreamEventHistoryOrders, HistoryOrders: packet.HistoryOrders})
+	case "orderSynchronizationFinished":
+		handler(StreamEvent{Type: StreamEventSynchronized})
+	case "dealSynchronizationFinished":
+		handler(StreamEvent{Type: StreamEventHistorySynchronized})
+	case "update":
+		handler(StreamEvent{
+			Type:               StreamEventUpdate,
+			Positions:          packet.UpdatedPositions,
+			RemovedPositionIds: packet.RemovedPositionIds,
+			Orders:             packet.UpdatedOrders,
+			CompletedOrderIds:  packet.CompletedOrderIds,
+			Deals:              packet.Deals,
+			HistoryOrders:      packet.HistoryOrders,
+		})
+		if err := s.subscribeSymbols(ctx, conn, packet.UpdatedPositions); err != nil {
+			return err
+		}
+		return s.subscribeSymbols(ctx, conn, packet.UpdatedOrders)
+	case "prices":
+		handler(StreamEvent{Type: StreamEventPrices, Prices: packet.Prices})
+	case "disconnected":
+		return errors.New("account disconnected from the broker")
+	}
+	return nil
+}
+
+// quotes of the symbols traded, to follow the profit of the positions
+func (s *metaApiStream) subscribeSymbols(ctx context.Context, conn StreamConn, positions []MetaApiPosition) error {
+	for _, position := range positions {
+		if position.Symbol == "" || s.subscribed[position.Symbol] {
+			continue
+		}
+		s.subscribed[position.Symbol] = true
+		err := s.request(ctx, conn, map[string]interface{}{
+			"type":          "subscribeToMarketData",
+			"symbol":        position.Symbol,
+			"subscriptions": []map[string]string{{"type": "quotes"}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// prices older than this are asked to the broker
+const streamPriceMaxAge = time.Minute
+
+// streamState is the account as known from the stream : positions, pending orders, deals and history orders of the
+// day and prices
+type streamState struct {
+	mu           sync.RWMutex
+	synchronized bool
+	// the deals and history orders are complete
+	historySynchronized bool
+	positions           map[string]MetaApiPosition
+	orders              map[string]MetaApiPosition
+	deals               []MetaApiPosition
+	historyOrders       map[string]MetaApiPosition
+	dealsFrom           time.Time
+	prices              map[string]MetaApiPriceResponse
+	pricesTime          map[string]time.Time
+}
+
+func newStreamState() *streamState {
+	return &streamState{
+		positions:     make(map[string]MetaApiPosition),
+		orders:        make(map[string]MetaApiPosition),
+		historyOrders: make(map[string]MetaApiPosition),
+		prices:        make(map[string]MetaApiPriceResponse),
+		pricesTime:    make(map[string]time.Time),
+	}
+}
+
+// apply an event, returns true when the positions may need to be managed
+func (s *streamState) apply(event StreamEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch event.Type {
+	case StreamEventPositions:
+		s.positions = positionsById(event.Positions)
+		return true
+	case StreamEventOrders:
+		s.orders = positionsById(event.Orders)
+	case StreamEventDeals:
+		if !event.DealsFrom.IsZero() {
+			// new synchronization of the history
+			s.dealsFrom = event.DealsFrom
+			s.deals = nil
+			s.historyOrders = make(map[string]MetaApiPosition)
+			s.historySynchronized = false
+		}
+		s.addDeals(event.Deals)
+	case StreamEventHistoryOrders:
+		for _, order := range event.HistoryOrders {
+			s.historyOrders[order.ID] = order
+		}
+	case StreamEventSynchronized:
+		s.synchronized = true
+		return true
+	case StreamEventHistorySynchronized:
+		s.historySynchronized = true
+		// the daily checks can run on the whole history
+		return true
+	case StreamEventDisconnected:
+		s.synchronized = false
+		s.historySynchronized = false
+	case StreamEventUpdate:
+		for _, position := range event.Positions {
+			s.positions[position.ID] = position
+		}
+		for _, id := range event.RemovedPositionIds {
+			delete(s.positions, id)
+		}
+		for _, order := range event.Orders {
+			s.orders[order.ID] = order
+		}
+		for _, id := range event.CompletedOrderIds {
+			delete(s.orders, id)
+		}
+		s.addDeals(event.Deals)
+		for _, order := range event.HistoryOrders {
+			s.historyOrders[order.ID] = order
+		}
+		return len(event.Positions) > 0 || len(event.RemovedPositionIds) > 0 || len(event.Deals) > 0
+	case StreamEventPrices:
+		managed := false
+		now := time.Now()
+		for _, price := range event.Prices {
+			s.prices[price.Symbol] = price
+			s.pricesTime[price.Symbol] = now
+			for id, position := range s.positions {
+				if position.Symbol == price.Symbol {
+					s.positions[id] = repricePosition(position, price)
+					managed = true
+				}
+			}
+		}
+		return managed
+	}
+	return false
+}
+
+// deals are sent again after a reconnection
+func (s *streamState) addDeals(deals []MetaApiPosition) {
+	for _, deal := range deals {
+		known := false
+		for i := range s.deals {
+			if s.deals[i].ID == deal.ID && s.deals[i].EntryType == deal.EntryType && s.deals[i].Time == deal.Time {
+				s.deals[i] = deal
+				known = true
+				break
+			}
+		}
+		if !known {
+			s.deals = append(s.deals, deal)
+		}
+	}
+}
+
+// the stream sends the profit only with the position updates, it follows the price in between
+func repricePosition(position MetaApiPosition, price MetaApiPriceResponse) MetaApiPosition {
+	// a buy is closed at the bid
+	currentPrice := price.Bid
+	if position.Type == "POSITION_TYPE_SELL" {
+		currentPrice = price.Ask
+	}
+	if currentPrice <= 0 {
+		return position
+	}
+	if position.CurrentPrice != position.OpenPrice && position.CurrentPrice > 0 {
+		position.Profit = position.Profit * (currentPrice - position.OpenPrice) / (position.CurrentPrice - position.OpenPrice)
+		position.UnrealizedProfit = position.Profit
+	}
+	position.CurrentPrice = currentPrice
+	return position
+}
+
+func (s *streamState) setPositions(positions []MetaApiPosition, orders []MetaApiPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions = positionsById(positions)
+	s.orders = positionsById(orders)
+	// keep the deals and history orders of the day only
+	if today := startOfDay(time.Now()); s.dealsFrom.Before(today) {
+		s.deals = positionsBetween(s.deals, today, time.Now().Add(24*time.Hour))
+		for id, order := range s.historyOrders {
+			if orderTime, err := time.Parse(time.RFC3339, order.Time); err != nil || orderTime.Before(today) {
+				delete(s.historyOrders, id)
+			}
+		}
+		s.dealsFrom = today
+	}
+}
+
+func positionsById(positions []MetaApiPosition) map[string]MetaApiPosition {
+	byId := make(map[string]MetaApiPosition, len(positions))
+	for _, position := range positions {
+		byId[position.ID] = position
+	}
+	return byId
+}
+
+// streamingBroker answer from the stream state when it is synchronized, and from the broker otherwise
+type streamingBroker struct {
+	Broker
+	state *streamState
+}
+
+func newStreamingBroker(broker Broker, state *streamState) *streamingBroker {
+	return &streamingBroker{Broker: broker, state: state}
+}
+
+func (b *streamingBroker) Positions() ([]MetaApiPosition, error) {
+	b.state.mu.RLock()
+	if b.state.synchronized {
+		defer b.state.mu.RUnlock()
+		return sortedPositions(b.state.positions), nil
+	}
+	b.state.mu.RUnlock()
+	return b.Broker.Positions()
+}
+
+func (b *streamingBroker) Orders() ([]MetaApiPosition, error) {
+	b.state.mu.RLock()
+	if b.state.synchronized {
+		defer b.state.mu.RUnlock()
+		return sortedPositions(b.state.orders), nil
+	}
+	b.state.mu.RUnlock()
+	return b.Broker.Orders()
+}
+
+func (b *streamingBroker) HistoryDeals(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	b.state.mu.RLock()
+	if b.state.servesHistory(from) {
+		defer b.state.mu.RUnlock()
+		return positionsBetween(b.state.deals, from, to), nil
+	}
+	b.state.mu.RUnlock()
+	return b.Broker.HistoryDeals(from, to)
+}
+
+func (b *streamingBroker) HistoryOrders(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	b.state.mu.RLock()
+	if b.state.servesHistory(from) {
+		defer b.state.mu.RUnlock()
+		return positionsBetween(sortedPositions(b.state.historyOrders), from, to), nil
+	}
+	b.state.mu.RUnlock()
+	return b.Broker.HistoryOrders(from, to)
+}
+
+// the history since a time is known once the deals and history orders are synchronized from it. must be called with
+// the lock held
+func (s *streamState) servesHistory(from time.Time) bool {
+	return s.synchronized && s.historySynchronized && !s.dealsFrom.IsZero() && !from.Before(s.dealsFrom)
+}
+
+// deals or orders with a time between from, included, and to
+func positionsBetween(positions []MetaApiPosition, from time.Time, to time.Time) []MetaApiPosition {
+	var between []MetaApiPosition
+	for _, position := range positions {
+		positionTime, err := time.Parse(time.RFC3339, position.Time)
+		if err == nil && !positionTime.Before(from) && positionTime.Before(to) {
+			between = append(between, position)
+		}
+	}
+	return between
+}
+
+func (b *streamingBroker) Price(symbol string) (*MetaApiPriceResponse, error) {
+	b.state.mu.RLock()
+	price, ok := b.state.prices[symbol]
+	fresh := ok && time.Since(b.state.pricesTime[symbol]) < streamPriceMaxAge
+	b.state.mu.RUnlock()
+	if fresh {
+		return &price, nil
+	}
+	return b.Broker.Price(symbol)
+}
+
+// broker answering from the REST api, without the stream state
+func restBroker(broker Broker) Broker {
+	if streaming, ok := broker.(*streamingBroker); ok {
+		return streaming.Broker
+	}
+	return broker
+}
+
+// reload positions and orders from the broker, in case the stream missed an update
+func (b *streamingBroker) reconcile() error {
+	positions, err := b.Broker.Positions()
+	if err != nil {
+		return err
+	}
+	orders, err := b.Broker.Orders()
+	if err != nil {
+		return err
+	}
+	b.state.setPositions(positions, orders)
+	return nil
+}
+
+// oldest first, like the REST api
+func sortedPositions(byId map[string]MetaApiPosition) []MetaApiPosition {
+	positions := make([]MetaApiPosition, 0, len(byId))
+	for _, position := range byId {
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Time != positions[j].Time {
+			return positions[i].Time < positions[j].Time
+		}
+		return positions[i].ID < positions[j].ID
+	})
+	return positions
+}
+
+// wait between two runs of the position checks triggered by the stream
+const streamCheckInterval = time.Second
+
+// start the MetaApi stream, positions are then managed on its events. false when the broker can not stream
+func (tgBot *TgBot) startStream(ctx context.Context) bool {
+	if !tgBot.AppConfig.Streaming || (tgBot.AppConfig.Broker != BrokerMetaApi && tgBot.AppConfig.Broker != "") {
+		return false
+	}
+	streamURL := tgBot.AppConfig.MetaApiStreamURL
+	if streamURL == "" {
+		streamURL = metaApiStreamURL(tgBot.AppConfig.MetaApiEndpoint, tgBot.AppConfig.MetaApiToken)
+	}
+	stream := NewMetaApiStream(streamURL, tgBot.AppConfig.MetaApiAccountID, tgBot.AppConfig.MetaApiToken, DialWebsocket)
+	tgBot.runStream(ctx, stream)
+	return true
+}
+
+func (tgBot *TgBot) runStream(ctx context.Context, stream PositionStream) {
+	state := newStreamState()
+	tgBot.stream = newStreamingBroker(tgBot.Broker, state)
+	tgBot.Broker = tgBot.stream
+	// one pending check is enough, events arriving meanwhile are merged
+	checks := make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-checks:
+				tgBot.checkCurrentPositions()
+				time.Sleep(streamCheckInterval)
+			}
+		}
+	}()
+	go func() {
+		err := stream.Run(ctx, func(event StreamEvent) {
+			if state.apply(event) {
+				select {
+				case checks <- struct{}{}:
+				default:
+				}
+			}
+		})
+		log.Printf("MetaApi stream stopped: %v", err)
+	}()
+}
+
+// polling kept as a safety net : reload the state from the REST api and check the positions
+func (tgBot *TgBot) reconcilePositions() {
+	if tgBot.stream != nil {
+		if err := tgBot.stream.reconcile(); err != nil {
+			log.Printf("Error reconciling positions: %v", err)
+		}
+	}
+	tgBot.checkCurrentPositions()
+}
@@ -0,0 +1,364 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStreamConn plays the packets of a recorded session and keeps the messages written by the client
+type fakeStreamConn struct {
+	packets chan string
+	mu      sync.Mutex
+	written []string
+	closed  bool
+}
+
+func newFakeStreamConn(packets ...string) *fakeStreamConn {
+	conn := &fakeStreamConn{packets: make(chan string, len(packets))}
+	for _, packet := range packets {
+		conn.packets <- packet
+	}
+	return conn
+}
+
+func (c *fakeStreamConn) ReadMessage(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case packet, ok := <-c.packets:
+		if !ok {
+			return nil, io.EOF
+		}
+		return []byte(packet), nil
+	}
+}
+
+func (c *fakeStreamConn) WriteMessage(ctx context.Context, message []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, string(message))
+	return nil
+}
+
+func (c *fakeStreamConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// requests of the client, by type
+func (c *fakeStreamConn) requests(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var requests []map[string]interface{}
+	for _, message := range c.written {
+		if !strings.HasPrefix(message, "42") {
+			continue
+		}
+		var event []json.RawMessage
+		if err := json.Unmarshal([]byte(message[2:]), &event); err != nil || len(event) != 2 {
+			t.Fatalf("invalid packet %s", message)
+		}
+		var request map[string]interface{}
+		if err := json.Unmarshal(event[1], &request); err != nil {
+			t.Fatalf("invalid request %s", message)
+		}
+		requests = append(requests, request)
+	}
+	return requests
+}
+
+func synchronizationPacket(t *testing.T, packet map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal([]interface{}{"synchronization", packet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "42" + string(payload)
+}
+
+// broker answering the REST positions and orders, used when the stream is not synchronized
+type restPositionsBroker struct {
+	Broker
+	positions []MetaApiPosition
+	orders    []MetaApiPosition
+}
+
+func (b *restPositionsBroker) Positions() ([]MetaApiPosition, error) {
+	return b.positions, nil
+}
+
+func (b *restPositionsBroker) Orders() ([]MetaApiPosition, error) {
+	return b.orders, nil
+}
+
+func TestMetaApiStreamSession(t *testing.T) {
+	position := map[string]interface{}{"id": "1", "type": "POSITION_TYPE_BUY", "symbol": "XAUUSD", "openPrice": 2650,
+		"currentPrice": 2655, "profit": 50, "volume": 0.1, "time": "2024-10-01T10:00:00Z"}
+	order := map[string]interface{}{"id": "2", "type": "ORDER_TYPE_BUY_LIMIT", "symbol": "EURUSD", "openPrice": 1.08}
+	conn := newFakeStreamConn(
+		`0{"sid":"abc","pingInterval":0}`,
+		"40",
+		synchronizationPacket(t, map[string]interface{}{"type": "authenticated", "host": "ps-mpa-1"}),
+		synchronizationPacket(t, map[string]interface{}{"type": "positions", "positions": []interface{}{position}}),
+		synchronizationPacket(t, map[string]interface{}{"type": "orders", "orders": []interface{}{order}}),
+		synchronizationPacket(t, map[string]interface{}{"type": "orderSynchronizationFinished"}),
+		synchronizationPacket(t, map[string]interface{}{"type": "historyOrders", "historyOrders": []interface{}{
+			map[string]interface{}{"id": "4", "symbol": "XAUUSD", "time": time.Now().UTC().Format(time.RFC3339)}}}),
+		synchronizationPacket(t, map[string]interface{}{"type": "dealSynchronizationFinished"}),
+		synchronizationPacket(t, map[string]interface{}{"type": "prices", "prices": []interface{}{
+			map[string]interface{}{"symbol": "XAUUSD", "bid": 2660, "ask": 2660.5}}}),
+		synchronizationPacket(t, map[string]interface{}{"type": "update", "removedPositionIds": []string{"1"},
+			"completedOrderIds": []string{"2"},
+			"deals":             []interface{}{map[string]interface{}{"id": "3", "entryType": "DEAL_ENTRY_OUT", "time": time.Now().UTC().Format(time.RFC3339)}}}),
+		synchronizationPacket(t, map[string]interface{}{"type": "disconnected"}),
+	)
+	stream := NewMetaApiStream("wss://example", "account", "token", func(ctx context.Context, url string) (StreamConn, error) {
+		return conn, nil
+	}).(*metaApiStream)
+
+	state := newStreamState()
+	var events []StreamEvent
+	var snapshots []int
+	err := stream.session(context.Background(), func(event StreamEvent) {
+		events = append(events, event)
+		state.apply(event)
+		snapshots = append(snapshots, len(state.positions))
+	})
+	if err == nil || !strings.Contains(err.Error(), "disconnected") {
+		t.Fatalf("session error %v, want disconnected", err)
+	}
+	if !conn.closed {
+		t.Error("connection not closed")
+	}
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	wantTypes := []string{StreamEventDeals, StreamEventPositions, StreamEventOrders, StreamEventSynchronized,
+		StreamEventHistoryOrders, StreamEventHistorySynchronized, StreamEventPrices, StreamEventUpdate}
+	if strings.Join(types, ",") != strings.Join(wantTypes, ",") {
+		t.Fatalf("events %v, want %v", types, wantTypes)
+	}
+	if events[0].DealsFrom.IsZero() {
+		t.Error("history synchronization without start time")
+	}
+	// the price moves the profit of the position before the update removes it
+	if events[6].Prices[0].Bid != 2660 {
+		t.Errorf("price %+v", events[6].Prices)
+	}
+	if snapshots[6] != 1 || snapshots[7] != 0 {
+		t.Errorf("positions by event %v", snapshots)
+	}
+	if len(state.orders) != 0 || len(state.deals) != 1 || len(state.historyOrders) != 1 || !state.synchronized ||
+		!state.historySynchronized {
+		t.Errorf("state orders %v deals %v history orders %v synchronized %v %v", state.orders, state.deals,
+			state.historyOrders, state.synchronized, state.historySynchronized)
+	}
+
+	requests := conn.requests(t)
+	var requestTypes []string
+	for _, request := range requests {
+		requestTypes = append(requestTypes, request["type"].(string))
+		if request["accountId"] != "account" {
+			t.Errorf("request %v without the account", request)
+		}
+	}
+	wantRequests := []string{"subscribe", "synchronize", "subscribeToMarketData", "subscribeToMarketData"}
+	if strings.Join(requestTypes, ",") != strings.Join(wantRequests, ",") {
+		t.Fatalf("requests %v, want %v", requestTypes, wantRequests)
+	}
+	if requests[1]["host"] != "ps-mpa-1" {
+		t.Errorf("synchronize request %v, want the host of the authentication", requests[1])
+	}
+	if requests[2]["symbol"] != "XAUUSD" || requests[3]["symbol"] != "EURUSD" {
+		t.Errorf("market data subscriptions %v %v", requests[2], requests[3])
+	}
+}
+
+func TestMetaApiStreamResynchronization(t *testing.T) {
+	position := func(id string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "type": "POSITION_TYPE_SELL", "symbol": "EURUSD", "openPrice": 1.08}
+	}
+	sessions := []*fakeStreamConn{
+		newFakeStreamConn("40",
+			synchronizationPacket(t, map[string]interface{}{"type": "authenticated", "host": "ps-mpa-1"}),
+			synchronizationPacket(t, map[string]interface{}{"type": "positions", "positions": []interface{}{position("1"), position("2")}}),
+			synchronizationPacket(t, map[string]interface{}{"type": "orderSynchronizationFinished"}),
+			synchronizationPacket(t, map[string]interface{}{"type": "disconnected"})),
+		newFakeStreamConn("40",
+			synchronizationPacket(t, map[string]interface{}{"type": "authenticated", "host": "ps-mpa-2"}),
+			synchronizationPacket(t, map[string]interface{}{"type": "positions", "positions": []interface{}{position("2")}}),
+			synchronizationPacket(t, map[string]interface{}{"type": "orderSynchronizationFinished"})),
+	}
+	dials := 0
+	stream := NewMetaApiStream("wss://example", "account", "token", func(ctx context.Context, url string) (StreamConn, error) {
+		if dials >= len(sessions) {
+			return nil, errors.New("no more sessions")
+		}
+		dials++
+		return sessions[dials-1], nil
+	})
+
+	state := newStreamState()
+	broker := newStreamingBroker(&restPositionsBroker{positions: []MetaApiPosition{{ID: "rest"}}}, state)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var fallback []MetaApiPosition
+	synchronizations := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- stream.Run(ctx, func(event StreamEvent) {
+			state.apply(event)
+			mu.Lock()
+			defer mu.Unlock()
+			switch event.Type {
+			case StreamEventDisconnected:
+				if synchronizations == 1 && fallback == nil {
+					// until the next synchronization the positions come from the REST api
+					fallback, _ = broker.Positions()
+				}
+			case StreamEventSynchronized:
+				synchronizations++
+				if synchronizations == 2 {
+					cancel()
+				}
+			}
+		})
+	}()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run error %v, want the context cancelled", err)
+	}
+	if synchronizations != 2 {
+		t.Fatalf("%d synchronizations, want 2", synchronizations)
+	}
+	if len(fallback) != 1 || fallback[0].ID != "rest" {
+		t.Errorf("positions while disconnected %v, want the REST ones", fallback)
+	}
+	if requests := sessions[1].requests(t); len(requests) < 2 || requests[1]["host"] != "ps-mpa-2" {
+		t.Errorf("requests of the second session %v", requests)
+	}
+	// the second synchronization replaces the positions of the first one, the stop is a disconnection
+	positions := sortedPositions(state.positions)
+	if len(positions) != 1 || positions[0].ID != "2" || state.synchronized {
+		t.Errorf("positions %v synchronized %v, want the position 2", positions, state.synchronized)
+	}
+}
+
+func TestStreamStateApply(t *testing.T) {
+	today := time.Now().UTC().Format(time.RFC3339)
+	state := newStreamState()
+	steps := []struct {
+		name          string
+		event         StreamEvent
+		wantManaged   bool
+		wantPositions int
+		wantOrders    int
+		wantDeals     int
+	}{
+		{name: "positions", event: StreamEvent{Type: StreamEventPositions, Positions: []MetaApiPosition{
+			{ID: "1", Symbol: "XAUUSD", Type: "POSITION_TYPE_BUY", OpenPrice: 2650, CurrentPrice: 2655, Profit: 50}}},
+			wantManaged: true, wantPositions: 1},
+		{name: "orders", event: StreamEvent{Type: StreamEventOrders, Orders: []MetaApiPosition{{ID: "2"}, {ID: "3"}}},
+			wantPositions: 1, wantOrders: 2},
+		{name: "history", event: StreamEvent{Type: StreamEventDeals, DealsFrom: time.Now(), Deals: []MetaApiPosition{
+			{ID: "4", EntryType: "DEAL_ENTRY_IN", Time: today}}}, wantPositions: 1, wantOrders: 2, wantDeals: 1},
+		{name: "synchronized", event: StreamEvent{Type: StreamEventSynchronized}, wantManaged: true, wantPositions: 1,
+			wantOrders: 2, wantDeals: 1},
+		{name: "price of another symbol", event: StreamEvent{Type: StreamEventPrices, Prices: []MetaApiPriceResponse{
+			{Symbol: "EURUSD", Bid: 1.08, Ask: 1.0801}}}, wantPositions: 1, wantOrders: 2, wantDeals: 1},
+		{name: "price of the position", event: StreamEvent{Type: StreamEventPrices, Prices: []MetaApiPriceResponse{
+			{Symbol: "XAUUSD", Bid: 2660, Ask: 2660.5}}}, wantManaged: true, wantPositions: 1, wantOrders: 2, wantDeals: 1},
+		{name: "order filled", event: StreamEvent{Type: StreamEventUpdate, CompletedOrderIds: []string{"2"},
+			Positions: []MetaApiPosition{{ID: "2", Symbol: "EURUSD"}}, Deals: []MetaApiPosition{
+				{ID: "4", EntryType: "DEAL_ENTRY_IN", Time: today}, {ID: "5", EntryType: "DEAL_ENTRY_IN", Time: today}}},
+			wantManaged: true, wantPositions: 2, wantOrders: 1, wantDeals: 2},
+		{name: "position closed", event: StreamEvent{Type: StreamEventUpdate, RemovedPositionIds: []string{"1"}},
+			wantManaged: true, wantPositions: 1, wantOrders: 1, wantDeals: 2},
+		{name: "disconnected", event: StreamEvent{Type: StreamEventDisconnected}, wantPositions: 1, wantOrders: 1,
+			wantDeals: 2},
+		{name: "history synchronized again", event: StreamEvent{Type: StreamEventDeals, DealsFrom: time.Now()},
+			wantPositions: 1, wantOrders: 1},
+	}
+	for _, step := range steps {
+		managed := state.apply(step.event)
+		if managed != step.wantManaged || len(state.positions) != step.wantPositions || len(state.orders) != step.wantOrders ||
+			len(state.deals) != step.wantDeals {
+			t.Errorf("%s: managed %v positions %d orders %d deals %d, want %v %d %d %d", step.name, managed,
+				len(state.positions), len(state.orders), len(state.deals), step.wantManaged, step.wantPositions,
+				step.wantOrders, step.wantDeals)
+		}
+		if step.name == "price of the position" {
+			// profit followed from 5 to 10 points
+			if position := state.positions["1"]; position.CurrentPrice != 2660 || position.Profit != 100 {
+				t.Errorf("repriced position %+v", position)
+			}
+		}
+	}
+	if state.synchronized {
+		t.Error("state still synchronized after the disconnection")
+	}
+}
+
+func TestStreamingBrokerHistory(t *testing.T) {
+	now := time.Now().UTC()
+	today := now.Format(time.RFC3339)
+	rest := &restHistoryBroker{deals: []MetaApiPosition{{ID: "rest"}}, orders: []MetaApiPosition{{ID: "rest"}}}
+	state := newStreamState()
+	broker := newStreamingBroker(rest, state)
+	from := startOfDay(time.Now())
+	steps := []struct {
+		name      string
+		event     StreamEvent
+		wantRest  bool
+		wantDeals int
+	}{
+		{name: "history requested", event: StreamEvent{Type: StreamEventDeals, DealsFrom: from}, wantRest: true},
+		{name: "positions synchronized", event: StreamEvent{Type: StreamEventSynchronized}, wantRest: true},
+		{name: "deals arriving", event: StreamEvent{Type: StreamEventDeals, Deals: []MetaApiPosition{
+			{ID: "1", EntryType: "DEAL_ENTRY_IN", Time: today}}}, wantRest: true},
+		{name: "history orders arriving", event: StreamEvent{Type: StreamEventHistoryOrders, HistoryOrders: []MetaApiPosition{
+			{ID: "1", Time: today}}}, wantRest: true},
+		{name: "history synchronized", event: StreamEvent{Type: StreamEventHistorySynchronized}, wantDeals: 1},
+		{name: "disconnected", event: StreamEvent{Type: StreamEventDisconnected}, wantRest: true},
+	}
+	for _, step := range steps {
+		state.apply(step.event)
+		deals, _ := broker.HistoryDeals(from, now.Add(time.Hour))
+		orders, _ := broker.HistoryOrders(from, now.Add(time.Hour))
+		if step.wantRest {
+			if len(deals) != 1 || deals[0].ID != "rest" || len(orders) != 1 || orders[0].ID != "rest" {
+				t.Errorf("%s: deals %v orders %v, want the REST history", step.name, deals, orders)
+			}
+			continue
+		}
+		if len(deals) != step.wantDeals || len(orders) != 1 || orders[0].ID != "1" {
+			t.Errorf("%s: deals %v orders %v, want the stream history", step.name, deals, orders)
+		}
+	}
+}
+
+// broker answering the REST history
+type restHistoryBroker struct {
+	Broker
+	deals  []MetaApiPosition
+	orders []MetaApiPosition
+}
+
+func (b *restHistoryBroker) HistoryDeals(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	return b.deals, nil
+}
+
+func (b *restHistoryBroker) HistoryOrders(from time.Time, to time.Time) ([]MetaApiPosition, error) {
+	return b.orders, nil
+}
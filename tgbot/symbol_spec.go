@@ -0,0 +1,258 @@
+package tgbot
+
+import (
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// specifications are fetched once a day, a failed fetch is retried after a minute
+const (
+	symbolSpecificationTTL      = 24 * time.Hour
+	symbolSpecificationRetryTTL = time.Minute
+)
+
+// symbolSpecificationCache keep the specifications of the symbols given by the broker of an account. a nil cache
+// gives no specification, the usual sizes are used
+type symbolSpecificationCache struct {
+	mu      sync.Mutex
+	broker  Broker
+	entries map[string]cachedSymbolSpecification
+	// symbols being fetched, the other callers wait for the fetch instead of sending their own request
+	fetching map[string]chan struct{}
+	// currency of the account, fetched once
+	currency string
+}
+
+type cachedSymbolSpecification struct {
+	specification *MetaApiSymbolSpecification
+	time          time.Time
+}
+
+func newSymbolSpecificationCache(broker Broker) *symbolSpecificationCache {
+	return &symbolSpecificationCache{
+		broker:   broker,
+		entries:  make(map[string]cachedSymbolSpecification),
+		fetching: make(map[string]chan struct{}),
+	}
+}
+
+// specification of a symbol, nil when the broker does not give it. the broker is called without the lock, a slow
+// symbol does not block the others
+func (c *symbolSpecificationCache) get(symbol string) *MetaApiSymbolSpecification {
+	if c == nil || c.broker == nil || symbol == "" {
+		return nil
+	}
+	for {
+		c.mu.Lock()
+		if entry, ok := c.entries[symbol]; ok {
+			ttl := symbolSpecificationTTL
+			if entry.specification == nil {
+				ttl = symbolSpecificationRetryTTL
+			}
+			if time.Since(entry.time) < ttl {
+				c.mu.Unlock()
+				return entry.specification
+			}
+		}
+		done, ok := c.fetching[symbol]
+		if !ok {
+			done = make(chan struct{})
+			c.fetching[symbol] = done
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+		<-done
+	}
+	specification, err := c.broker.Specification(symbol)
+	if err != nil {
+		log.Printf("Error fetching %s specification: %v", symbol, err)
+		specification = nil
+	} else {
+		completeSymbolSpecification(c.broker, specification)
+	}
+	c.mu.Lock()
+	c.entries[symbol] = cachedSymbolSpecification{specification: specification, time: time.Now()}
+	close(c.fetching[symbol])
+	delete(c.fetching, symbol)
+	c.mu.Unlock()
+	return specification
+}
+
+// fill the fields the broker left empty : point from the digits or the tick size, tick value from the price
+func completeSymbolSpecification(broker Broker, specification *MetaApiSymbolSpecification) {
+	if specification.Point <= 0 {
+		specification.Point = specification.TickSize
+		if specification.Digits > 0 {
+			specification.Point = math.Pow10(-specification.Digits)
+		}
+	}
+	if specification.TickSize <= 0 {
+		specification.TickSize = specification.Point
+	}
+	if specification.TickValue <= 0 {
+		if price, err := broker.Price(specification.Symbol); err == nil {
+			specification.TickValue = price.LossTickValue
+			if specification.TickValue <= 0 {
+				specification.TickValue = price.ProfitTickValue
+			}
+		}
+	}
+}
+
+// currency of the account of the broker, empty when unknown
+func (c *symbolSpecificationCache) accountCurrency() string {
+	if c == nil || c.broker == nil {
+		return ""
+	}
+	c.mu.Lock()
+	currency := c.currency
+	c.mu.Unlock()
+	if currency != "" {
+		return currency
+	}
+	information, err := c.broker.AccountInformation()
+	if err != nil {
+		log.Printf("Error fetching account currency: %v", err)
+		return ""
+	}
+	c.mu.Lock()
+	c.currency = information.Currency
+	c.mu.Unlock()
+	return information.Currency
+}
+
+// currency the profits of a symbol are counted in : the one of the specification, the second one of a pair, the
+// country of an index
+func (c *symbolSpecificationCache) quoteCurrency(symbol string) string {
+	if specification := c.get(symbol); specification != nil && specification.ProfitCurrency != "" {
+		return specification.ProfitCurrency
+	}
+	currencies := symbolCurrencies(nil, symbol)
+	return currencies[len(currencies)-1]
+}
+
+// rate from the quote currency of a symbol to the account currency : 1 when they are the same, the rate given with
+// the price, the price of the pair of the two currencies. 0 when unknown
+func (c *symbolSpecificationCache) exchangeRate(symbol string) float64 {
+	if c == nil || c.broker == nil {
+		return 0
+	}
+	quote := c.quoteCurrency(symbol)
+	account := c.accountCurrency()
+	if account != "" && quote == account {
+		return 1
+	}
+	if price, err := c.broker.Price(symbol); err == nil && price.AccountCurrencyExchangeRate > 0 {
+		return price.AccountCurrencyExchangeRate
+	}
+	if account == "" {
+		return 0
+	}
+	if price, err := c.broker.Price(quote + account); err == nil && price.Bid > 0 {
+		return price.Bid
+	}
+	if price, err := c.broker.Price(account + quote); err == nil && price.Ask > 0 {
+		return 1 / price.Ask
+	}
+	return 0
+}
+
+// pip of a symbol : ten points for the forex pairs quoted with 3 or 5 digits, one point otherwise
+func (specification *MetaApiSymbolSpecification) pipSize() float64 {
+	if specification.Point <= 0 {
+		return 0
+	}
+	if specification.ContractSize == 100000 && (specification.Digits == 3 || specification.Digits == 5) {
+		return specification.Point * 10
+	}
+	return specification.Point
+}
+
+// pointSize is the pip size of a symbol, from its specification and the usual sizes without it
+func (c *symbolSpecificationCache) pointSize(symbol string) float64 {
+	if specification := c.get(symbol); specification != nil {
+		if pipSize := specification.pipSize(); pipSize > 0 {
+			return pipSize
+		}
+	}
+	return defaultPointSize(symbol)
+}
+
+// pip sizes when the broker does not give the specification
+var defaultPointSizes = map[string]float64{
+	"EURUSD":   0.0001,
+	"USDJPY":   0.01,
+	"GBPUSD":   0.0001,
+	"USDCHF":   0.0001,
+	"USDCAD":   0.0001,
+	"AUDUSD":   0.0001,
+	"NZDUSD":   0.0001,
+	"EURJPY":   0.01,
+	"GBPJPY":   0.01,
+	"EURGBP":   0.0001,
+	"EURCHF":   0.0001,
+	"XAUUSD":   0.01,  // GOLD
+	"XAGUSD":   0.001, // SILVER
+	"BTCUSD":   1,     // Bitcoin
+	"ETHUSD":   0.01,  // Ethereum
+	"USOUSD":   0.01,  // WTI Crude Oil
+	"BrentUSD": 0.01,  // Brent Crude Oil
+}
+
+func defaultPointSize(symbol string) float64 {
+	if pointSize, ok := defaultPointSizes[symbol]; ok {
+		return pointSize
+	}
+	// in case symbole contains suffix like XAUUSD-STD or XAUUSD-ECN
+	for key, value := range defaultPointSizes {
+		if strings.HasPrefix(symbol, key) {
+			return value
+		}
+	}
+	// indices and other symbols quoted with 2 digits
+	return 0.01
+}
+
+// units in one lot, the usual sizes of MetaTrader brokers when the broker does not give the specification
+func defaultContractSize(symbol string) float64 {
+	switch {
+	case strings.HasPrefix(symbol, "XAU"):
+		return 100
+	case strings.HasPrefix(symbol, "XAG"):
+		return 5000
+	case strings.HasPrefix(symbol, "BTC"), strings.HasPrefix(symbol, "ETH"):
+		return 1
+	case len(symbol) >= 6 && strings.ToUpper(symbol[:6]) == symbol[:6] && !strings.ContainsAny(symbol[:6], "0123456789"):
+		// forex pair
+		return 100000
+	}
+	// indices, oil...
+	return 1
+}
+
+// volume rounded down to the volume step of the symbol, 0.01 without specification
+func (c *symbolSpecificationCache) floorVolumeStep(volume float64, symbol string) float64 {
+	step := c.volumeStep(symbol)
+	// the margin keeps a volume of exactly n steps despite the float noise, no float noise in the lots sent to the
+	// broker
+	return math.Round(math.Floor(volume/step+1e-6)*step*1e8) / 1e8
+}
+
+func (c *symbolSpecificationCache) volumeStep(symbol string) float64 {
+	if specification := c.get(symbol); specification != nil && specification.VolumeStep > 0 {
+		return specification.VolumeStep
+	}
+	return 0.01
+}
+
+// smallest volume the broker accepts on the symbol, 0.01 without specification
+func (c *symbolSpecificationCache) minVolume(symbol string) float64 {
+	if specification := c.get(symbol); specification != nil && specification.MinVolume > 0 {
+		return specification.MinVolume
+	}
+	return 0.01
+}
@@ -16,6 +16,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"tdlib/authmanager"
 	"tdlib/config"
 	"tdlib/redis_client"
@@ -29,6 +30,29 @@ type TgBot struct {
 	tdClient         *telegram.Client
 	Bot              *gotgbot.Bot
 	CurrentPositions map[string]MetaApiPosition
+	// merge signals posted in several messages
+	assembler *signalAssembler
+	// language model used to parse signals and get trends
+	LLM          LLMClient
+	SignalParser SignalParser
+	// trading account, real or paper
+	Broker Broker
+	// every trade request goes through it
+	Executor *TradeExecutor
+	// state kept up to date by the MetaApi stream, nil without streaming
+	stream *streamingBroker
+	// the positions are checked by the polling and on stream events, one check at a time
+	positionsCheck sync.Mutex
+	// specifications of the symbols of the broker, for the pips, volumes, risk, trading hours and news currencies
+	specifications *symbolSpecificationCache
+	// trading hours of the symbols
+	calendar *marketCalendar
+	// economic news events
+	news *newsCalendar
+	// account traded by this bot, nil for the bot of the main config
+	Account *AccountProfile
+	// bots of the accounts the signals fan out to, empty when the main config is traded
+	Accounts []*TgBot
 }
 
 func NewTgBot(appConfig config.AppConfig, redisClient *redis_client.RedisClient, terminalAuth *authmanager.TerminalPrompt) *TgBot {
@@ -39,14 +63,53 @@ func NewTgBot(appConfig config.AppConfig, redisClient *redis_client.RedisClient,
 	if err != nil {
 		panic("failed to create new bot: " + err.Error())
 	}
-	return &TgBot{
+	llm := NewLLMClient(appConfig)
+	broker, err := NewBroker(&appConfig)
+	if err != nil {
+		panic("failed to create broker: " + err.Error())
+	}
+	tgBot := &TgBot{
 		terminalAuth: authmanager.NewTerminalPrompt(appConfig),
 		RedisClient:  redis_client.NewRedisClient(),
 		AppConfig:    &appConfig,
 		Bot:          b,
 		// stock list of current positions MetaApiPosition
 		CurrentPositions: make(map[string]MetaApiPosition),
+		assembler:        newSignalAssembler(),
+		LLM:              llm,
+		SignalParser:     NewRuleSignalParser(NewLLMSignalParser(llm), appConfig.RuleParserMinConfidence),
+		Broker:           broker,
+	}
+	tgBot.Executor = NewTradeExecutor(&appConfig, func() Broker { return tgBot.Broker })
+	tgBot.specifications = newSymbolSpecificationCache(broker)
+	tgBot.calendar, err = loadMarketCalendar(appConfig.BrokerTimeZone, appConfig.MarketHoursFile)
+	if err != nil {
+		panic("failed to load market hours: " + err.Error())
+	}
+	tgBot.news, err = loadNewsCalendar(appConfig.NewsCalendarFile, appConfig.NewsMinImpact, appConfig.NewsBlackoutBefore,
+		appConfig.NewsBlackoutAfter)
+	if err != nil {
+		panic("failed to load news calendar: " + err.Error())
+	}
+	if appConfig.AccountsFile != "" {
+		profiles, err := LoadAccountProfiles(appConfig.AccountsFile)
+		if err != nil {
+			panic("failed to load accounts: " + err.Error())
+		}
+		// a signal is parsed once for all the accounts
+		tgBot.SignalParser = newCachedSignalParser(tgBot.SignalParser)
+		for _, profile := range profiles {
+			accountBot, err := tgBot.newAccountBot(profile)
+			if err != nil {
+				panic("failed to create account: " + err.Error())
+			}
+			tgBot.Accounts = append(tgBot.Accounts, accountBot)
+		}
+		// commands of the bot use the first account
+		tgBot.Broker = tgBot.Accounts[0].Broker
+		tgBot.specifications = tgBot.Accounts[0].specifications
 	}
+	return tgBot
 }
 
 func (tgBot *TgBot) Start() {
@@ -54,12 +117,23 @@ func (tgBot *TgBot) Start() {
 	defer cancel()
 	// run cron
 	c := cron.New()
-	c.AddFunc("@every 5s", tgBot.checkCurrentPositions) // Adapter le délai
-	c.AddFunc("@every 1h", tgBot.updateTraderScores)    // Adapter le délai
-	// cron to run every day at 00:00
-	c.AddFunc("0 0 * * *", tgBot.updateDailyInfo)
-	// TODO remove line
-	tgBot.checkCurrentPositions()
+	// each account follows its own positions
+	for _, accountBot := range tgBot.tradingBots() {
+		checkInterval := "@every 5s"
+		if accountBot.startStream(ctx) {
+			checkInterval = "@every " + accountBot.AppConfig.StreamReconcileInterval.String()
+		}
+		c.AddFunc(checkInterval, accountBot.reconcilePositions) // Adapter le délai
+		// cron to run every day at 00:00
+		c.AddFunc("0 0 * * *", accountBot.updateDailyInfo)
+		// TODO remove line
+		accountBot.checkCurrentPositions()
+	}
+	c.AddFunc("@every 1h", tgBot.updateTraderScores) // Adapter le délai
+	// signals received while their market was closed
+	c.AddFunc("@every 1m", tgBot.releaseQueuedSignals)
+	// news file updated
+	c.AddFunc("@every 5m", tgBot.reloadNewsCalendar)
 	tgBot.updateTraderScores()
 	c.Start()
 	if err := tgBot.run(ctx); err != nil {
@@ -80,40 +154,10 @@ func (tgBot *TgBot) run(ctx context.Context) error {
 	})
 
 	// listen to redis for new trading signals
-	pubSub := tgBot.RedisClient.Rdb.Subscribe(context.Background(), "trading_signals")
-	_, errSubscribing := pubSub.Receive(context.Background())
-	if errSubscribing != nil {
-		log.Error("Error subscribing to trading signals", zap.Error(errSubscribing))
-		return errSubscribing
-	}
-
-	// Ensure we unsubscribe when done
-	defer pubSub.Close()
 	go func() {
-		ch := pubSub.Channel()
-		for msg := range ch {
-			log.Info("Received message", zap.String("channel", msg.Channel), zap.String("payload", msg.Payload))
-			var tradeRequest HandleRequestInput
-			err := json.Unmarshal([]byte(msg.Payload), &tradeRequest)
-			if err != nil {
-				log.Error("Error unmarshalling trade request", zap.Error(err))
-				continue
-			}
-			// get chat id
-			chatId := tgBot.RedisClient.GetChatId()
-			// send message to chat
-			headerMessage := "Trading signal from " + tradeRequest.ChannelName
-			botM := headerMessage + "\n" + tradeRequest.Message
-			_, errSend := tgBot.Bot.SendMessage(chatId, botM, nil)
-			if errSend != nil {
-				log.Error("Error sending message to chat", zap.Error(errSend))
-				continue
-			}
-			// handle request
-			_, _, err = tgBot.HandleTradeRequest(tradeRequest)
-			if err != nil {
-				log.Error("Error handling trade request", zap.Error(err))
-			}
+		errConsume := tgBot.consumeSignals(ctx, log)
+		if errConsume != nil {
+			log.Error("Error consuming trading signals", zap.Error(errConsume))
 		}
 	}()
 
@@ -131,96 +175,61 @@ func (tgBot *TgBot) run(ctx context.Context) error {
 		return err
 	}
 	tgBot.tdClient = client
+	for _, accountBot := range tgBot.Accounts {
+		accountBot.tdClient = client
+	}
 	go func() {
 		tgBot.LaunchBorisBot(client)
 	}()
 
 	//clientOpenApi := openai.NewClient(openaiApiKey)
 	// Setup message update handlers.
-	lastMessageTime := time.Now().Unix()
-	lastChannelId := int64(0)
-	firstCall := true
 	d.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
-		log.Info("Channel message", zap.Any("message", u.Message))
-		m, ok := u.Message.(*tg.Message)
-		if ok && m.Out {
-			log.Info("Message is not incoming from channel")
-			return nil
-		}
-		if !messageIsTradingSignal(m) {
-			log.Info("Message is not a trading signal")
-			return nil
-		}
+		return tgBot.onNewMessage(log, e, u.Message)
+	})
+	// basic groups
+	d.OnNewMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewMessage) error {
+		return tgBot.onNewMessage(log, e, u.Message)
+	})
 
-		// get channel by loop e.Channels map[int64]*tg.Channel
-		messageChannel := tg.Channel{}
-		for _, channel := range e.Channels {
-			messageChannel = *channel
-			if !tgBot.RedisClient.IsChannelExist(channel.ID) {
-				log.Info("Channel not included", zap.Int64("channel_id", channel.ID))
-				return nil
-			}
-		}
-		// avoid trading signals from the same channel in less than 2 seconds
-		if time.Now().Unix()-lastMessageTime < 3 {
-			if !firstCall && lastChannelId == messageChannel.ID {
-				log.Info("Trading signal from the same channel in less than 2 seconds")
-				// sleep for 2 seconds in to let the first trade request to be handled
-				time.Sleep(5 * time.Second)
-			}
+	d.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateEditChannelMessage) error {
+		return tgBot.onEditMessage(log, e, u.Message)
+	})
+	d.OnEditMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateEditMessage) error {
+		return tgBot.onEditMessage(log, e, u.Message)
+	})
+
+	d.OnDeleteChannelMessages(func(ctx context.Context, e tg.Entities, u *tg.UpdateDeleteChannelMessages) error {
+		log.Info("Channel messages deleted", zap.Int64("channel_id", u.ChannelID), zap.Ints("messages", u.Messages))
+		if !tgBot.RedisClient.IsChannelExist(u.ChannelID) {
+			return nil
 		}
-		lastMessageTime = time.Now().Unix()
-		lastChannelId = messageChannel.ID
-		firstCall = false
-		// check current symbole price
-		to, isReplyTo := m.GetReplyTo()
-		replyTradeRequest := &TradeRequest{}
-		//replyMessage := nil
-		if isReplyTo {
-			if to != nil {
-				s := to.String()
-				if &s != nil {
-					var errS error
-					replyToMsgId, errS := ExtractReplyToMessageId(s)
-					if errS != nil {
-						log.Error("Error extracting reply to message id", zap.Error(errS))
-					}
-					replyTradeBytes := tgBot.RedisClient.GetTradeRequest(int64(replyToMsgId))
-					if replyTradeBytes != nil {
-						var replyTrade TradeRequest
-						errUnmarshal := json.Unmarshal(replyTradeBytes, &replyTrade)
-						if errUnmarshal != nil {
-							log.Info("Error unmarshalling trade request", zap.Error(errUnmarshal))
-						}
-						if replyTrade.Symbol == "" {
-							log.Info("No trade request found for this message")
-						}
-						replyTradeRequest = &replyTrade
-					}
-				}
+		// keep only messages which opened a trade
+		var deletedIds []int
+		for _, messageId := range u.Messages {
+			if tgBot.signalTradeRequest(messageId) != nil {
+				deletedIds = append(deletedIds, messageId)
 			}
 		}
-		if replyTradeRequest.Symbol == "" {
-			replyTradeRequest = nil
-		}
-		if !tgBot.RedisClient.IsBotOn() {
-			log.Info("Bot is off")
+		if len(deletedIds) == 0 {
 			return nil
 		}
+		channelName := strconv.FormatInt(u.ChannelID, 10)
+		if channel, ok := e.Channels[u.ChannelID]; ok {
+			channelName = channel.Title
+		}
 		input := HandleRequestInput{
-			MessageId:         m.ID,
-			Message:           m.Message,
-			ParentRequest:     replyTradeRequest,
-			ChannelID:         messageChannel.ID,
-			ChannelName:       messageChannel.Title,
-			ChannelAccessHash: messageChannel.AccessHash,
+			MessageId:   deletedIds[0],
+			ChannelID:   u.ChannelID,
+			ChannelName: channelName,
+			Deleted:     true,
+			DeletedIds:  deletedIds,
 		}
 		err := tgBot.PushHandleRequestInputToRedis(&input)
 		if err != nil {
-			log.Error("Error pushing handle request input to redis", zap.Error(err))
+			log.Error("Error pushing deleted handle request input to redis", zap.Error(err))
 			return err
 		}
-
 		return nil
 	})
 
@@ -251,18 +260,147 @@ func (tgBot *TgBot) run(ctx context.Context) error {
 
 }
 
+// push a new message of a channel, a supergroup or a basic group to the trading signals
+func (tgBot *TgBot) onNewMessage(log *zap.Logger, e tg.Entities, message tg.MessageClass) error {
+	log.Info("Channel message", zap.Any("message", message))
+	m, ok := message.(*tg.Message)
+	if !ok {
+		return nil
+	}
+	if m.Out {
+		log.Info("Message is not incoming from channel")
+		return nil
+	}
+	source := resolveMessageSource(e, m)
+	if source == nil {
+		// private message
+		return nil
+	}
+	if !messageIsTradingSignal(m) {
+		log.Info("Message is not a trading signal")
+		return nil
+	}
+	topicId := messageTopicId(source, m)
+	if !tgBot.isSourceAllowed(source, topicId) {
+		log.Info("Channel not included", zap.Int64("channel_id", source.ID), zap.Int("topic_id", topicId))
+		return nil
+	}
+	var replyTradeRequest *TradeRequest
+	if replyToMsgId := messageReplyToId(m); replyToMsgId != 0 {
+		replyTradeBytes := tgBot.signalTradeRequest(replyToMsgId)
+		if replyTradeBytes != nil {
+			var replyTrade TradeRequest
+			errUnmarshal := json.Unmarshal(replyTradeBytes, &replyTrade)
+			if errUnmarshal != nil {
+				log.Info("Error unmarshalling trade request", zap.Error(errUnmarshal))
+			}
+			if replyTrade.Symbol == "" {
+				log.Info("No trade request found for this message")
+			} else {
+				replyTradeRequest = &replyTrade
+			}
+		}
+	}
+	if !tgBot.RedisClient.IsBotOn() {
+		log.Info("Bot is off")
+		return nil
+	}
+	input := HandleRequestInput{
+		MessageId:         m.ID,
+		Message:           m.Message,
+		ParentRequest:     replyTradeRequest,
+		ChannelID:         source.ID,
+		ChannelName:       source.Title,
+		ChannelAccessHash: source.AccessHash,
+		TopicId:           topicId,
+	}
+	// signals posted in several messages are merged before being parsed
+	window := tgBot.RedisClient.GetChannelAssemblyWindow(int(source.ID))
+	if window > 0 && replyTradeRequest == nil && messageReplyToId(m) == 0 {
+		tgBot.assembler.add(input, time.Duration(window)*time.Second, func(input HandleRequestInput) {
+			err := tgBot.PushHandleRequestInputToRedis(&input)
+			if err != nil {
+				log.Error("Error pushing assembled handle request input to redis", zap.Error(err))
+			}
+		})
+		return nil
+	}
+	err := tgBot.PushHandleRequestInputToRedis(&input)
+	if err != nil {
+		log.Error("Error pushing handle request input to redis", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// push an edited message which opened a trade to the trading signals
+func (tgBot *TgBot) onEditMessage(log *zap.Logger, e tg.Entities, message tg.MessageClass) error {
+	log.Info("Channel message edited", zap.Any("message", message))
+	m, ok := message.(*tg.Message)
+	if !ok || m.Out {
+		return nil
+	}
+	source := resolveMessageSource(e, m)
+	if source == nil {
+		return nil
+	}
+	// only messages that opened a trade are re-synced
+	if tgBot.signalTradeRequest(m.ID) == nil {
+		log.Info("Edited message has no trade request", zap.Int("message_id", m.ID))
+		return nil
+	}
+	topicId := messageTopicId(source, m)
+	if !tgBot.isSourceAllowed(source, topicId) {
+		log.Info("Channel not included", zap.Int64("channel_id", source.ID), zap.Int("topic_id", topicId))
+		return nil
+	}
+	if !tgBot.RedisClient.IsBotOn() {
+		log.Info("Bot is off")
+		return nil
+	}
+	editDate, _ := m.GetEditDate()
+	input := HandleRequestInput{
+		MessageId:         m.ID,
+		Message:           m.Message,
+		ChannelID:         source.ID,
+		ChannelName:       source.Title,
+		ChannelAccessHash: source.AccessHash,
+		TopicId:           topicId,
+		Edited:            true,
+		EditDate:          editDate,
+	}
+	err := tgBot.PushHandleRequestInputToRedis(&input)
+	if err != nil {
+		log.Error("Error pushing edited handle request input to redis", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 func (tgBot *TgBot) PushHandleRequestInputToRedis(input *HandleRequestInput) error {
 	jsonL, _ := json.Marshal(input)
-	nx := tgBot.RedisClient.Rdb.HSetNX(context.Background(), "trading_signals", strconv.Itoa(int(input.MessageId)), jsonL)
+	// message ids are only unique per channel
+	field := strconv.FormatInt(input.ChannelID, 10) + "_" + strconv.Itoa(int(input.MessageId))
+	if input.Edited {
+		// every edit of a message is a distinct signal
+		field = field + "_edit_" + strconv.Itoa(input.EditDate)
+	}
+	if input.Deleted {
+		field = field + "_delete"
+	}
+	nx := tgBot.RedisClient.Rdb.HSetNX(context.Background(), "trading_signals", field, jsonL)
 	if nx.Err() != nil {
 		return nx.Err()
 	}
-	// publish to channel
-	pub := tgBot.RedisClient.Rdb.Publish(context.Background(), "trading_signals", jsonL)
-	if pub.Err() != nil {
-		// print
-		println("Error publishing to trading signals")
-		return pub.Err()
+	if !nx.Val() {
+		// already pushed (update replayed after a reconnection)
+		return nil
+	}
+	// add to the stream, it will be consumed even if the consumer is down right now
+	_, err := tgBot.RedisClient.AddSignal(jsonL)
+	if err != nil {
+		println("Error adding to trading signals stream")
+		return err
 	}
 	return nil
 
@@ -271,7 +409,7 @@ func (tgBot *TgBot) PushHandleRequestInputToRedis(input *HandleRequestInput) err
 func (tgBot *TgBot) updateDailyInfo() {
 	if tgBot.getAccountBalance() == 0 {
 		// get account balance
-		information, err := tgBot.getAccountInformation()
+		information, err := tgBot.Broker.AccountInformation()
 		if err != nil {
 			return
 		}
@@ -286,7 +424,7 @@ func (tgBot *TgBot) getAccountBalance() float64 {
 	balance := tgBot.RedisClient.GetAccountBalance()
 	if balance == 0.0 {
 		// get account balance
-		information, err := tgBot.getAccountInformation()
+		information, err := tgBot.Broker.AccountInformation()
 		if err != nil {
 			return 0
 		}
@@ -0,0 +1,170 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"tdlib/config"
+	"time"
+)
+
+// TradeExecutor send the trade requests to the broker and retry them according to the error returned :
+// exponential backoff with jitter for the Retry codes, no retry for the NoRetry ones, a new quote after a price
+// change and a deadline for the whole call. an order is never sent twice : its clientId is looked for before a resend
+type TradeExecutor struct {
+	// the broker of the bot, it is replaced when the stream starts
+	broker      func() Broker
+	maxAttempts int
+	delay       time.Duration
+	maxDelay    time.Duration
+	timeout     time.Duration
+}
+
+func NewTradeExecutor(appConfig *config.AppConfig, broker func() Broker) *TradeExecutor {
+	maxAttempts := appConfig.TradeMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &TradeExecutor{
+		broker:      broker,
+		maxAttempts: maxAttempts,
+		delay:       appConfig.TradeRetryDelay,
+		maxDelay:    appConfig.TradeRetryMaxDelay,
+		timeout:     appConfig.TradeExecuteTimeout,
+	}
+}
+
+// Execute returns the response of the broker, and an error when the trade was not done. broker errors are *TradeError
+func (e *TradeExecutor) Execute(request MetaApiTradeRequest) (*TradeResponse, error) {
+	deadline := time.Now().Add(e.timeout)
+	var trade *TradeResponse
+	var lastErr error
+	for attempt := 1; attempt <= e.maxAttempts; attempt++ {
+		if attempt > 1 && opensTrade(request) {
+			// the previous attempt may have been done even without an answer
+			existing, err := e.findByClientId(*request.ClientID)
+			if err != nil {
+				// without the check the trade could be placed twice
+				log.Printf("Error looking for trade %s before sending it again: %v", *request.ClientID, err)
+				return trade, fmt.Errorf("trade %s may be placed, not sent again: %w", *request.ClientID, errors.Join(lastErr, err))
+			}
+			if existing != nil {
+				log.Printf("Trade %s already placed, not sent again", *request.ClientID)
+				return existing, nil
+			}
+		}
+		var err error
+		trade, err = e.broker().ExecuteTrade(request)
+		if err != nil {
+			// no answer, retried
+			log.Printf("Error placing trade (attempt %d/%d): %v", attempt, e.maxAttempts, err)
+			lastErr = err
+		} else {
+			errorTrade := HandleTradeError(trade.NumericCode)
+			tradeErr, ok := errorTrade.(*TradeError)
+			if !ok {
+				// unknown code : the trade may be done, the clientId check avoids a duplicate
+				log.Printf("Unknown trade answer (attempt %d/%d): %v", attempt, e.maxAttempts, trade)
+				lastErr = fmt.Errorf("invalid code returned %d %s %s", trade.NumericCode, trade.StringCode, trade.Message)
+			} else if tradeErr.Type == Success {
+				log.Printf("Trade placed successfully: %v", trade)
+				return trade, nil
+			} else if tradeErr.Type == NoRetry {
+				return trade, tradeErr
+			} else {
+				lastErr = tradeErr
+				if tradeErr.Code == ERR_PRICE_CHANGED || tradeErr.Code == ERR_REQUOTE {
+					// market moved, try again at once with the new quote unless it is beyond the stop loss
+					if errQuote := e.requote(request); errQuote != nil {
+						return trade, errQuote
+					}
+					continue
+				}
+			}
+		}
+		if attempt == e.maxAttempts {
+			break
+		}
+		delay := e.backoff(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return trade, fmt.Errorf("trade not done before the %s deadline: %w", e.timeout, lastErr)
+		}
+		time.Sleep(delay)
+	}
+	return trade, lastErr
+}
+
+// delay doubled on each attempt, half of it random so that several trades do not retry together
+func (e *TradeExecutor) backoff(attempt int) time.Duration {
+	delay := e.delay << (attempt - 1)
+	if delay <= 0 || delay > e.maxDelay {
+		delay = e.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// new market price of a requoted order, an error stops the retries
+func (e *TradeExecutor) requote(request MetaApiTradeRequest) error {
+	if request.Symbol == "" || request.StopLoss == nil || *request.StopLoss <= 0 {
+		return nil
+	}
+	price, err := e.broker().Price(request.Symbol)
+	if err != nil {
+		// the broker quotes again anyway
+		return nil
+	}
+	log.Printf("Requote %s : bid %.5f ask %.5f", request.Symbol, price.Bid, price.Ask)
+	if strings.HasPrefix(request.ActionType, "ORDER_TYPE_BUY") && price.Bid <= *request.StopLoss {
+		return errors.New("requoted price beyond the stop loss")
+	}
+	if strings.HasPrefix(request.ActionType, "ORDER_TYPE_SELL") && price.Ask >= *request.StopLoss {
+		return errors.New("requoted price beyond the stop loss")
+	}
+	return nil
+}
+
+// orders and positions opening requests, the ones which can be duplicated
+func opensTrade(request MetaApiTradeRequest) bool {
+	return strings.HasPrefix(request.ActionType, "ORDER_TYPE_") && request.ClientID != nil && *request.ClientID != ""
+}
+
+// position or pending order already opened with this clientId, an error when the broker can not tell
+func (e *TradeExecutor) findByClientId(clientId string) (*TradeResponse, error) {
+	// asked to the REST api, the stream may not have received the trade of an unanswered request yet
+	broker := restBroker(e.broker())
+	positions, err := broker.Positions()
+	if err != nil {
+		return nil, err
+	}
+	for _, position := range positions {
+		if position.ClientID == clientId {
+			id := position.ID
+			return &TradeResponse{NumericCode: ERR_NO_ERROR, StringCode: "TRADE_RETCODE_DONE", PositionId: &id, OrderId: &id}, nil
+		}
+	}
+	orders, err := broker.Orders()
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		if order.ClientID == clientId {
+			id := order.ID
+			return &TradeResponse{NumericCode: ERR_NO_ERROR, StringCode: "TRADE_RETCODE_DONE", OrderId: &id}, nil
+		}
+	}
+	return nil, nil
+}
+
+// reason shown to the user when a trade failed
+func tradeErrorReason(err error) string {
+	var tradeErr *TradeError
+	if errors.As(err, &tradeErr) {
+		return tradeErr.Description
+	}
+	return err.Error()
+}
@@ -0,0 +1,259 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// trailing stop of a channel
+const (
+	TrailingModeOff = "OFF"
+	// after TP1 the stop loss follows the price at the distance between the entry and TP1
+	TrailingModeDistance = "DISTANCE"
+	// stop loss to the entry at TP1, to TP1 at TP2 and so on
+	TrailingModeThreshold = "THRESHOLD"
+	// after TP1 the stop loss follows the price at the ATR times the multiplier
+	TrailingModeATR = "ATR"
+)
+
+var TrailingModes = []string{TrailingModeOff, TrailingModeDistance, TrailingModeThreshold, TrailingModeATR}
+
+// who moves the stop loss of a trailed position
+const (
+	TrailingSideBroker = "BROKER"
+	TrailingSideBot    = "BOT"
+)
+
+// part of the distance the price has to move before the bot moves the stop loss again
+const trailingMinStep = 0.1
+
+// the broker applies the trailing stops sent with the trade requests
+func (tgBot *TgBot) brokerTrails() bool {
+	return tgBot.AppConfig.BrokerTrailingStop && tgBot.Broker.TrailingStopLoss()
+}
+
+// stop loss step : when the price reaches the TP the stop loss goes to the entry for TP1, to the previous TP after
+type trailingStep struct {
+	tpNumber int
+	tp       float64
+	stopLoss float64
+}
+
+func trailingSteps(specifications *symbolSpecificationCache, request *TradeRequest, tpNumbers []int, openPrice float64, positionType string) []trailingStep {
+	var steps []trailingStep
+	for _, tpNumber := range tpNumbers {
+		tp := request.TakeProfit(tpNumber)
+		if tp <= 0 {
+			continue
+		}
+		stopLoss := calculateNewStopLossPriceForBreakeven(specifications, openPrice, positionType, request.Symbol)
+		if previousTp := request.TakeProfit(tpNumber - 1); tpNumber > 1 && previousTp > 0 {
+			stopLoss = previousTp
+		}
+		steps = append(steps, trailingStep{tpNumber: tpNumber, tp: tp, stopLoss: stopLoss})
+	}
+	return steps
+}
+
+// TPs of the signal before the one of a leg
+func takeProfitsBefore(request *TradeRequest, legTp int) []int {
+	var tpNumbers []int
+	for tpNumber := 1; tpNumber < legTp; tpNumber++ {
+		if request.TakeProfit(tpNumber) > 0 {
+			tpNumbers = append(tpNumbers, tpNumber)
+		}
+	}
+	return tpNumbers
+}
+
+// threshold trailing sent with the order of a leg when the channel uses it and the broker supports it
+func (tgBot *TgBot) legTrailingStopLoss(channelID int, request *TradeRequest, legTp int, openPrice float64) *TrailingStopLoss {
+	if tgBot.RedisClient.GetChannelTrailingMode(channelID) != TrailingModeThreshold || !tgBot.brokerTrails() {
+		return nil
+	}
+	positionType := "POSITION_TYPE_BUY"
+	if request.ActionType == "ORDER_TYPE_SELL" {
+		positionType = "POSITION_TYPE_SELL"
+	}
+	var thresholds []StopLossThreshold
+	for _, step := range trailingSteps(tgBot.specifications, request, takeProfitsBefore(request, legTp), openPrice, positionType) {
+		thresholds = append(thresholds, StopLossThreshold{Threshold: step.tp, StopLoss: step.stopLoss})
+	}
+	if len(thresholds) == 0 {
+		return nil
+	}
+	return &TrailingStopLoss{
+		Threshold: &ThresholdTrailingStopLoss{Thresholds: thresholds, Units: "ABSOLUTE_PRICE"},
+	}
+}
+
+// price reached, from the side of the position
+func priceReached(position MetaApiPosition, price float64) bool {
+	if position.Type == "POSITION_TYPE_BUY" {
+		return position.CurrentPrice >= price
+	}
+	return position.CurrentPrice <= price
+}
+
+// manageTrailingStops move the stop loss of the positions : TPs without leg of the strategy, threshold steps and
+// distance trailing of the channel when the broker does not do it
+func (tgBot *TgBot) manageTrailingStops(positions []MetaApiPosition) {
+	requests := make(map[int]*TradeRequest)
+	for _, position := range positions {
+		messageId := extractMessageIdFromClientId(position.ClientID)
+		if messageId == 0 || position.CurrentPrice <= 0 {
+			continue
+		}
+		request, ok := requests[messageId]
+		if !ok {
+			request = tgBot.storedTradeRequest(messageId)
+			requests[messageId] = request
+		}
+		if request == nil {
+			continue
+		}
+		legTp := extractTPFromClientId(position.ClientID)
+		mode := tgBot.RedisClient.GetChannelTrailingMode(extractChannelIDFromClientId(position.ClientID))
+		side, distance := tgBot.RedisClient.GetPositionTrailing(position.ID)
+		positionMessageId := int(tgBot.RedisClient.GetPositionMessageId(position.ID))
+
+		// steps : TPs without leg of the strategy, every TP before the leg with the threshold mode
+		tpNumbers := tgBot.requestStrategy(request).trailTargets(request, legTp)
+		if side == TrailingSideBroker {
+			tpNumbers = nil
+		} else if mode == TrailingModeThreshold {
+			tpNumbers = takeProfitsBefore(request, legTp)
+		}
+		newStopLoss := 0.0
+		reachedTp := 0
+		for _, step := range trailingSteps(tgBot.specifications, request, tpNumbers, position.OpenPrice, position.Type) {
+			if !priceReached(position, step.tp) {
+				break
+			}
+			newStopLoss = step.stopLoss
+			reachedTp = step.tpNumber
+		}
+		stepStopLoss := newStopLoss
+
+		// distance trailing once TP1 is reached
+		if (mode == TrailingModeDistance || mode == TrailingModeATR) && legTp != 1 && request.TakeProfit1 > 0 &&
+			priceReached(position, request.TakeProfit1) && side != TrailingSideBroker {
+			if side == "" {
+				distance = tgBot.trailingDistance(mode, request, position)
+				side = TrailingSideBot
+				if tgBot.brokerTrails() && tgBot.startBrokerTrailing(position, distance) {
+					side = TrailingSideBroker
+				}
+				tgBot.RedisClient.SetPositionTrailing(position.ID, side, distance)
+				tgBot.sendMessage(fmt.Sprintf("🚀 Trailing stop started (%s)\n➡️Position ID: %s\n📏 Distance: %.5f", mode,
+					position.ID, distance), positionMessageId)
+			}
+			if side == TrailingSideBot {
+				trailStopLoss := position.CurrentPrice - distance
+				if position.Type == "POSITION_TYPE_SELL" {
+					trailStopLoss = position.CurrentPrice + distance
+				}
+				// not for each tick
+				if math.Abs(trailStopLoss-position.StopLoss) >= distance*trailingMinStep &&
+					isBetterStopLoss(position.Type, trailStopLoss, newStopLoss) {
+					newStopLoss = trailStopLoss
+				}
+			}
+		}
+
+		if newStopLoss == 0 || !isBetterStopLoss(position.Type, newStopLoss, position.StopLoss) {
+			continue
+		}
+		metaApiRequest := MetaApiTradeRequest{
+			ActionType: "POSITION_MODIFY",
+			StopLoss:   &newStopLoss,
+			PositionID: &position.ID,
+			TakeProfit: &position.TakeProfit,
+		}
+		if _, err := tgBot.Executor.Execute(metaApiRequest); err != nil {
+			log.Printf("Error trailing stop loss of %s: %v", position.ID, err)
+			tgBot.sendMessage(fmt.Sprintf("❌ Failed moving SL\n❌ Error: %s", tradeErrorReason(err)), positionMessageId)
+			continue
+		}
+		log.Printf("Trailing stop loss of %s: %.5f -> %.5f", position.ID, position.StopLoss, newStopLoss)
+		if reachedTp > 0 && newStopLoss == stepStopLoss {
+			tgBot.sendMessage(fmt.Sprintf("🎯 TP%d reached\n➡️Position ID: %s\nSL: %.2f -> %.2f", reachedTp, position.ID,
+				position.StopLoss, newStopLoss), positionMessageId)
+		}
+	}
+}
+
+// a stop loss closer to the price than another one, 0 is no stop loss
+func isBetterStopLoss(positionType string, stopLoss float64, than float64) bool {
+	if than == 0 {
+		return true
+	}
+	if positionType == "POSITION_TYPE_BUY" {
+		return stopLoss > than
+	}
+	return stopLoss < than
+}
+
+// distance of the trailing stop in price : ATR times the multiplier, or the distance between the entry and TP1
+func (tgBot *TgBot) trailingDistance(mode string, request *TradeRequest, position MetaApiPosition) float64 {
+	distance := math.Abs(request.TakeProfit1 - position.OpenPrice)
+	if mode == TrailingModeATR {
+		atr, err := tgBot.averageTrueRange(position.Symbol)
+		if err != nil {
+			log.Printf("Error computing %s ATR, trailing at the TP1 distance: %v", position.Symbol, err)
+			return distance
+		}
+		return atr * tgBot.AppConfig.TrailingATRMultiplier
+	}
+	return distance
+}
+
+// average true range of the last candles of the ATR timeframe
+func (tgBot *TgBot) averageTrueRange(symbol string) (float64, error) {
+	period := tgBot.AppConfig.TrailingATRPeriod
+	if period < 1 {
+		period = 14
+	}
+	candles, err := tgBot.Broker.Candles(symbol, tgBot.AppConfig.TrailingATRTimeframe, period+1)
+	if err != nil {
+		return 0, err
+	}
+	if len(candles) < 2 {
+		return 0, errors.New("not enough candles")
+	}
+	total := 0.0
+	for i := 1; i < len(candles); i++ {
+		previousClose := candles[i-1].Close
+		trueRange := math.Max(candles[i].High-candles[i].Low,
+			math.Max(math.Abs(candles[i].High-previousClose), math.Abs(candles[i].Low-previousClose)))
+		total += trueRange
+	}
+	return total / float64(len(candles)-1), nil
+}
+
+// ask the broker to trail the position, false when it refused
+func (tgBot *TgBot) startBrokerTrailing(position MetaApiPosition, distance float64) bool {
+	stopLoss := position.CurrentPrice - distance
+	if position.Type == "POSITION_TYPE_SELL" {
+		stopLoss = position.CurrentPrice + distance
+	}
+	if !isBetterStopLoss(position.Type, stopLoss, position.StopLoss) {
+		stopLoss = position.StopLoss
+	}
+	metaApiRequest := MetaApiTradeRequest{
+		ActionType: "POSITION_MODIFY",
+		StopLoss:   &stopLoss,
+		PositionID: &position.ID,
+		TakeProfit: &position.TakeProfit,
+		TrailingStopLoss: &TrailingStopLoss{
+			Distance: &DistanceTrailingStopLoss{Distance: distance, Units: "RELATIVE_PRICE"},
+		},
+	}
+	if _, err := tgBot.Executor.Execute(metaApiRequest); err != nil {
+		log.Printf("Broker trailing refused for %s, trailed by the bot: %v", position.ID, err)
+		return false
+	}
+	return true
+}